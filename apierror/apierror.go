@@ -0,0 +1,135 @@
+// Package apierror defines the catalog of machine-readable error codes the
+// API returns and the HTTP status each one maps to. Handlers report errors
+// only through these codes, so clients can branch on the code without
+// parsing messages and the catalog can be published as-is.
+package apierror
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// Code is a machine-readable error code.
+type Code string
+
+const (
+	InvalidParam        Code = "INVALID_PARAM"
+	InvalidBody         Code = "INVALID_BODY"
+	InvalidID           Code = "INVALID_ID"
+	InvalidLanguage     Code = "INVALID_LANGUAGE"
+	InvalidType         Code = "INVALID_TYPE"
+	InvalidTag          Code = "INVALID_TAG"
+	InvalidAttribute    Code = "INVALID_ATTRIBUTE"
+	BlockedTag          Code = "BLOCKED_TAG"
+	ValidationFailed    Code = "VALIDATION_FAILED"
+	InvalidFieldForType Code = "INVALID_FIELD_FOR_TYPE"
+	ContentRejected     Code = "CONTENT_REJECTED"
+	Unauthorized        Code = "UNAUTHORIZED"
+	NotFound            Code = "NOT_FOUND"
+	MethodNotAllowed    Code = "METHOD_NOT_ALLOWED"
+	Conflict            Code = "CONFLICT"
+	PayloadTooLarge     Code = "PAYLOAD_TOO_LARGE"
+	ReadOnly            Code = "READ_ONLY"
+	RateLimited         Code = "RATE_LIMITED"
+	DBUnavailable       Code = "DB_UNAVAILABLE"
+	Timeout             Code = "TIMEOUT"
+	UpstreamFailed      Code = "UPSTREAM_FAILED"
+	Internal            Code = "INTERNAL"
+)
+
+// Entry describes one catalog code.
+type Entry struct {
+	// Machine-readable code
+	Code Code `json:"code"`
+
+	// HTTP status returned with the code
+	Status int `json:"status"`
+
+	// When the code is returned
+	Description string `json:"description"`
+}
+
+// catalog is the single place that maps codes to HTTP status codes.
+var catalog = []Entry{
+	{InvalidParam, http.StatusBadRequest, "A query or path parameter is missing, malformed or out of range."},
+	{InvalidBody, http.StatusBadRequest, "The request body is not valid JSON of the expected shape."},
+	{InvalidID, http.StatusBadRequest, "The ID in the path is not a positive integer."},
+	{InvalidLanguage, http.StatusBadRequest, "The language parameter is not a two-letter ISO 639-1 code."},
+	{InvalidType, http.StatusBadRequest, "The type parameter is not \"truth\" or \"dare\"."},
+	{InvalidTag, http.StatusBadRequest, "A tag in the tags parameter is empty, malformed or one too many."},
+	{InvalidAttribute, http.StatusBadRequest, "A question attribute is not in the attribute schema or has the wrong type."},
+	{BlockedTag, http.StatusBadRequest, "A tag is on the instance's list of blocked tags."},
+	{ValidationFailed, http.StatusBadRequest, "One or more fields are invalid; see fields for details."},
+	{InvalidFieldForType, http.StatusUnprocessableEntity, "A field is not allowed for the question type."},
+	{ContentRejected, http.StatusUnprocessableEntity, "A content filter rejected the question."},
+	{Unauthorized, http.StatusUnauthorized, "The API key is missing or invalid."},
+	{NotFound, http.StatusNotFound, "The requested resource does not exist."},
+	{MethodNotAllowed, http.StatusMethodNotAllowed, "The endpoint does not support the request method."},
+	{Conflict, http.StatusConflict, "The request conflicts with existing data."},
+	{PayloadTooLarge, http.StatusRequestEntityTooLarge, "The request body is larger than the endpoint accepts."},
+	{ReadOnly, http.StatusForbidden, "The instance does not accept writes."},
+	{RateLimited, http.StatusTooManyRequests, "Too many requests; retry later."},
+	{DBUnavailable, http.StatusServiceUnavailable, "The database is unavailable or contended; retry later."},
+	{Timeout, http.StatusGatewayTimeout, "The request took too long to complete."},
+	{UpstreamFailed, http.StatusBadGateway, "An external service the request depends on failed."},
+	{Internal, http.StatusInternalServerError, "An unexpected server error occurred."},
+}
+
+// Catalog returns a copy of every catalog entry.
+func Catalog() []Entry {
+	return append([]Entry(nil), catalog...)
+}
+
+// Status returns the HTTP status code for code. Codes outside the catalog
+// map to 500 Internal Server Error.
+func Status(code Code) int {
+	for _, e := range catalog {
+		if e.Code == code {
+			return e.Status
+		}
+	}
+	return http.StatusInternalServerError
+}
+
+// FieldError describes a problem with a single field of a request body.
+type FieldError struct {
+	// Name of the offending field
+	// @example "language"
+	Field string `json:"field"`
+
+	// What is wrong with the field
+	// @example "language must be a two-letter ISO 639-1 code"
+	Message string `json:"message"`
+}
+
+// Error is an error carrying a catalog code.
+type Error struct {
+	Code    Code
+	Message string
+	Fields  []FieldError
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Status returns the HTTP status code of the error's code.
+func (e *Error) Status() int {
+	return Status(e.Code)
+}
+
+// New returns an Error with the given code and message.
+func New(code Code, message string) *Error {
+	return &Error{Code: code, Message: message}
+}
+
+// Newf returns an Error with the given code and formatted message.
+func Newf(code Code, format string, args ...interface{}) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// Validation returns a VALIDATION_FAILED error listing the given field
+// errors.
+func Validation(fields ...FieldError) *Error {
+	return &Error{Code: ValidationFailed, Message: "Validation failed", Fields: fields}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Attribute value types supported by the attribute schema.
+const (
+	AttributeString = "string"
+	AttributeNumber = "number"
+	AttributeBool   = "bool"
+)
+
+// attributeKeyPattern restricts attribute keys to identifiers that are safe
+// to embed in a JSON path.
+var attributeKeyPattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,49}$`)
+
+// AttributeDef describes one allowed question attribute
+// @Description Type and allowed values of a question attribute
+type AttributeDef struct {
+	// Value type: "string", "number" or "bool"
+	// @example "bool"
+	Type string `json:"type"`
+
+	// Allowed values for string attributes; empty allows any string
+	// @example ["indoor","outdoor"]
+	Enum []string `json:"enum,omitempty"`
+}
+
+// AttributeSchema maps attribute keys to their definitions.
+type AttributeSchema map[string]AttributeDef
+
+// AttributeError is returned when question attributes or attribute filters
+// do not match the configured schema.
+type AttributeError struct {
+	Key     string
+	Reason  string
+	Allowed []string
+}
+
+func (e *AttributeError) Error() string {
+	if e.Allowed != nil {
+		allowed := "none are configured"
+		if len(e.Allowed) > 0 {
+			allowed = "allowed keys are " + strings.Join(e.Allowed, ", ")
+		}
+		return fmt.Sprintf("attribute %q: %s; %s", e.Key, e.Reason, allowed)
+	}
+	return fmt.Sprintf("attribute %q: %s", e.Key, e.Reason)
+}
+
+var attributeSchema AttributeSchema
+
+// loadAttributeSchema reads the attribute schema from the JSON file named by
+// the ATTRIBUTE_SCHEMA_FILE environment variable. The file maps attribute
+// keys to AttributeDef objects. Without ATTRIBUTE_SCHEMA_FILE no attributes
+// are allowed.
+func loadAttributeSchema() (AttributeSchema, error) {
+	path := os.Getenv("ATTRIBUTE_SCHEMA_FILE")
+	if path == "" {
+		return AttributeSchema{}, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read attribute schema file: %w", err)
+	}
+
+	var loaded AttributeSchema
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		return nil, fmt.Errorf("failed to parse attribute schema file: %w", err)
+	}
+
+	for key, def := range loaded {
+		if !attributeKeyPattern.MatchString(key) {
+			return nil, fmt.Errorf("attribute %q: keys must be lowercase identifiers of at most 50 characters", key)
+		}
+		switch def.Type {
+		case AttributeString:
+		case AttributeNumber, AttributeBool:
+			if len(def.Enum) > 0 {
+				return nil, fmt.Errorf("attribute %q: enum is only supported for string attributes", key)
+			}
+		default:
+			return nil, fmt.Errorf("attribute %q: unknown type %q", key, def.Type)
+		}
+	}
+
+	return loaded, nil
+}
+
+// keys returns the attribute keys in the schema, sorted.
+func (s AttributeSchema) keys() []string {
+	keys := make([]string, 0, len(s))
+	for key := range s {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Validate checks that every attribute is defined in the schema and holds a
+// value of the declared type.
+func (s AttributeSchema) Validate(attrs map[string]interface{}) error {
+	for key, value := range attrs {
+		def, ok := s[key]
+		if !ok {
+			return &AttributeError{Key: key, Reason: "unknown attribute", Allowed: s.keys()}
+		}
+		if err := def.check(key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// check verifies that value matches the definition of attribute key.
+func (def AttributeDef) check(key string, value interface{}) error {
+	switch v := value.(type) {
+	case string:
+		if def.Type != AttributeString {
+			return &AttributeError{Key: key, Reason: "must be a " + def.Type}
+		}
+		if len(def.Enum) > 0 && !containsString(def.Enum, v) {
+			return &AttributeError{Key: key, Reason: fmt.Sprintf("must be one of %s", strings.Join(def.Enum, ", "))}
+		}
+	case float64:
+		if def.Type != AttributeNumber {
+			return &AttributeError{Key: key, Reason: "must be a " + def.Type}
+		}
+	case bool:
+		if def.Type != AttributeBool {
+			return &AttributeError{Key: key, Reason: "must be a " + def.Type}
+		}
+	default:
+		return &AttributeError{Key: key, Reason: "must be a string, number or bool"}
+	}
+	return nil
+}
+
+// ParseFilter converts the raw query value of an attr.<key> parameter to the
+// attribute's declared type.
+func (s AttributeSchema) ParseFilter(key, raw string) (interface{}, error) {
+	def, ok := s[key]
+	if !ok {
+		return nil, &AttributeError{Key: key, Reason: "unknown attribute", Allowed: s.keys()}
+	}
+
+	var value interface{} = raw
+	switch def.Type {
+	case AttributeNumber:
+		n, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return nil, &AttributeError{Key: key, Reason: "must be a number"}
+		}
+		value = n
+	case AttributeBool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, &AttributeError{Key: key, Reason: "must be true or false"}
+		}
+		value = b
+	}
+
+	if err := def.check(key, value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// attributePath returns the JSON path selecting key in the attributes column.
+func attributePath(key string) string {
+	return `$."` + key + `"`
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/2Friendly4You/TruthOrDare/apierror"
+)
+
+// contextKey is the type of request context keys set by this package.
+type contextKey int
+
+// apiKeyNameContextKey holds the name of the API key a request was
+// authenticated with.
+const apiKeyNameContextKey contextKey = iota
+
+// apiKeys returns the configured API keys by name. API_KEY is named
+// "default"; API_KEYS adds comma-separated name:key pairs, so every client
+// can get its own key and shows up under its name in audit logs.
+func apiKeys() map[string]string {
+	keys := map[string]string{}
+	if key := os.Getenv("API_KEY"); key != "" {
+		keys["default"] = key
+	}
+	for _, entry := range strings.Split(os.Getenv("API_KEYS"), ",") {
+		name, key, ok := strings.Cut(strings.TrimSpace(entry), ":")
+		if ok && name != "" && key != "" {
+			keys[name] = key
+		}
+	}
+	return keys
+}
+
+// requireAPIKey rejects requests that do not carry one of the API keys from
+// apiKeys as an "Authorization: Bearer <key>" header. If no key is
+// configured, every request is rejected. The name of the matching key is
+// stored in the request context, see apiKeyName, and in the access log.
+func requireAPIKey(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		var matched string
+		if ok {
+			// Every key is compared so the time taken does not reveal
+			// which one, if any, matched.
+			for name, key := range apiKeys() {
+				if subtle.ConstantTimeCompare([]byte(token), []byte(key)) == 1 {
+					matched = name
+				}
+			}
+		}
+		if matched == "" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="api"`)
+			writeError(w, apierror.Unauthorized, "Missing or invalid API key")
+			return
+		}
+
+		if sw, ok := w.(*statusWriter); ok {
+			sw.apiKeyName = matched
+		}
+		next(w, r.WithContext(context.WithValue(r.Context(), apiKeyNameContextKey, matched)))
+	}
+}
+
+// apiKeyName returns the name of the API key the request was authenticated
+// with, or "" for requests that passed no requireAPIKey check.
+func apiKeyName(ctx context.Context) string {
+	name, _ := ctx.Value(apiKeyNameContextKey).(string)
+	return name
+}
+
+// debugEnabled reports whether the debug endpoints are switched on through
+// the DEBUG_ENDPOINTS environment variable.
+func debugEnabled() bool {
+	return os.Getenv("DEBUG_ENDPOINTS") == "true"
+}
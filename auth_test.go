@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/2Friendly4You/TruthOrDare/apierror"
+)
+
+func TestAPIKeys(t *testing.T) {
+	tests := []struct {
+		name    string
+		apiKey  string
+		apiKeys string
+		want    map[string]string
+	}{
+		{"none", "", "", map[string]string{}},
+		{"single key", "secret", "", map[string]string{"default": "secret"}},
+		{"named keys", "", "ops:one, app:two", map[string]string{"ops": "one", "app": "two"}},
+		{"both", "secret", "ops:one", map[string]string{"default": "secret", "ops": "one"}},
+		{"key may contain colons", "", "ops:a:b", map[string]string{"ops": "a:b"}},
+		{"skips malformed entries", "", "nokey,:anon,empty:,,ops:one", map[string]string{"ops": "one"}},
+		{"named default overrides API_KEY", "secret", "default:other", map[string]string{"default": "other"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("API_KEY", tt.apiKey)
+			t.Setenv("API_KEYS", tt.apiKeys)
+			if got := apiKeys(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("apiKeys() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequireAPIKey(t *testing.T) {
+	t.Setenv("API_KEY", "secret")
+	t.Setenv("API_KEYS", "ops:ops-secret")
+
+	tests := []struct {
+		name          string
+		authorization string
+		wantName      string
+	}{
+		{"missing header", "", ""},
+		{"wrong key", "Bearer nope", ""},
+		{"key prefix", "Bearer secre", ""},
+		{"missing scheme", "secret", ""},
+		{"other scheme", "Basic secret", ""},
+		{"lowercase scheme", "bearer secret", ""},
+		{"default key", "Bearer secret", "default"},
+		{"named key", "Bearer ops-secret", "ops"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called := false
+			var gotName string
+			handler := requireAPIKey(func(w http.ResponseWriter, r *http.Request) {
+				called = true
+				gotName = apiKeyName(r.Context())
+			})
+
+			r := httptest.NewRequest(http.MethodPost, "/api/questions", nil)
+			if tt.authorization != "" {
+				r.Header.Set("Authorization", tt.authorization)
+			}
+			w := httptest.NewRecorder()
+			handler(w, r)
+
+			if tt.wantName != "" {
+				if !called {
+					t.Fatalf("next handler not called, status %d", w.Code)
+				}
+				if gotName != tt.wantName {
+					t.Errorf("apiKeyName = %q, want %q", gotName, tt.wantName)
+				}
+				return
+			}
+			if called {
+				t.Fatal("next handler called without a valid key")
+			}
+			assertUnauthorized(t, w)
+		})
+	}
+}
+
+func TestRequireAPIKeyWithoutKeys(t *testing.T) {
+	t.Setenv("API_KEY", "")
+	t.Setenv("API_KEYS", "")
+
+	handler := requireAPIKey(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("next handler called with no keys configured")
+	})
+	for _, authorization := range []string{"", "Bearer ", "Bearer anything"} {
+		r := httptest.NewRequest(http.MethodPost, "/api/questions", nil)
+		r.Header.Set("Authorization", authorization)
+		w := httptest.NewRecorder()
+		handler(w, r)
+		assertUnauthorized(t, w)
+	}
+}
+
+func TestAPIKeyNameWithoutAuth(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/api/questions", nil)
+	if got := apiKeyName(r.Context()); got != "" {
+		t.Errorf("apiKeyName = %q, want empty", got)
+	}
+}
+
+// TestQuestionWritesRequireAPIKey checks that every route changing questions
+// is wrapped in requireAPIKey, both in the route table and when served.
+func TestQuestionWritesRequireAPIKey(t *testing.T) {
+	t.Setenv("API_KEY", "secret")
+	t.Setenv("API_KEYS", "")
+
+	writes := []struct {
+		method  string
+		pattern string
+		path    string
+	}{
+		{http.MethodPost, "/api/questions", "/api/questions"},
+		{http.MethodPost, "/api/questions/bulk", "/api/questions/bulk"},
+		{http.MethodPut, "/api/questions/", "/api/questions/1"},
+		{http.MethodDelete, "/api/questions/", "/api/questions/1"},
+	}
+
+	routes := apiRoutes()
+	requireAPIKeyPtr := reflect.ValueOf(requireAPIKey).Pointer()
+	for _, write := range writes {
+		found := false
+		for _, route := range routes {
+			if route.Method != write.method || route.Pattern != write.pattern {
+				continue
+			}
+			found = true
+			guarded := false
+			for _, m := range route.Middlewares {
+				if reflect.ValueOf(m).Pointer() == requireAPIKeyPtr {
+					guarded = true
+				}
+			}
+			if !guarded {
+				t.Errorf("%s %s is not wrapped in requireAPIKey", write.method, write.pattern)
+			}
+		}
+		if !found {
+			t.Errorf("no route for %s %s", write.method, write.pattern)
+		}
+	}
+
+	mux := buildMux(routes)
+	for _, write := range writes {
+		t.Run(write.method+" "+write.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, httptest.NewRequest(write.method, write.path, nil))
+			assertUnauthorized(t, w)
+		})
+	}
+}
+
+// assertUnauthorized checks that w holds a 401 UNAUTHORIZED error with a
+// bearer challenge.
+func assertUnauthorized(t *testing.T, w *httptest.ResponseRecorder) {
+	t.Helper()
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want 401, body %s", w.Code, w.Body)
+	}
+	if got := w.Header().Get("WWW-Authenticate"); got != `Bearer realm="api"` {
+		t.Errorf("WWW-Authenticate = %q", got)
+	}
+	var resp ErrorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Code != string(apierror.Unauthorized) {
+		t.Errorf("code = %s, want %s", resp.Code, apierror.Unauthorized)
+	}
+}
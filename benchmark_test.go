@@ -0,0 +1,97 @@
+package main
+
+import (
+	"database/sql/driver"
+	"io"
+	"log"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// benchmarkAPIKey is the API key benchmarkServer accepts for writes.
+const benchmarkAPIKey = "benchmark-key"
+
+// benchmarkServer returns the full API mux, with every middleware, backed by
+// a MockDB whose queries answer with n questions. Logs are formatted but
+// discarded so the benchmarks include their cost without flooding the output.
+func benchmarkServer(b *testing.B, n int) http.Handler {
+	b.Helper()
+	b.Setenv("API_KEY", benchmarkAPIKey)
+	b.Setenv("API_KEYS", "")
+
+	savedLogger, savedLimiter, savedReady, savedOutput := logger, rateLimiter, dbReady.Load(), log.Writer()
+	logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	rateLimiter = nil
+	dbReady.Store(true)
+	log.SetOutput(io.Discard)
+	b.Cleanup(func() {
+		logger, rateLimiter = savedLogger, savedLimiter
+		dbReady.Store(savedReady)
+		log.SetOutput(savedOutput)
+	})
+
+	tagLists := make([]string, n)
+	for i := range tagLists {
+		tagLists[i] = "funny" + listSeparator + "party" + listSeparator + "social"
+	}
+	mock := useMockDB(b)
+	mock.Query = func(query string, args []driver.Value) (*MockRows, error) {
+		if strings.HasPrefix(query, "SELECT COUNT(*)") {
+			return &MockRows{Columns: []string{"count"}, Values: [][]driver.Value{{int64(n)}}}, nil
+		}
+		return questionRows(tagLists...), nil
+	}
+	return buildMux(apiRoutes())
+}
+
+// serveBenchmark sends the request built by newRequest b.N times and fails
+// unless every response has status want.
+func serveBenchmark(b *testing.B, handler http.Handler, want int, newRequest func() *http.Request) {
+	b.Helper()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, newRequest())
+		if w.Code != want {
+			b.Fatalf("status = %d, want %d, body %.200s", w.Code, want, w.Body)
+		}
+	}
+}
+
+func BenchmarkGetQuestionsEndpoint(b *testing.B) {
+	handler := benchmarkServer(b, defaultQuestionsLimit)
+	serveBenchmark(b, handler, http.StatusOK, func() *http.Request {
+		return httptest.NewRequest(http.MethodGet, "/api/questions?language=en&tags=funny,party", nil)
+	})
+}
+
+func BenchmarkGetRandomQuestionEndpoint(b *testing.B) {
+	handler := benchmarkServer(b, 1)
+	serveBenchmark(b, handler, http.StatusOK, func() *http.Request {
+		return httptest.NewRequest(http.MethodGet, "/api/questions/random?language=en&type=truth", nil)
+	})
+}
+
+func BenchmarkCreateQuestionEndpoint(b *testing.B) {
+	handler := benchmarkServer(b, 0)
+	const body = `{"language": "en", "type": "truth", "task": "What is your biggest fear?", "tags": ["funny", "party"]}`
+	serveBenchmark(b, handler, http.StatusCreated, func() *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/api/questions", strings.NewReader(body))
+		r.Header.Set("Authorization", "Bearer "+benchmarkAPIKey)
+		return r
+	})
+}
+
+func BenchmarkBulkImportEndpoint(b *testing.B) {
+	handler := benchmarkServer(b, 0)
+	body := bulkBody(importBatchSize, -1)
+	serveBenchmark(b, handler, http.StatusCreated, func() *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/api/questions/bulk", strings.NewReader(body))
+		r.Header.Set("Authorization", "Bearer "+benchmarkAPIKey)
+		return r
+	})
+}
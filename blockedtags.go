@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// BlockedTagError is returned when a write would create or attach a tag
+// listed in BLOCKED_TAGS.
+type BlockedTagError struct {
+	Tag string
+}
+
+func (e *BlockedTagError) Error() string {
+	return fmt.Sprintf("tag %q is not allowed", e.Tag)
+}
+
+// normalizeTagName returns the form tags are compared in. Tag names are
+// stored with a case-insensitive collation, so case never distinguishes two
+// tags.
+func normalizeTagName(tag string) string {
+	return strings.ToLower(strings.TrimSpace(tag))
+}
+
+// blockedTags returns the normalized tag names listed in the comma-separated
+// BLOCKED_TAGS environment variable.
+func blockedTags() map[string]bool {
+	blocked := map[string]bool{}
+	for _, tag := range strings.Split(os.Getenv("BLOCKED_TAGS"), ",") {
+		if tag = normalizeTagName(tag); tag != "" {
+			blocked[tag] = true
+		}
+	}
+	return blocked
+}
+
+// checkBlockedTags returns a *BlockedTagError for the first tag that is
+// listed in BLOCKED_TAGS, or nil if none is.
+func checkBlockedTags(tags []string) error {
+	blocked := blockedTags()
+	if len(blocked) == 0 {
+		return nil
+	}
+	for _, tag := range tags {
+		if blocked[normalizeTagName(tag)] {
+			return &BlockedTagError{Tag: tag}
+		}
+	}
+	return nil
+}
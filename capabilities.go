@@ -0,0 +1,169 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"sort"
+
+	"github.com/2Friendly4You/TruthOrDare/apierror"
+)
+
+// capabilitiesMaxAge is how long clients and proxies may cache the
+// capabilities document. Capabilities only change on restart or when
+// languages are added, so a few minutes of staleness is harmless.
+const capabilitiesMaxAge = "300"
+
+// CapabilityLimits lists the request limits enforced by this instance
+// @Description Size limits enforced by the API
+type CapabilityLimits struct {
+	// Largest limit accepted by GET /questions
+	// @example 500
+	MaxPageSize int `json:"maxPageSize"`
+
+	// Most tags accepted in a single filter
+	// @example 100
+	MaxFilterTags int `json:"maxFilterTags"`
+
+	// Largest count accepted by GET /questions/random
+	// @example 50
+	MaxRandomCount int `json:"maxRandomCount"`
+
+	// Largest deck accepted by GET /games/{code}
+	// @example 200
+	MaxGameDeck int `json:"maxGameDeck"`
+
+	// Largest count accepted by GET /export/cards
+	// @example 300
+	MaxCardCount int `json:"maxCardCount"`
+
+	// Largest JSON request body in bytes
+	// @example 65536
+	MaxRequestBodyBytes int `json:"maxRequestBodyBytes"`
+}
+
+// CapabilitiesResponse describes what this deployment supports
+// @Description Features, limits and vocabulary supported by this API instance
+type CapabilitiesResponse struct {
+	// Optional features keyed by name, true when enabled
+	// @example {"debugEndpoints":false,"sanitizeInput":true,"contentFilters":true}
+	Features map[string]bool `json:"features"`
+
+	// Request limits
+	Limits CapabilityLimits `json:"limits"`
+
+	// Formats supported by GET /questions/export
+	// @example ["sql","csv","json"]
+	ExportFormats []string `json:"exportFormats"`
+
+	// Whether creating, updating or deleting questions requires the API key
+	// @example false
+	AuthRequiredForWrites bool `json:"authRequiredForWrites"`
+
+	// Supported question types
+	// @example ["truth","dare"]
+	QuestionTypes []string `json:"questionTypes"`
+
+	// Languages that have at least one question
+	// @example ["de","en"]
+	Languages []string `json:"languages"`
+
+	// Names of the configured content filters, in pipeline order
+	// @example ["banned_words","duplicate"]
+	ContentFilters []string `json:"contentFilters"`
+
+	// Names of the configured presets
+	// @example ["mild-family"]
+	Presets []string `json:"presets"`
+
+	// Question attributes from the attribute schema
+	Attributes AttributeSchema `json:"attributes"`
+}
+
+// featureFlags reports which optional features are enabled, keyed by name.
+func featureFlags() map[string]bool {
+	return map[string]bool{
+		"debugEndpoints": debugEnabled(),
+		"sanitizeInput":  sanitizeEnabled(),
+		"contentFilters": len(db.filters.Names()) > 0,
+		"presets":        len(presets) > 0,
+		"attributes":     len(attributeSchema) > 0,
+		"search":         true,
+		"games":          true,
+		"changeFeed":     true,
+		"recordFixtures": recordingEnabled(),
+		"questionWrites": true,
+		"msgpack":        true,
+		"adminEndpoints": len(apiKeys()) > 0,
+		"blockedTags":    len(blockedTags()) > 0,
+		"cors":           len(corsAllowedOrigins()) > 0,
+		"snapshots":      snapshots != nil,
+		"sync":           upstreamSync != nil,
+		"rateLimit":      rateLimiter != nil,
+		"lazyDBInit":     lazyDBInit(),
+	}
+}
+
+// buildCapabilities assembles the capabilities document from configuration
+// and runtime state.
+func buildCapabilities(languages []string) CapabilitiesResponse {
+	presetNames := make([]string, 0, len(presets))
+	for name := range presets {
+		presetNames = append(presetNames, name)
+	}
+	sort.Strings(presetNames)
+
+	filterNames := db.filters.Names()
+	attributes := attributeSchema
+	if attributes == nil {
+		attributes = AttributeSchema{}
+	}
+
+	return CapabilitiesResponse{
+		Features: featureFlags(),
+		Limits: CapabilityLimits{
+			MaxPageSize:         maxQuestionsLimit,
+			MaxFilterTags:       maxFilterTags,
+			MaxRandomCount:      maxRandomCount,
+			MaxGameDeck:         maxGameDeck,
+			MaxCardCount:        maxCardCount,
+			MaxRequestBodyBytes: maxRequestBodySize,
+		},
+		ExportFormats:         []string{"sql", "csv", "json"},
+		AuthRequiredForWrites: true,
+		QuestionTypes:         []string{"truth", "dare"},
+		Languages:             languages,
+		ContentFilters:        filterNames,
+		Presets:               presetNames,
+		Attributes:            attributes,
+	}
+}
+
+// @Summary Describe instance capabilities
+// @Description Report which optional features are enabled on this instance, the limits it enforces and the question vocabulary it serves, so clients can adapt their UI without probing endpoints. The response may be cached for five minutes.
+// @Tags meta
+// @Produce json
+// @Success 200 {object} CapabilitiesResponse "Instance capabilities"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /capabilities [get]
+func getCapabilities(w http.ResponseWriter, r *http.Request) {
+	languages, err := db.GetLanguages(r.Context())
+	if err != nil {
+		log.Printf("Failed to fetch languages: %v", err)
+		respondError(w, err, "Failed to fetch capabilities")
+		return
+	}
+
+	w.Header().Set("Cache-Control", "public, max-age="+capabilitiesMaxAge)
+	respondJSON(w, http.StatusOK, buildCapabilities(languages))
+}
+
+// @Summary List error codes
+// @Description Return the catalog of machine-readable error codes the API can return, with the HTTP status each one is sent with. Every error response carries one of these codes.
+// @Tags meta
+// @Produce json
+// @Success 200 {array} apierror.Entry "Error code catalog"
+// @Router /errors [get]
+func getErrorCatalog(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age="+capabilitiesMaxAge)
+	respondJSON(w, http.StatusOK, apierror.Catalog())
+}
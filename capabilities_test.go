@@ -0,0 +1,265 @@
+package main
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// capabilityEnv lists every environment variable featureFlags depends on,
+// directly or through the startup loaders.
+var capabilityEnv = []string{
+	"DEBUG_ENDPOINTS", "SANITIZE_INPUT", "CONTENT_FILTERS", "BANNED_WORDS",
+	"PRESETS_FILE", "ATTRIBUTE_SCHEMA_FILE", "RECORD_FIXTURES_DIR", "APP_ENV", "API_KEY",
+	"API_KEYS", "BLOCKED_TAGS", "CORS_ALLOWED_ORIGINS", "EXPORT_DIR",
+	"EXPORT_S3_BUCKET", "SYNC_UPSTREAM_URL", "RATE_LIMIT_RPS", "LAZY_DB_INIT",
+}
+
+// loadCapabilityConfig runs the startup loaders against the current
+// environment, as main does, and restores the globals they set when the test
+// ends.
+func loadCapabilityConfig(t *testing.T) {
+	t.Helper()
+
+	savedPresets, savedSchema := presets, attributeSchema
+	savedSnapshots, savedSync, savedLimiter := snapshots, upstreamSync, rateLimiter
+	t.Cleanup(func() {
+		presets, attributeSchema = savedPresets, savedSchema
+		snapshots, upstreamSync, rateLimiter = savedSnapshots, savedSync, savedLimiter
+	})
+
+	var err error
+	if presets, err = loadPresets(); err != nil {
+		t.Fatal(err)
+	}
+	if attributeSchema, err = loadAttributeSchema(); err != nil {
+		t.Fatal(err)
+	}
+	if snapshots, err = loadSnapshotter(db); err != nil {
+		t.Fatal(err)
+	}
+	if upstreamSync, err = loadSyncer(db); err != nil {
+		t.Fatal(err)
+	}
+	if rateLimiter, err = loadRateLimiter(); err != nil {
+		t.Fatal(err)
+	}
+	filters, err := loadContentFilters(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetContentFilters(filters)
+}
+
+// writeConfigFile writes content to a file in a temporary directory and
+// returns its path.
+func writeConfigFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestBuildCapabilities(t *testing.T) {
+	tests := []struct {
+		name    string
+		feature string
+		env     func(t *testing.T) map[string]string
+		check   func(t *testing.T, c CapabilitiesResponse)
+	}{
+		{
+			name:    "debug endpoints",
+			feature: "debugEndpoints",
+			env:     func(*testing.T) map[string]string { return map[string]string{"DEBUG_ENDPOINTS": "true"} },
+		},
+		{
+			name:    "sanitize input",
+			feature: "sanitizeInput",
+			env:     func(*testing.T) map[string]string { return map[string]string{"SANITIZE_INPUT": "true"} },
+		},
+		{
+			name:    "content filters",
+			feature: "contentFilters",
+			env: func(*testing.T) map[string]string {
+				return map[string]string{"CONTENT_FILTERS": "banned_words:closed,duplicate", "BANNED_WORDS": "darn"}
+			},
+			check: func(t *testing.T, c CapabilitiesResponse) {
+				if want := []string{"banned_words", "duplicate"}; !reflect.DeepEqual(c.ContentFilters, want) {
+					t.Errorf("ContentFilters = %v, want %v", c.ContentFilters, want)
+				}
+			},
+		},
+		{
+			name:    "presets",
+			feature: "presets",
+			env: func(t *testing.T) map[string]string {
+				path := writeConfigFile(t, "presets.json",
+					`{"wild":{"language":"en","truths":5,"dares":5},"mild-family":{"language":"EN","truths":10,"dares":0}}`)
+				return map[string]string{"PRESETS_FILE": path}
+			},
+			check: func(t *testing.T, c CapabilitiesResponse) {
+				if want := []string{"mild-family", "wild"}; !reflect.DeepEqual(c.Presets, want) {
+					t.Errorf("Presets = %v, want %v", c.Presets, want)
+				}
+			},
+		},
+		{
+			name:    "attributes",
+			feature: "attributes",
+			env: func(t *testing.T) map[string]string {
+				path := writeConfigFile(t, "attributes.json", `{"intensity":{"type":"number"}}`)
+				return map[string]string{"ATTRIBUTE_SCHEMA_FILE": path}
+			},
+			check: func(t *testing.T, c CapabilitiesResponse) {
+				if def, ok := c.Attributes["intensity"]; !ok || def.Type != AttributeNumber {
+					t.Errorf("Attributes = %v, want intensity as a number", c.Attributes)
+				}
+			},
+		},
+		{
+			name:    "record fixtures",
+			feature: "recordFixtures",
+			env:     func(t *testing.T) map[string]string { return map[string]string{"RECORD_FIXTURES_DIR": t.TempDir()} },
+		},
+		{
+			name:    "single API key",
+			feature: "adminEndpoints",
+			env:     func(*testing.T) map[string]string { return map[string]string{"API_KEY": "secret"} },
+		},
+		{
+			name:    "named API keys",
+			feature: "adminEndpoints",
+			env:     func(*testing.T) map[string]string { return map[string]string{"API_KEYS": "ops:secret"} },
+		},
+		{
+			name:    "blocked tags",
+			feature: "blockedTags",
+			env:     func(*testing.T) map[string]string { return map[string]string{"BLOCKED_TAGS": "nsfw"} },
+		},
+		{
+			name:    "cors",
+			feature: "cors",
+			env: func(*testing.T) map[string]string {
+				return map[string]string{"CORS_ALLOWED_ORIGINS": "https://example.com"}
+			},
+		},
+		{
+			name:    "snapshots",
+			feature: "snapshots",
+			env:     func(t *testing.T) map[string]string { return map[string]string{"EXPORT_DIR": t.TempDir()} },
+		},
+		{
+			name:    "sync",
+			feature: "sync",
+			env: func(*testing.T) map[string]string {
+				return map[string]string{"SYNC_UPSTREAM_URL": "https://upstream.example.com"}
+			},
+		},
+		{
+			name:    "rate limit",
+			feature: "rateLimit",
+			env:     func(*testing.T) map[string]string { return map[string]string{"RATE_LIMIT_RPS": "5"} },
+		},
+		{
+			name:    "lazy database init",
+			feature: "lazyDBInit",
+			env:     func(*testing.T) map[string]string { return map[string]string{"LAZY_DB_INIT": "true"} },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useMockDB(t)
+			for _, key := range capabilityEnv {
+				t.Setenv(key, "")
+			}
+
+			loadCapabilityConfig(t)
+			before := buildCapabilities(nil)
+			if before.Features[tt.feature] {
+				t.Fatalf("feature %s enabled without configuration", tt.feature)
+			}
+
+			for key, value := range tt.env(t) {
+				t.Setenv(key, value)
+			}
+			loadCapabilityConfig(t)
+			after := buildCapabilities([]string{"en"})
+
+			for name, enabled := range after.Features {
+				want := before.Features[name] || name == tt.feature
+				if enabled != want {
+					t.Errorf("feature %s = %v, want %v", name, enabled, want)
+				}
+			}
+			if !reflect.DeepEqual(after.Languages, []string{"en"}) {
+				t.Errorf("Languages = %v, want [en]", after.Languages)
+			}
+			if tt.check != nil {
+				tt.check(t, after)
+			}
+		})
+	}
+}
+
+func TestBuildCapabilitiesDefaults(t *testing.T) {
+	useMockDB(t)
+	for _, key := range capabilityEnv {
+		t.Setenv(key, "")
+	}
+	loadCapabilityConfig(t)
+
+	c := buildCapabilities([]string{})
+	if c.ContentFilters == nil || len(c.ContentFilters) != 0 {
+		t.Errorf("ContentFilters = %#v, want an empty list", c.ContentFilters)
+	}
+	if c.Presets == nil || len(c.Presets) != 0 {
+		t.Errorf("Presets = %#v, want an empty list", c.Presets)
+	}
+	if c.Attributes == nil || len(c.Attributes) != 0 {
+		t.Errorf("Attributes = %#v, want an empty schema", c.Attributes)
+	}
+	for _, name := range []string{"search", "games", "changeFeed", "questionWrites", "msgpack"} {
+		if !c.Features[name] {
+			t.Errorf("feature %s disabled, want it always on", name)
+		}
+	}
+	if c.Limits.MaxPageSize != maxQuestionsLimit || c.Limits.MaxRequestBodyBytes != maxRequestBodySize {
+		t.Errorf("Limits = %+v", c.Limits)
+	}
+}
+
+func TestGetCapabilities(t *testing.T) {
+	mock := useMockDB(t)
+	mock.Query = func(query string, args []driver.Value) (*MockRows, error) {
+		return &MockRows{
+			Columns: []string{"language"},
+			Values:  [][]driver.Value{{"de"}, {"en"}},
+		}, nil
+	}
+
+	r := httptest.NewRequest("GET", "/api/capabilities", nil)
+	w := httptest.NewRecorder()
+	getCapabilities(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", w.Code, w.Body)
+	}
+	if got, want := w.Header().Get("Cache-Control"), "public, max-age="+capabilitiesMaxAge; got != want {
+		t.Errorf("Cache-Control = %q, want %q", got, want)
+	}
+	var c CapabilitiesResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &c); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"de", "en"}; !reflect.DeepEqual(c.Languages, want) {
+		t.Errorf("Languages = %v, want %v", c.Languages, want)
+	}
+}
@@ -0,0 +1,349 @@
+package main
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/2Friendly4You/TruthOrDare/apierror"
+	"github.com/go-pdf/fpdf"
+)
+
+const (
+	// defaultCardCount and maxCardCount bound the count parameter of GET
+	// /export/cards; 60 cards fill ten A4 pages.
+	defaultCardCount = 60
+	maxCardCount     = 300
+
+	// cardsTimeout bounds selecting the questions of a card sheet.
+	cardsTimeout = 10 * time.Second
+)
+
+// Noto Sans covers the Latin, Greek and Cyrillic scripts of the catalog.
+// The PDF embeds only the glyphs a sheet uses. See fonts/OFL.txt for the
+// license.
+var (
+	//go:embed fonts/NotoSans-Regular.ttf
+	notoSansRegular []byte
+
+	//go:embed fonts/NotoSans-Bold.ttf
+	notoSansBold []byte
+)
+
+// cardSheet is the data rendered by cardSheetTemplate and cardSheetPDF.
+type cardSheet struct {
+	Language string
+	Types    map[string]string
+	Cards    []Question
+
+	// Created is the creation date written into the PDF.
+	Created time.Time
+}
+
+// cardSheetTemplate lays questions out as cut-out cards, six per A4 page
+// when printed. Fonts come from the reader's system; the stack prefers Noto,
+// which covers every script the catalog uses.
+var cardSheetTemplate = template.Must(template.New("cards").Parse(`<!DOCTYPE html>
+<html lang="{{.Language}}">
+<head>
+<meta charset="utf-8">
+<title>Truth or Dare cards</title>
+<style>
+@page { size: A4; margin: 10mm; }
+body { margin: 0; font-family: "Noto Sans", "Noto Sans CJK SC", "Noto Sans Arabic", "Segoe UI", Arial, sans-serif; }
+.sheet { display: grid; grid-template-columns: repeat(2, 1fr); gap: 0; }
+.card { box-sizing: border-box; height: 92mm; padding: 8mm; border: 1px dashed #999; display: flex; flex-direction: column; break-inside: avoid; }
+.card:nth-child(6n) { break-after: page; }
+.type { font-size: 9pt; font-weight: bold; letter-spacing: 0.1em; text-transform: uppercase; }
+.truth .type { color: #1f5fa8; }
+.dare .type { color: #b3261e; }
+.task { flex: 1; display: flex; align-items: center; font-size: 15pt; line-height: 1.35; }
+.target { font-size: 10pt; font-style: italic; }
+.tags { font-size: 8pt; color: #666; }
+</style>
+</head>
+<body>
+<div class="sheet">
+{{- range .Cards}}
+<div class="card {{.Type}}">
+<div class="type">{{index $.Types .Type}}</div>
+<div class="task">{{.Task}}</div>
+{{- if .DareTarget}}
+<div class="target">{{.DareTarget}}</div>
+{{- end}}
+{{- if .Tags}}
+<div class="tags">{{range $i, $tag := .Tags}}{{if $i}} · {{end}}{{$tag}}{{end}}</div>
+{{- end}}
+</div>
+{{- end}}
+</div>
+</body>
+</html>
+`))
+
+// Layout of a PDF card sheet in millimetres: six cards per A4 page in two
+// columns, matching the printed HTML sheet.
+const (
+	cardPageMargin = 10.0
+	cardColumns    = 2
+	cardRows       = 3
+	cardPadding    = 8.0
+
+	// cardMaxFontSize and cardMinFontSize bound the task text, which is
+	// shrunk until it fits its card.
+	cardMaxFontSize = 15.0
+	cardMinFontSize = 8.0
+
+	// cardMaxFooterLines caps the lines of the tags and of the dare target
+	// so they always leave room for the task.
+	cardMaxFooterLines = 2
+)
+
+// cardTypeColors are the RGB colors of the type label per question type.
+var cardTypeColors = map[string][3]int{
+	"truth": {31, 95, 168},
+	"dare":  {179, 38, 30},
+}
+
+// cardSheetPDF lays the cards of sheet out as cut-out cards with dashed
+// borders, six per A4 page. Errors are collected by the returned document;
+// check its Error before writing it.
+func cardSheetPDF(sheet cardSheet) *fpdf.Fpdf {
+	pdf := fpdf.New("P", "mm", "A4", "")
+	pdf.AddUTF8FontFromBytes("NotoSans", "", notoSansRegular)
+	pdf.AddUTF8FontFromBytes("NotoSans", "B", notoSansBold)
+	pdf.SetTitle("Truth or Dare cards", true)
+	pdf.SetLang(sheet.Language)
+	pdf.SetCreationDate(sheet.Created)
+	pdf.SetModificationDate(sheet.Created)
+	pdf.SetCatalogSort(true)
+	pdf.SetAutoPageBreak(false, 0)
+	pdf.SetCellMargin(0)
+
+	pageWidth, pageHeight := pdf.GetPageSize()
+	cardWidth := (pageWidth - 2*cardPageMargin) / cardColumns
+	cardHeight := (pageHeight - 2*cardPageMargin) / cardRows
+
+	for i, card := range sheet.Cards {
+		slot := i % (cardColumns * cardRows)
+		if slot == 0 {
+			pdf.AddPage()
+		}
+		x := cardPageMargin + float64(slot%cardColumns)*cardWidth
+		y := cardPageMargin + float64(slot/cardColumns)*cardHeight
+		drawCard(pdf, card, sheet.Types[card.Type], x, y, cardWidth, cardHeight)
+	}
+	return pdf
+}
+
+// drawCard draws one card with its top left corner at x, y: the type label
+// at the top, the task centered in the middle, and the dare target and tags
+// at the bottom.
+func drawCard(pdf *fpdf.Fpdf, card Question, label string, x, y, width, height float64) {
+	pdf.SetDrawColor(153, 153, 153)
+	pdf.SetLineWidth(0.2)
+	pdf.SetDashPattern([]float64{2, 1.5}, 0)
+	pdf.Rect(x, y, width, height, "D")
+	pdf.SetDashPattern(nil, 0)
+
+	innerWidth := width - 2*cardPadding
+	top := y + cardPadding
+	bottom := y + height - cardPadding
+
+	color := cardTypeColors[card.Type]
+	pdf.SetTextColor(color[0], color[1], color[2])
+	pdf.SetFont("NotoSans", "B", 9)
+	pdf.SetXY(x+cardPadding, top)
+	pdf.CellFormat(innerWidth, 5, strings.ToUpper(label), "", 0, "L", false, 0, "")
+	top += 8
+
+	// The footer is laid out from the bottom up.
+	pdf.SetTextColor(102, 102, 102)
+	if len(card.Tags) > 0 {
+		pdf.SetFont("NotoSans", "", 8)
+		lines := truncateLines(pdf, pdf.SplitText(strings.Join(card.Tags, " · "), innerWidth), cardMaxFooterLines, innerWidth)
+		bottom = drawLinesUp(pdf, lines, x+cardPadding, bottom, innerWidth, 4)
+	}
+	if card.DareTarget != nil {
+		pdf.SetTextColor(0, 0, 0)
+		pdf.SetFont("NotoSans", "", 10)
+		lines := truncateLines(pdf, pdf.SplitText(*card.DareTarget, innerWidth), cardMaxFooterLines, innerWidth)
+		bottom = drawLinesUp(pdf, lines, x+cardPadding, bottom-1, innerWidth, 5)
+	}
+
+	pdf.SetTextColor(0, 0, 0)
+	size, lines := fitCardText(pdf, card.Task, innerWidth, bottom-top-2)
+	lineHeight := cardLineHeight(size)
+	pdf.SetY(top + (bottom-top-float64(len(lines))*lineHeight)/2)
+	for _, line := range lines {
+		pdf.SetX(x + cardPadding)
+		pdf.CellFormat(innerWidth, lineHeight, line, "", 2, "L", false, 0, "")
+	}
+}
+
+// cardLineHeight returns the line height in millimetres of task text set in
+// size points.
+func cardLineHeight(size float64) float64 {
+	const mmPerPoint = 25.4 / 72
+	return size * mmPerPoint * 1.35
+}
+
+// drawLinesUp draws lines so the last one ends at bottom and returns the
+// top of the first one.
+func drawLinesUp(pdf *fpdf.Fpdf, lines []string, x, bottom, width, lineHeight float64) float64 {
+	top := bottom - float64(len(lines))*lineHeight
+	pdf.SetXY(x, top)
+	for _, line := range lines {
+		pdf.SetX(x)
+		pdf.CellFormat(width, lineHeight, line, "", 2, "L", false, 0, "")
+	}
+	return top
+}
+
+// fitCardText selects the largest font size between cardMaxFontSize and
+// cardMinFontSize at which text fits into width and height, and returns it
+// with the wrapped lines. Text that does not fit even at the smallest size
+// is cut off with an ellipsis.
+func fitCardText(pdf *fpdf.Fpdf, text string, width, height float64) (float64, []string) {
+	size := cardMaxFontSize
+	for {
+		pdf.SetFont("NotoSans", "", size)
+		lines := pdf.SplitText(text, width)
+		fit := int(height / cardLineHeight(size))
+		if len(lines) <= fit {
+			return size, lines
+		}
+		if size <= cardMinFontSize {
+			return size, truncateLines(pdf, lines, fit, width)
+		}
+		size--
+	}
+}
+
+// truncateLines returns at most limit lines (at least one), ending the last
+// one with an ellipsis that fits into width if lines had to be dropped.
+func truncateLines(pdf *fpdf.Fpdf, lines []string, limit int, width float64) []string {
+	if limit < 1 {
+		limit = 1
+	}
+	if len(lines) <= limit {
+		return lines
+	}
+	lines = append([]string(nil), lines[:limit]...)
+	last := []rune(lines[limit-1])
+	for len(last) > 0 && pdf.GetStringWidth(string(last)+"…") > width {
+		last = last[:len(last)-1]
+	}
+	lines[limit-1] = strings.TrimRight(string(last), " ") + "…"
+	return lines
+}
+
+// @Summary Print question cards
+// @Description Render randomly selected questions as a sheet of cut-out cards showing each question's type, task, dare target and tags, six cards per A4 page. The default is a PDF with an embedded Noto Sans font covering the catalog's Latin, Greek and Cyrillic scripts; format=html returns the same layout as printable HTML. With a seed the selection and order are deterministic, so a deck can be reprinted consistently.
+// @Tags questions
+// @Produce application/pdf
+// @Produce html
+// @Param language query string false "ISO 639-1 language code filter; also selects the card labels" example(en)
+// @Param type query string false "Question type filter" Enums(truth, dare)
+// @Param tags query []string false "Filter questions by tags (comma-separated); a trailing * matches every tag with that prefix" example(funny,party,social)
+// @Param excludeTags query []string false "Leave out questions carrying any of these tags (comma-separated); a trailing * matches every tag with that prefix" example(nsfw,alcohol)
+// @Param matchAllTags query boolean false "Require all specified tags to match (true) or any tag (false)" default(false)
+// @Param count query integer false "Number of cards (max 300)" default(60)
+// @Param seed query integer false "Seed for a reproducible selection and order"
+// @Param format query string false "Output format" Enums(pdf, html) default(pdf)
+// @Success 200 {file} file "Card sheet as PDF or printable HTML"
+// @Failure 400 {object} ErrorResponse "Invalid request parameters"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Failure 504 {object} ErrorResponse "Selecting the questions timed out"
+// @Router /export/cards [get]
+func exportCards(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "pdf"
+	}
+	if format != "pdf" && format != "html" {
+		writeError(w, apierror.InvalidParam, "format must be \"pdf\" or \"html\"")
+		return
+	}
+
+	filters, err := ParseFilterSet(r.URL.Query())
+	if err != nil {
+		respondError(w, err, "Invalid filters")
+		return
+	}
+
+	count := defaultCardCount
+	if raw := r.URL.Query().Get("count"); raw != "" {
+		count, err = strconv.Atoi(raw)
+		if err != nil || count < 1 || count > maxCardCount {
+			writeError(w, apierror.InvalidParam, fmt.Sprintf("count must be an integer between 1 and %d", maxCardCount))
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), cardsTimeout)
+	defer cancel()
+
+	var cards []Question
+	// A seeded sheet carries a fixed creation date so that identical
+	// requests produce identical files.
+	created := time.Now()
+	if raw := r.URL.Query().Get("seed"); raw != "" {
+		seed, parseErr := strconv.ParseInt(raw, 10, 64)
+		if parseErr != nil {
+			writeError(w, apierror.InvalidParam, "seed must be an integer")
+			return
+		}
+		cards, err = db.GetSeededQuestions(ctx, filters, seed, count)
+		created = time.Unix(0, 0).UTC()
+	} else {
+		cards, err = db.GetRandomQuestions(ctx, filters, count)
+	}
+	if errors.Is(err, context.Canceled) {
+		log.Printf("Client went away while selecting cards")
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to select cards: %v", err)
+		respondError(w, err, "Failed to build card sheet")
+		return
+	}
+
+	language := filters.Language
+	if language == "" {
+		language = fallbackLocale
+	}
+	sheet := cardSheet{Language: language, Types: typeLabelsFor(language), Cards: cards, Created: created}
+
+	if format == "html" {
+		// The template writes straight to the response, so the sheet
+		// streams out card by card; an error half way can only be logged.
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Content-Disposition", `inline; filename="cards.html"`)
+		if err := cardSheetTemplate.Execute(w, sheet); err != nil {
+			log.Printf("Failed to render card sheet: %v", err)
+		}
+		return
+	}
+
+	// The PDF references byte offsets of its objects, so it is laid out in
+	// memory, bounded by maxCardCount, and written in one go.
+	pdf := cardSheetPDF(sheet)
+	if err := pdf.Error(); err != nil {
+		log.Printf("Failed to render card sheet: %v", err)
+		writeError(w, apierror.Internal, "Failed to build card sheet")
+		return
+	}
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", `inline; filename="cards.pdf"`)
+	if err := pdf.Output(w); err != nil {
+		log.Printf("Failed to write card sheet: %v", err)
+	}
+}
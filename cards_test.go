@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sampleCardSheet returns a sheet of n cards mixing scripts, a dare target
+// and a task too long for its card.
+func sampleCardSheet(n int) cardSheet {
+	target := "Die Person links von dir"
+	tasks := []Question{
+		{Type: "truth", Task: "Was ist deine größte Angst?", Tags: []string{"deep", "über"}},
+		{Type: "dare", Task: "Chante une chanson à voix haute", DareTarget: &target},
+		{Type: "truth", Task: "Какой твой самый большой страх?"},
+		{Type: "truth", Task: strings.Repeat("What is the longest story you have ever told? ", 40)},
+		{Type: "dare", Task: "Tell a joke", Tags: strings.Fields(strings.Repeat("tag ", 200))},
+	}
+	sheet := cardSheet{Language: "de", Types: typeLabelsFor("de"), Created: time.Unix(0, 0).UTC()}
+	for i := 0; i < n; i++ {
+		sheet.Cards = append(sheet.Cards, tasks[i%len(tasks)])
+	}
+	return sheet
+}
+
+func TestCardSheetPDF(t *testing.T) {
+	tests := []struct {
+		cards     int
+		wantPages int
+	}{
+		{1, 1},
+		{6, 1},
+		{7, 2},
+		{13, 3},
+		{maxCardCount, maxCardCount / 6},
+	}
+	for _, tt := range tests {
+		pdf := cardSheetPDF(sampleCardSheet(tt.cards))
+		if err := pdf.Error(); err != nil {
+			t.Fatalf("%d cards: %v", tt.cards, err)
+		}
+		if got := pdf.PageCount(); got != tt.wantPages {
+			t.Errorf("%d cards: %d pages, want %d", tt.cards, got, tt.wantPages)
+		}
+	}
+}
+
+func TestCardSheetPDFEmbedsFontSubset(t *testing.T) {
+	var out bytes.Buffer
+	if err := cardSheetPDF(sampleCardSheet(4)).Output(&out); err != nil {
+		t.Fatal(err)
+	}
+	pdf := out.Bytes()
+	if !bytes.HasPrefix(pdf, []byte("%PDF-")) {
+		t.Fatalf("output is not a PDF: %q", pdf[:16])
+	}
+	if !bytes.Contains(pdf, []byte("/FontFile2")) {
+		t.Error("font is not embedded")
+	}
+	if !bytes.Contains(bytes.ToLower(pdf), []byte("notosans")) {
+		t.Error("Noto Sans is not used")
+	}
+	// The sheet only embeds the glyphs it uses.
+	if max := len(notoSansRegular) + len(notoSansBold); out.Len() >= max/2 {
+		t.Errorf("PDF is %d bytes; the fonts were not subset", out.Len())
+	}
+}
+
+func TestCardSheetPDFIsDeterministic(t *testing.T) {
+	var first, second bytes.Buffer
+	if err := cardSheetPDF(sampleCardSheet(8)).Output(&first); err != nil {
+		t.Fatal(err)
+	}
+	if err := cardSheetPDF(sampleCardSheet(8)).Output(&second); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(first.Bytes(), second.Bytes()) {
+		t.Error("identical sheets produced different PDFs")
+	}
+}
+
+func TestFitCardText(t *testing.T) {
+	pdf := cardSheetPDF(cardSheet{})
+	pdf.AddPage()
+
+	size, lines := fitCardText(pdf, "What is your biggest fear?", 79, 50)
+	if size != cardMaxFontSize || len(lines) != 1 {
+		t.Errorf("short task: size %v, %d lines, want %v and 1", size, len(lines), cardMaxFontSize)
+	}
+
+	size, lines = fitCardText(pdf, strings.Repeat("word ", 1000), 79, 50)
+	if size != cardMinFontSize {
+		t.Errorf("long task: size %v, want %v", size, cardMinFontSize)
+	}
+	if last := lines[len(lines)-1]; !strings.HasSuffix(last, "…") {
+		t.Errorf("long task: last line %q is not cut off with an ellipsis", last)
+	}
+}
+
+func TestExportCards(t *testing.T) {
+	tests := []struct {
+		query           string
+		wantStatus      int
+		wantContentType string
+	}{
+		{"", http.StatusOK, "application/pdf"},
+		{"format=pdf&seed=42&count=7", http.StatusOK, "application/pdf"},
+		{"format=html", http.StatusOK, "text/html; charset=utf-8"},
+		{"format=docx", http.StatusBadRequest, "application/json"},
+		{"count=301", http.StatusBadRequest, "application/json"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			mock := useMockDB(t)
+			mock.Query = func(string, []driver.Value) (*MockRows, error) {
+				return questionRows("funny", "party"), nil
+			}
+
+			w := httptest.NewRecorder()
+			exportCards(w, httptest.NewRequest("GET", "/api/export/cards?"+tt.query, nil))
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d, body %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if got := w.Header().Get("Content-Type"); !strings.HasPrefix(got, tt.wantContentType) {
+				t.Errorf("Content-Type = %q, want %q", got, tt.wantContentType)
+			}
+		})
+	}
+}
+
+func TestExportCardsSeededIsReproducible(t *testing.T) {
+	mock := useMockDB(t)
+	mock.Query = func(string, []driver.Value) (*MockRows, error) {
+		return questionRows("funny", "party", "deep"), nil
+	}
+
+	var bodies [2][]byte
+	for i := range bodies {
+		w := httptest.NewRecorder()
+		exportCards(w, httptest.NewRequest("GET", "/api/export/cards?seed=7", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, body %s", w.Code, w.Body)
+		}
+		bodies[i] = w.Body.Bytes()
+	}
+	if !bytes.Equal(bodies[0], bodies[1]) {
+		t.Error("identical seeded requests produced different PDFs")
+	}
+}
+
+func TestTruncateLines(t *testing.T) {
+	pdf := cardSheetPDF(cardSheet{})
+	pdf.AddPage()
+	pdf.SetFont("NotoSans", "", 10)
+	lines := []string{"one", "two", "three"}
+
+	if got := truncateLines(pdf, lines, 3, 79); strings.Join(got, "|") != "one|two|three" {
+		t.Errorf("lines that fit were changed: %q", got)
+	}
+	if got := truncateLines(pdf, lines, 2, 79); strings.Join(got, "|") != "one|two…" {
+		t.Errorf("truncateLines(2) = %q", got)
+	}
+	if got := truncateLines(pdf, lines, 0, 79); strings.Join(got, "|") != "one…" {
+		t.Errorf("truncateLines(0) = %q, want one line", got)
+	}
+}
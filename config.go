@@ -0,0 +1,81 @@
+package main
+
+import (
+	"math"
+	"net/http"
+)
+
+// CORSConfigResponse describes the CORS configuration
+// @Description Origins and methods accepted in cross-origin requests
+type CORSConfigResponse struct {
+	// Origins from CORS_ALLOWED_ORIGINS; empty when CORS is disabled
+	// @example ["https://mygame.com"]
+	AllowedOrigins []string `json:"allowed_origins"`
+
+	// Methods allowed in cross-origin requests
+	// @example ["GET","POST","PUT","DELETE","OPTIONS"]
+	AllowedMethods []string `json:"allowed_methods"`
+}
+
+// RateLimitConfigResponse describes the request rate limits
+// @Description Requests per minute allowed per client; 0 means unlimited
+type RateLimitConfigResponse struct {
+	// Requests per minute per client IP to public endpoints
+	// (RATE_LIMIT_RPS × 60)
+	// @example 60
+	GlobalRPM int `json:"global_rpm"`
+
+	// Requests per minute to endpoints that change data. Those require
+	// the API key and are not rate limited, so this is always 0.
+	// @example 0
+	WriteRPM int `json:"write_rpm"`
+
+	// Requests a client may send at once before the rate applies
+	// (RATE_LIMIT_BURST); 0 when unlimited
+	// @example 10
+	Burst int `json:"burst"`
+}
+
+// @Summary Show the CORS configuration
+// @Description Return the origins and methods accepted in cross-origin requests, to debug browser integrations without reading the server environment. Only available with DEBUG_ENDPOINTS=true.
+// @Tags config
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} CORSConfigResponse "CORS configuration"
+// @Failure 401 {object} ErrorResponse "Missing or invalid API key"
+// @Router /config/cors [get]
+func getCORSConfig(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, http.StatusOK, CORSConfigResponse{
+		AllowedOrigins: corsAllowedOrigins(),
+		AllowedMethods: corsAllowedMethods,
+	})
+}
+
+// @Summary Show the rate limits
+// @Description Return the configured request rate limits. Public endpoints are limited per client IP when RATE_LIMIT_RPS is set; all values are 0 otherwise.
+// @Tags config
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} RateLimitConfigResponse "Rate limits"
+// @Failure 401 {object} ErrorResponse "Missing or invalid API key"
+// @Router /config/rate-limits [get]
+func getRateLimitConfig(w http.ResponseWriter, r *http.Request) {
+	var resp RateLimitConfigResponse
+	if rateLimiter != nil {
+		resp.GlobalRPM = int(math.Round(float64(rateLimiter.rps) * 60))
+		resp.Burst = rateLimiter.burst
+	}
+	respondJSON(w, http.StatusOK, resp)
+}
+
+// @Summary Show the feature flags
+// @Description Return every optional feature keyed by name, true when enabled
+// @Tags config
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]bool "Feature flags"
+// @Failure 401 {object} ErrorResponse "Missing or invalid API key"
+// @Router /config/features [get]
+func getFeatureConfig(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, http.StatusOK, featureFlags())
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// defaultFilterTimeout bounds a single content filter check.
+const defaultFilterTimeout = 2 * time.Second
+
+// maxStrayChecks is how many timed-out checks of one filter may still be
+// running before further checks of that filter fail without being started.
+const maxStrayChecks = 4
+
+// Verdict is the outcome of a content filter check.
+type Verdict int
+
+const (
+	// VerdictAccept lets the question through.
+	VerdictAccept Verdict = iota
+	// VerdictFlag lets the question through but marks it for moderation.
+	VerdictFlag
+	// VerdictReject refuses the write.
+	VerdictReject
+)
+
+// FilterResult is returned by ContentFilter.Check.
+type FilterResult struct {
+	Verdict Verdict
+	Reason  string
+}
+
+// ContentFilter inspects a question before it is written.
+type ContentFilter interface {
+	// Name identifies the filter in configuration and moderation records.
+	Name() string
+	// Check returns the filter's verdict on q. An error means the filter
+	// could not decide; the pipeline then applies the filter's FailurePolicy.
+	// Check must return promptly once ctx is done: the pipeline stops
+	// waiting at the timeout, but cannot stop a check that ignores ctx.
+	Check(ctx context.Context, q Question) (FilterResult, error)
+}
+
+// FailurePolicy decides what happens when a filter errors, panics or times
+// out.
+type FailurePolicy string
+
+const (
+	// FailOpen accepts the question as if the filter had not run.
+	FailOpen FailurePolicy = "open"
+	// FailFlag accepts the question but flags it for moderation.
+	FailFlag FailurePolicy = "flag"
+	// FailClosed rejects the question.
+	FailClosed FailurePolicy = "closed"
+)
+
+// ContentFlag records that a filter flagged a question for moderation.
+type ContentFlag struct {
+	Filter string
+	Reason string
+}
+
+// RejectedError is returned by write paths when a content filter rejects a
+// question.
+type RejectedError struct {
+	Filter string
+	Reason string
+}
+
+func (e *RejectedError) Error() string {
+	return fmt.Sprintf("rejected by %s filter: %s", e.Filter, e.Reason)
+}
+
+type pipelineStage struct {
+	filter  ContentFilter
+	policy  FailurePolicy
+	timeout time.Duration
+
+	// stray counts checks that timed out but have not returned yet.
+	stray *atomic.Int32
+}
+
+// FilterPipeline runs content filters in order. The first rejection stops
+// the pipeline; flags from every filter that ran are collected.
+type FilterPipeline struct {
+	stages []pipelineStage
+}
+
+// Add appends filter to the pipeline with the given failure policy.
+func (p *FilterPipeline) Add(filter ContentFilter, policy FailurePolicy) {
+	p.stages = append(p.stages, pipelineStage{filter: filter, policy: policy, timeout: defaultFilterTimeout, stray: new(atomic.Int32)})
+}
+
+// Names returns the names of the filters in pipeline order.
+func (p *FilterPipeline) Names() []string {
+	names := []string{}
+	if p == nil {
+		return names
+	}
+	for _, stage := range p.stages {
+		names = append(names, stage.filter.Name())
+	}
+	return names
+}
+
+// Run checks q against every filter. It returns a *RejectedError if a filter
+// rejected the question, otherwise the flags raised along the way.
+func (p *FilterPipeline) Run(ctx context.Context, q Question) ([]ContentFlag, error) {
+	if p == nil {
+		return nil, nil
+	}
+
+	var flags []ContentFlag
+	for _, stage := range p.stages {
+		result, err := stage.check(ctx, q)
+		if err != nil {
+			log.Printf("Content filter %s failed, applying %s policy: %v", stage.filter.Name(), stage.policy, err)
+			switch stage.policy {
+			case FailClosed:
+				result = FilterResult{Verdict: VerdictReject, Reason: "filter unavailable"}
+			case FailFlag:
+				result = FilterResult{Verdict: VerdictFlag, Reason: "filter unavailable"}
+			default:
+				result = FilterResult{Verdict: VerdictAccept}
+			}
+		}
+
+		switch result.Verdict {
+		case VerdictReject:
+			return flags, &RejectedError{Filter: stage.filter.Name(), Reason: result.Reason}
+		case VerdictFlag:
+			flags = append(flags, ContentFlag{Filter: stage.filter.Name(), Reason: result.Reason})
+		}
+	}
+	return flags, nil
+}
+
+// check runs a single filter, converting panics and timeouts into errors.
+// A check that outlives its timeout keeps running until the filter returns;
+// once maxStrayChecks of them are pending, check fails without starting
+// another, so a filter that hangs cannot pile up goroutines.
+func (s pipelineStage) check(ctx context.Context, q Question) (FilterResult, error) {
+	if s.stray.Load() >= maxStrayChecks {
+		return FilterResult{}, fmt.Errorf("%d earlier checks still running after timing out", maxStrayChecks)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	type outcome struct {
+		result FilterResult
+		err    error
+	}
+	const (
+		running int32 = iota
+		finished
+		abandoned
+	)
+	var state atomic.Int32
+	done := make(chan outcome, 1)
+	go func() {
+		o := outcome{}
+		defer func() {
+			if r := recover(); r != nil {
+				o = outcome{err: fmt.Errorf("panic: %v", r)}
+			}
+			if !state.CompareAndSwap(running, finished) {
+				s.stray.Add(-1)
+			}
+			done <- o
+		}()
+		o.result, o.err = s.filter.Check(ctx, q)
+	}()
+
+	select {
+	case o := <-done:
+		return o.result, o.err
+	case <-ctx.Done():
+		if !state.CompareAndSwap(running, abandoned) {
+			// The filter returned just as the timeout fired.
+			o := <-done
+			return o.result, o.err
+		}
+		s.stray.Add(1)
+		return FilterResult{}, fmt.Errorf("timed out: %w", ctx.Err())
+	}
+}
+
+// BannedWordsFilter rejects questions whose task contains any banned word as
+// a whole word, case-insensitively.
+type BannedWordsFilter struct {
+	pattern *regexp.Regexp
+}
+
+// NewBannedWordsFilter builds a BannedWordsFilter for words. It returns nil
+// when words is empty.
+func NewBannedWordsFilter(words []string) *BannedWordsFilter {
+	quoted := make([]string, 0, len(words))
+	for _, word := range words {
+		if word = strings.TrimSpace(word); word != "" {
+			quoted = append(quoted, regexp.QuoteMeta(word))
+		}
+	}
+	if len(quoted) == 0 {
+		return nil
+	}
+	return &BannedWordsFilter{pattern: regexp.MustCompile(`(?i)\b(` + strings.Join(quoted, "|") + `)\b`)}
+}
+
+// Name implements ContentFilter.
+func (f *BannedWordsFilter) Name() string { return "banned_words" }
+
+// Check implements ContentFilter.
+func (f *BannedWordsFilter) Check(ctx context.Context, q Question) (FilterResult, error) {
+	if match := f.pattern.FindString(q.Task); match != "" {
+		return FilterResult{Verdict: VerdictReject, Reason: fmt.Sprintf("contains banned word %q", match)}, nil
+	}
+	return FilterResult{Verdict: VerdictAccept}, nil
+}
+
+// DuplicateFilter rejects questions whose task already exists in the same
+// language on another question.
+type DuplicateFilter struct {
+	db *Database
+}
+
+// Name implements ContentFilter.
+func (f *DuplicateFilter) Name() string { return "duplicate" }
+
+// Check implements ContentFilter.
+func (f *DuplicateFilter) Check(ctx context.Context, q Question) (FilterResult, error) {
+	exists, err := f.db.TaskExists(ctx, normalizeLanguage(q.Language), q.Task, q.ID)
+	if err != nil {
+		return FilterResult{}, err
+	}
+	if exists {
+		return FilterResult{Verdict: VerdictReject, Reason: "an identical question already exists"}, nil
+	}
+	return FilterResult{Verdict: VerdictAccept}, nil
+}
+
+// loadContentFilters builds the write-path filter pipeline from the
+// CONTENT_FILTERS environment variable, a comma-separated, ordered list of
+// "name" or "name:policy" entries where policy is open, flag or closed
+// (default open). Known filters are banned_words (words from BANNED_WORDS)
+// and duplicate.
+func loadContentFilters(d *Database) (*FilterPipeline, error) {
+	pipeline := &FilterPipeline{}
+
+	for _, entry := range strings.Split(os.Getenv("CONTENT_FILTERS"), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		name, policyName, _ := strings.Cut(entry, ":")
+		policy := FailurePolicy(policyName)
+		switch policy {
+		case "":
+			policy = FailOpen
+		case FailOpen, FailFlag, FailClosed:
+		default:
+			return nil, fmt.Errorf("content filter %q: unknown failure policy %q", name, policyName)
+		}
+
+		switch name {
+		case "banned_words":
+			filter := NewBannedWordsFilter(strings.Split(os.Getenv("BANNED_WORDS"), ","))
+			if filter == nil {
+				return nil, errors.New("content filter banned_words requires BANNED_WORDS")
+			}
+			pipeline.Add(filter, policy)
+		case "duplicate":
+			pipeline.Add(&DuplicateFilter{db: d}, policy)
+		default:
+			return nil, fmt.Errorf("unknown content filter %q", name)
+		}
+	}
+
+	return pipeline, nil
+}
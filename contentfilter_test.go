@@ -0,0 +1,305 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/2Friendly4You/TruthOrDare/apierror"
+)
+
+// stubFilter is a ContentFilter answering with check.
+type stubFilter struct {
+	name  string
+	check func(ctx context.Context, q Question) (FilterResult, error)
+	calls atomic.Int32
+}
+
+func (f *stubFilter) Name() string { return f.name }
+
+func (f *stubFilter) Check(ctx context.Context, q Question) (FilterResult, error) {
+	f.calls.Add(1)
+	return f.check(ctx, q)
+}
+
+// verdictFilter returns a stubFilter that always answers with verdict.
+func verdictFilter(name string, verdict Verdict) *stubFilter {
+	return &stubFilter{name: name, check: func(context.Context, Question) (FilterResult, error) {
+		return FilterResult{Verdict: verdict, Reason: name + " says so"}, nil
+	}}
+}
+
+// failingFilter returns a stubFilter that errors, panics or outlasts a short
+// timeout, depending on how.
+func failingFilter(how string) *stubFilter {
+	return &stubFilter{name: how, check: func(ctx context.Context, q Question) (FilterResult, error) {
+		switch how {
+		case "panic":
+			panic("filter bug")
+		case "timeout":
+			<-ctx.Done()
+			return FilterResult{}, ctx.Err()
+		}
+		return FilterResult{}, errors.New("service unavailable")
+	}}
+}
+
+func TestFilterPipelineRun(t *testing.T) {
+	tests := []struct {
+		name         string
+		filters      []*stubFilter
+		policy       FailurePolicy
+		wantRejectBy string
+		wantFlags    []string
+		wantCalls    []int
+	}{
+		{"accept", []*stubFilter{verdictFilter("a", VerdictAccept), verdictFilter("b", VerdictAccept)}, FailOpen, "", nil, []int{1, 1}},
+		{"flags are collected", []*stubFilter{verdictFilter("a", VerdictFlag), verdictFilter("b", VerdictFlag)}, FailOpen, "", []string{"a", "b"}, []int{1, 1}},
+		{"reject stops the pipeline", []*stubFilter{verdictFilter("a", VerdictFlag), verdictFilter("b", VerdictReject), verdictFilter("c", VerdictAccept)}, FailOpen, "b", []string{"a"}, []int{1, 1, 0}},
+		{"error fails open", []*stubFilter{failingFilter("error"), verdictFilter("b", VerdictAccept)}, FailOpen, "", nil, []int{1, 1}},
+		{"error fails flagged", []*stubFilter{failingFilter("error")}, FailFlag, "", []string{"error"}, []int{1}},
+		{"error fails closed", []*stubFilter{failingFilter("error"), verdictFilter("b", VerdictAccept)}, FailClosed, "error", nil, []int{1, 0}},
+		{"panic fails open", []*stubFilter{failingFilter("panic")}, FailOpen, "", nil, []int{1}},
+		{"panic fails flagged", []*stubFilter{failingFilter("panic")}, FailFlag, "", []string{"panic"}, []int{1}},
+		{"panic fails closed", []*stubFilter{failingFilter("panic")}, FailClosed, "panic", nil, []int{1}},
+		{"timeout fails open", []*stubFilter{failingFilter("timeout")}, FailOpen, "", nil, []int{1}},
+		{"timeout fails flagged", []*stubFilter{failingFilter("timeout")}, FailFlag, "", []string{"timeout"}, []int{1}},
+		{"timeout fails closed", []*stubFilter{failingFilter("timeout")}, FailClosed, "timeout", nil, []int{1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &FilterPipeline{}
+			for _, f := range tt.filters {
+				p.Add(f, tt.policy)
+			}
+			for i := range p.stages {
+				p.stages[i].timeout = 20 * time.Millisecond
+			}
+
+			flags, err := p.Run(context.Background(), Question{Task: "What scares you?"})
+
+			var rejected *RejectedError
+			if tt.wantRejectBy == "" {
+				if err != nil {
+					t.Fatalf("Run() error = %v", err)
+				}
+			} else if !errors.As(err, &rejected) || rejected.Filter != tt.wantRejectBy {
+				t.Fatalf("Run() error = %v, want rejection by %s", err, tt.wantRejectBy)
+			}
+			var flagged []string
+			for _, flag := range flags {
+				flagged = append(flagged, flag.Filter)
+			}
+			if !reflect.DeepEqual(flagged, tt.wantFlags) {
+				t.Errorf("flags from %v, want %v", flagged, tt.wantFlags)
+			}
+			for i, f := range tt.filters {
+				if got := int(f.calls.Load()); got != tt.wantCalls[i] {
+					t.Errorf("filter %s ran %d times, want %d", f.name, got, tt.wantCalls[i])
+				}
+			}
+		})
+	}
+}
+
+func TestFilterPipelineNil(t *testing.T) {
+	var p *FilterPipeline
+	flags, err := p.Run(context.Background(), Question{})
+	if flags != nil || err != nil {
+		t.Errorf("Run() = %v, %v; want nothing", flags, err)
+	}
+	if names := p.Names(); names == nil || len(names) != 0 {
+		t.Errorf("Names() = %#v, want an empty list", names)
+	}
+}
+
+func TestFilterPipelineTimeout(t *testing.T) {
+	p := &FilterPipeline{}
+	p.Add(failingFilter("timeout"), FailClosed)
+	p.stages[0].timeout = 10 * time.Millisecond
+
+	start := time.Now()
+	_, err := p.stages[0].check(context.Background(), Question{})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("check() error = %v, want a deadline error", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("check() took %v with a 10ms timeout", elapsed)
+	}
+}
+
+// TestFilterPipelineLimitsStrayChecks checks that a filter ignoring ctx can
+// only leave maxStrayChecks goroutines behind.
+func TestFilterPipelineLimitsStrayChecks(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{}, maxStrayChecks+1)
+	hang := &stubFilter{name: "hang", check: func(context.Context, Question) (FilterResult, error) {
+		started <- struct{}{}
+		<-release
+		return FilterResult{Verdict: VerdictAccept}, nil
+	}}
+	p := &FilterPipeline{}
+	p.Add(hang, FailClosed)
+	stage := p.stages[0]
+	stage.timeout = 5 * time.Millisecond
+
+	for i := 0; i < maxStrayChecks; i++ {
+		if _, err := stage.check(context.Background(), Question{}); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("check %d error = %v, want a deadline error", i, err)
+		}
+	}
+	if got := stage.stray.Load(); got != maxStrayChecks {
+		t.Fatalf("stray checks = %d, want %d", got, maxStrayChecks)
+	}
+
+	if _, err := stage.check(context.Background(), Question{}); err == nil || errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("check error = %v, want an immediate failure", err)
+	}
+	if len(started) != maxStrayChecks {
+		t.Errorf("filter started %d times, want %d", len(started), maxStrayChecks)
+	}
+
+	close(release)
+	deadline := time.Now().Add(5 * time.Second)
+	for stage.stray.Load() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("stray checks = %d after the filter returned", stage.stray.Load())
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	stage.timeout = time.Second
+	if result, err := stage.check(context.Background(), Question{}); err != nil || result.Verdict != VerdictAccept {
+		t.Errorf("check() = %+v, %v after stray checks finished", result, err)
+	}
+}
+
+func TestBannedWordsFilter(t *testing.T) {
+	f := NewBannedWordsFilter([]string{" darn ", "", "f.o"})
+
+	tests := []struct {
+		task      string
+		wantMatch string
+	}{
+		{"Darn it, what now?", "Darn"},
+		{"Say DARN loudly", "DARN"},
+		{"end with darn", "darn"},
+		{"Darned socks are fine", ""},
+		{"undarn is not a word", ""},
+		{"f.o is literal", "f.o"},
+		{"fxo is not f.o", "f.o"},
+		{"fxo alone", ""},
+		{"nothing here", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.task, func(t *testing.T) {
+			result, err := f.Check(context.Background(), Question{Task: tt.task})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantMatch == "" {
+				if result.Verdict != VerdictAccept {
+					t.Errorf("verdict = %v (%s), want accept", result.Verdict, result.Reason)
+				}
+				return
+			}
+			if result.Verdict != VerdictReject || !strings.Contains(result.Reason, `"`+tt.wantMatch+`"`) {
+				t.Errorf("result = %+v, want rejection for %q", result, tt.wantMatch)
+			}
+		})
+	}
+}
+
+func TestNewBannedWordsFilterWithoutWords(t *testing.T) {
+	for _, words := range [][]string{nil, {""}, {" ", ""}} {
+		if f := NewBannedWordsFilter(words); f != nil {
+			t.Errorf("NewBannedWordsFilter(%q) = %v, want nil", words, f)
+		}
+	}
+}
+
+func TestLoadContentFilters(t *testing.T) {
+	tests := []struct {
+		filters      string
+		bannedWords  string
+		wantNames    []string
+		wantPolicies []FailurePolicy
+		wantErr      string
+	}{
+		{"", "", []string{}, nil, ""},
+		{"banned_words", "darn", []string{"banned_words"}, []FailurePolicy{FailOpen}, ""},
+		{" banned_words:closed , duplicate:flag ,", "darn", []string{"banned_words", "duplicate"}, []FailurePolicy{FailClosed, FailFlag}, ""},
+		{"duplicate:open", "", []string{"duplicate"}, []FailurePolicy{FailOpen}, ""},
+		{"banned_words", "", nil, nil, "requires BANNED_WORDS"},
+		{"duplicate:sometimes", "", nil, nil, "unknown failure policy"},
+		{"profanity", "", nil, nil, "unknown content filter"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.filters, func(t *testing.T) {
+			t.Setenv("CONTENT_FILTERS", tt.filters)
+			t.Setenv("BANNED_WORDS", tt.bannedWords)
+
+			p, err := loadContentFilters(&Database{})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("loadContentFilters() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("loadContentFilters() error = %v", err)
+			}
+			if !reflect.DeepEqual(p.Names(), tt.wantNames) {
+				t.Errorf("names = %v, want %v", p.Names(), tt.wantNames)
+			}
+			var policies []FailurePolicy
+			for _, stage := range p.stages {
+				policies = append(policies, stage.policy)
+				if stage.timeout != defaultFilterTimeout {
+					t.Errorf("%s timeout = %v, want %v", stage.filter.Name(), stage.timeout, defaultFilterTimeout)
+				}
+			}
+			if !reflect.DeepEqual(policies, tt.wantPolicies) {
+				t.Errorf("policies = %v, want %v", policies, tt.wantPolicies)
+			}
+		})
+	}
+}
+
+func TestRejectedQuestionIsNotWritten(t *testing.T) {
+	mock := useMockDB(t)
+	p := &FilterPipeline{}
+	p.Add(NewBannedWordsFilter([]string{"darn"}), FailOpen)
+	db.SetContentFilters(p)
+
+	body := `{"language": "en", "type": "truth", "task": "Darn, what scares you?"}`
+	r := httptest.NewRequest("POST", "/api/questions", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	createQuestion(w, r)
+
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("status = %d, want 422, body %s", w.Code, w.Body)
+	}
+	var resp ErrorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Code != string(apierror.ContentRejected) {
+		t.Errorf("code = %s, want %s", resp.Code, apierror.ContentRejected)
+	}
+	if !strings.Contains(resp.Message, "banned_words") {
+		t.Errorf("message %q does not name the filter", resp.Message)
+	}
+	for _, statement := range mock.Statements() {
+		if strings.HasPrefix(strings.TrimSpace(statement), "INSERT") {
+			t.Errorf("rejected question was written: %s", statement)
+		}
+	}
+}
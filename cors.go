@@ -0,0 +1,62 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"strings"
+)
+
+// corsAllowedMethods are the methods browsers may use in cross-origin
+// requests.
+var corsAllowedMethods = []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete, http.MethodOptions}
+
+// corsAllowedHeaders are the request headers browsers may send in
+// cross-origin requests.
+var corsAllowedHeaders = []string{"Accept", "Authorization", "Content-Type", "X-Request-ID"}
+
+// corsExposedHeaders are the response headers scripts may read.
+var corsExposedHeaders = []string{"X-Total-Count", "X-Request-ID"}
+
+// corsAllowedOrigins returns the origins listed in the comma-separated
+// CORS_ALLOWED_ORIGINS environment variable. "*" allows any origin.
+func corsAllowedOrigins() []string {
+	origins := []string{}
+	for _, origin := range strings.Split(os.Getenv("CORS_ALLOWED_ORIGINS"), ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			origins = append(origins, origin)
+		}
+	}
+	return origins
+}
+
+// withCORS adds CORS headers for requests from the allowed origins and
+// answers preflight requests. Without CORS_ALLOWED_ORIGINS it returns next
+// unchanged, so browsers keep enforcing the same-origin policy.
+func withCORS(next http.Handler) http.Handler {
+	origins := corsAllowedOrigins()
+	if len(origins) == 0 {
+		return next
+	}
+	allowAny := containsString(origins, "*")
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" || (!allowAny && !containsString(origins, origin)) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Add("Vary", "Origin")
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Set("Access-Control-Expose-Headers", strings.Join(corsExposedHeaders, ", "))
+
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			w.Header().Set("Access-Control-Allow-Methods", strings.Join(corsAllowedMethods, ", "))
+			w.Header().Set("Access-Control-Allow-Headers", strings.Join(corsAllowedHeaders, ", "))
+			w.Header().Set("Access-Control-Max-Age", "600")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -1,28 +1,86 @@
 package main
 
 import (
+	"context"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/go-sql-driver/mysql"
 )
 
+// Validation errors returned by AddQuestion for incomplete questions.
+var (
+	ErrMissingLanguage = errors.New("question language is required")
+	ErrMissingType     = errors.New("question type is required")
+	ErrMissingTask     = errors.New("question task is required")
+
+	// ErrQuestionNotFound is returned when no question has the requested ID.
+	ErrQuestionNotFound = errors.New("question not found")
+
+	// ErrTagNotFound is returned when no tag has the requested name.
+	ErrTagNotFound = errors.New("tag not found")
+
+	// ErrInvalidFieldForType is returned when a field is set that the
+	// question's type does not support, such as a dare target on a truth.
+	ErrInvalidFieldForType = errors.New("dare_target is only allowed on dares")
+)
+
+const (
+	// defaultQuestionsLimit is the page size of GET /questions when no limit
+	// is given.
+	defaultQuestionsLimit = 100
+
+	// maxQuestionsLimit caps the page size of a question query.
+	maxQuestionsLimit = 500
+)
+
+// cancelCheckInterval is the number of rows read between checks for a
+// cancelled context while scanning large result sets.
+const cancelCheckInterval = 100
+
+// groupConcatMaxLen is set as group_concat_max_len on every pooled
+// connection through the DSN. The server default of 1024 bytes silently
+// truncates the GROUP_CONCAT tag lists of questions with many tags; this is
+// the largest value MySQL accepts, leaving max_allowed_packet as the only
+// limit.
+const groupConcatMaxLen = 4294967295
+
+// listSeparator joins the values of a GROUP_CONCAT list. The ASCII unit
+// separator cannot be typed into a tag name or alias, unlike the default
+// comma, which legacy rows created before tag names were validated may
+// still contain; splitting on it never breaks a value apart.
+const listSeparator = "\x1f"
+
+// groupConcat returns a GROUP_CONCAT of expr joined by listSeparator, to be
+// read back with splitList. orderBy may be empty.
+func groupConcat(expr, orderBy string) string {
+	if orderBy != "" {
+		expr += " ORDER BY " + orderBy
+	}
+	return "GROUP_CONCAT(" + expr + " SEPARATOR '" + listSeparator + "')"
+}
+
+// splitList splits a list built by groupConcat.
+func splitList(list string) []string {
+	return strings.Split(list, listSeparator)
+}
+
 // Database represents a connection to the MySQL database
 // @Description Database connection handler for truth or dare questions
 type Database struct {
-	db *sql.DB
-}
-
-// QueryConfig contains configuration options for database queries
-// @Description Configuration options for filtering questions
-type QueryConfig struct {
-	// Determines if all tags must match (true) or any tag matches (false)
-	// @example false
-	MatchAllTags bool
+	db      DBInterface
+	filters *FilterPipeline
 }
 
 // NewDatabase creates a new database connection using environment variables
@@ -43,90 +101,571 @@ type QueryConfig struct {
 //	  - name: MYSQL_DATABASE
 //	    description: Database name
 func NewDatabase() (*Database, error) {
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=Local",
+	d, err := openDatabase()
+	if err != nil {
+		return nil, err
+	}
+
+	for i := 0; i < 10; i++ {
+		err = d.Ping(context.Background())
+		if err == nil {
+			return d, nil
+		}
+		log.Printf("Failed to connect to database (attempt %d/10): %v", i+1, err)
+		time.Sleep(5 * time.Second)
+	}
+
+	d.Close()
+	return nil, fmt.Errorf("failed to connect to database after 10 attempts: %w", err)
+}
+
+// openDatabase returns a Database configured from the environment variables
+// documented on NewDatabase without connecting to the server; the first
+// query dials it.
+func openDatabase() (*Database, error) {
+	cfg, err := mysql.ParseDSN(databaseDSN())
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	connector, err := mysql.NewConnector(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	return &Database{db: sql.OpenDB(withQueryLogging(connector))}, nil
+}
+
+// databaseDSN returns the driver DSN for the environment variables
+// documented on NewDatabase.
+func databaseDSN() string {
+	return fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=Local&group_concat_max_len=%d",
 		os.Getenv("MYSQL_USER"),
 		os.Getenv("MYSQL_PASSWORD"),
 		os.Getenv("MYSQL_HOST"),
 		os.Getenv("MYSQL_PORT"),
 		os.Getenv("MYSQL_DATABASE"),
+		groupConcatMaxLen,
 	)
+}
 
-	var db *sql.DB
-	var err error
-	for i := 0; i < 10; i++ {
-		db, err = sql.Open("mysql", dsn)
-		if err == nil {
-			err = db.Ping()
-			if err == nil {
-				break
+// GetQuestions retrieves filtered questions from the database
+// @Description Fetches questions matching the language, type, and tag filters
+// @Param filters FilterSet true "Filters to apply; zero values are ignored"
+// @Param opts QueryOptions false "Field selection and pagination"
+// @Return []Question Matching questions
+// @Return error Query execution error
+func (d *Database) GetQuestions(ctx context.Context, filters FilterSet, opts QueryOptions) ([]Question, error) {
+	baseQuery, args := buildQuestionsQuery(filters, opts)
+
+	rows, err := d.db.QueryContext(ctx, baseQuery, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch questions: %w", err)
+	}
+	defer rows.Close()
+
+	questions := []Question{}
+	for n := 0; rows.Next(); n++ {
+		// Stop reading as soon as the caller goes away; closing rows aborts
+		// the query on the server instead of draining the whole result.
+		if n%cancelCheckInterval == 0 {
+			select {
+			case <-ctx.Done():
+				rows.Close()
+				return nil, fmt.Errorf("fetching questions aborted: %w", ctx.Err())
+			default:
 			}
 		}
-		log.Printf("Failed to connect to database (attempt %d/10): %v", i+1, err)
-		time.Sleep(5 * time.Second)
+
+		q, err := scanQuestion(rows)
+		if err != nil {
+			return nil, err
+		}
+		questions = append(questions, q)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read questions: %w", err)
+	}
+
+	return questions, nil
+}
 
+// GetQuestionByID returns the question with the given ID together with its
+// tags, or ErrQuestionNotFound if it does not exist
+// @Description Fetches a single question by primary key
+// @Return *Question The question
+// @Return error ErrQuestionNotFound or query execution error
+func (d *Database) GetQuestionByID(ctx context.Context, id int) (*Question, error) {
+	rows, err := d.db.QueryContext(ctx, `
+        SELECT q.id, q.language, q.type, q.task, q.dare_target, q.attributes, q.available_from, q.available_until, `+groupConcat("t.name", "")+` as tags
+        FROM questions q
+        LEFT JOIN question_tags qt ON q.id = qt.question_id
+        LEFT JOIN tags t ON qt.tag_id = t.id
+        WHERE q.id = ?
+        GROUP BY q.id`, id)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to database after 10 attempts: %v", err)
+		return nil, fmt.Errorf("failed to fetch question %d: %w", id, err)
 	}
+	defer rows.Close()
 
-	return &Database{db: db}, nil
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("failed to read question %d: %w", id, err)
+		}
+		return nil, ErrQuestionNotFound
+	}
+	q, err := scanQuestion(rows)
+	if err != nil {
+		return nil, err
+	}
+	return &q, nil
 }
 
-// GetQuestions retrieves filtered questions from the database
-// @Description Fetches questions based on language, type, and tags
-// @Param language query string false "ISO language code filter (e.g., 'en', 'de')"
-// @Param qType query string false "Question type filter ('truth' or 'dare')"
-// @Param tags query []string false "Tag names to filter by"
-// @Param config query QueryConfig false "Query configuration options"
-// @Success 200 {array} Question
-// @Failure 400 {object} ErrorResponse
-// @Failure 500 {object} ErrorResponse
-// @Router /questions [get]
-func (d *Database) GetQuestions(language, qType string, tags []string, config *QueryConfig) ([]Question, error) {
-	baseQuery := `
-        SELECT DISTINCT q.id, q.language, q.type, q.task, GROUP_CONCAT(t.name) as tags
+// CountQuestions returns how many questions match the filters
+// @Description Counts matching questions without fetching them
+// @Return int Number of matching questions
+// @Return error Query execution error
+func (d *Database) CountQuestions(ctx context.Context, filters FilterSet) (int, error) {
+	baseQuery, args := buildQuestionsQuery(filters, QueryOptions{})
+
+	var count int
+	if err := d.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM ("+baseQuery+") matching", args...).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count questions: %w", err)
+	}
+	return count, nil
+}
+
+// GetRandomQuestions returns up to count distinct questions matching the
+// filters, chosen at random by the database
+// @Description Selects random questions in SQL without loading the full result set
+// @Return []Question Randomly ordered questions, possibly fewer than count
+// @Return error Query execution error
+func (d *Database) GetRandomQuestions(ctx context.Context, filters FilterSet, count int) ([]Question, error) {
+	baseQuery, args := buildQuestionsQuery(filters, QueryOptions{})
+	baseQuery += " ORDER BY RAND() LIMIT ?"
+	args = append(args, count)
+
+	rows, err := d.db.QueryContext(ctx, baseQuery, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch random questions: %w", err)
+	}
+	defer rows.Close()
+
+	questions := []Question{}
+	for rows.Next() {
+		q, err := scanQuestion(rows)
+		if err != nil {
+			return nil, err
+		}
+		questions = append(questions, q)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read random questions: %w", err)
+	}
+
+	return questions, nil
+}
+
+// GetSeededQuestions returns up to count questions matching the filters in
+// an order determined by seed. The same seed yields the same questions in the
+// same order for as long as the matching questions do not change.
+func (d *Database) GetSeededQuestions(ctx context.Context, filters FilterSet, seed int64, count int) ([]Question, error) {
+	baseQuery, args := buildQuestionsQuery(filters, QueryOptions{})
+	baseQuery += " ORDER BY RAND(?), q.id LIMIT ?"
+	args = append(args, seed, count)
+
+	rows, err := d.db.QueryContext(ctx, baseQuery, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch seeded questions: %w", err)
+	}
+	defer rows.Close()
+
+	questions := []Question{}
+	for rows.Next() {
+		q, err := scanQuestion(rows)
+		if err != nil {
+			return nil, err
+		}
+		questions = append(questions, q)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read seeded questions: %w", err)
+	}
+
+	return questions, nil
+}
+
+// GetRandomQuestion returns a single random question matching the filters,
+// or ErrQuestionNotFound if none match
+// @Description Selects one random question in SQL
+// @Return *Question The selected question
+// @Return error ErrQuestionNotFound or query execution error
+func (d *Database) GetRandomQuestion(ctx context.Context, filters FilterSet) (*Question, error) {
+	questions, err := d.GetRandomQuestions(ctx, filters, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(questions) == 0 {
+		return nil, ErrQuestionNotFound
+	}
+	return &questions[0], nil
+}
+
+// CountQuestionsSince returns how many questions were created after since,
+// optionally restricted to a language. It relies on the created_at indexes
+// and is cheap enough to call on every client launch.
+func (d *Database) CountQuestionsSince(ctx context.Context, since time.Time, language string) (int, error) {
+	query := "SELECT COUNT(*) FROM questions WHERE created_at > ?"
+	args := []interface{}{since}
+	if language != "" {
+		query += " AND language = ?"
+		args = append(args, language)
+	}
+
+	var count int
+	if err := d.db.QueryRowContext(ctx, query, args...).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count new questions: %w", err)
+	}
+	return count, nil
+}
+
+// GetQuestionsSince returns up to limit of the questions created after since,
+// newest first, optionally restricted to a language
+func (d *Database) GetQuestionsSince(ctx context.Context, since time.Time, language string, limit int) ([]Question, error) {
+	query := `
+        SELECT q.id, q.language, q.type, q.task, q.dare_target, q.attributes, q.available_from, q.available_until, ` + groupConcat("t.name", "") + ` as tags
         FROM questions q
         LEFT JOIN question_tags qt ON q.id = qt.question_id
+        LEFT JOIN tags t ON qt.tag_id = t.id
+        WHERE q.created_at > ?`
+	args := []interface{}{since}
+	if language != "" {
+		query += " AND q.language = ?"
+		args = append(args, language)
+	}
+	query += " GROUP BY q.id ORDER BY q.created_at DESC, q.id DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := d.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch new questions: %w", err)
+	}
+	defer rows.Close()
+
+	questions := []Question{}
+	for rows.Next() {
+		q, err := scanQuestion(rows)
+		if err != nil {
+			return nil, err
+		}
+		questions = append(questions, q)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read new questions: %w", err)
+	}
+
+	return questions, nil
+}
+
+// ChangeTime returns when the change log entry seq was recorded. It returns
+// sql.ErrNoRows if the entry does not exist.
+func (d *Database) ChangeTime(ctx context.Context, seq int64) (time.Time, error) {
+	var occurredAt time.Time
+	err := d.db.QueryRowContext(ctx, "SELECT occurred_at FROM change_log WHERE seq = ?", seq).Scan(&occurredAt)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to look up change %d: %w", seq, err)
+	}
+	return occurredAt, nil
+}
+
+// StreamQuestions runs the query for every question matching filters and
+// returns the open rows, to be read with scanQuestion. Unlike GetQuestions
+// nothing is collected, so callers can write each question out as it is
+// scanned. The caller must close the rows.
+// @Description Opens a cursor over the questions matching the filters
+// @Param filters FilterSet true "Filters to apply; zero values are ignored"
+// @Return *sql.Rows Rows in the shape scanQuestion expects
+// @Return error Query execution error
+func (d *Database) StreamQuestions(ctx context.Context, filters FilterSet) (*sql.Rows, error) {
+	baseQuery, args := buildQuestionsQuery(filters, QueryOptions{})
+
+	rows, err := d.db.QueryContext(ctx, baseQuery, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch questions: %w", err)
+	}
+	return rows, nil
+}
+
+// ExportToWriter streams the questions matching filters to w as JSON lines,
+// one Question object per line. Rows are written as they are scanned so the
+// full export is never held in memory.
+// @Description Streams matching questions in JSON-lines format
+// @Return error Query, scan or write error
+func (d *Database) ExportToWriter(ctx context.Context, w io.Writer, filters FilterSet) error {
+	rows, err := d.StreamQuestions(ctx, filters)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	return writeJSONLinesExport(w, rows)
+}
+
+// scanQuestion reads one row produced by buildQuestionsQuery.
+func scanQuestion(rows *sql.Rows) (Question, error) {
+	var q Question
+	var dareTarget, attributes, tags sql.NullString
+	var availableFrom, availableUntil sql.NullTime
+	if err := rows.Scan(&q.ID, &q.Language, &q.Type, &q.Task, &dareTarget, &attributes, &availableFrom, &availableUntil, &tags); err != nil {
+		return Question{}, fmt.Errorf("failed to parse question: %w", err)
+	}
+	if dareTarget.Valid {
+		q.DareTarget = &dareTarget.String
+	}
+	if attributes.Valid {
+		if err := json.Unmarshal([]byte(attributes.String), &q.Attributes); err != nil {
+			return Question{}, fmt.Errorf("failed to parse attributes of question %d: %w", q.ID, err)
+		}
+	}
+	if availableFrom.Valid {
+		q.AvailableFrom = &availableFrom.Time
+	}
+	if availableUntil.Valid {
+		q.AvailableUntil = &availableUntil.Time
+	}
+	if tags.Valid {
+		q.Tags = splitList(tags.String)
+	} else {
+		q.Tags = []string{}
+	}
+	return q, nil
+}
+
+// questionColumns lists the selectable question fields in the column order
+// scanQuestion expects. Unselected fields are replaced by their zero literal
+// so the row shape never changes.
+var questionColumns = []struct {
+	field string
+	expr  string
+	zero  string
+}{
+	{"id", "q.id", "q.id"},
+	{"language", "q.language", "''"},
+	{"type", "q.type", "''"},
+	{"task", "q.task", "''"},
+	{"dare_target", "q.dare_target", "NULL"},
+	{"attributes", "q.attributes", "NULL"},
+	{"available_from", "q.available_from", "NULL"},
+	{"available_until", "q.available_until", "NULL"},
+	{"tags", groupConcat("t.name", ""), "NULL"},
+}
+
+// IsQuestionField reports whether field can be passed to GetQuestions as a
+// selected field.
+func IsQuestionField(field string) bool {
+	for _, column := range questionColumns {
+		if column.field == field {
+			return true
+		}
+	}
+	return false
+}
+
+// QueryOptions shapes the result of a question query without changing which
+// questions match.
+type QueryOptions struct {
+	// Fields restricts the question fields read from the database; all
+	// fields when empty. id is always included.
+	Fields []string
+
+	// Limit caps the number of questions returned; 0 means no limit.
+	Limit int
+
+	// Offset skips this many questions in ID order.
+	Offset int
+}
+
+// buildQuestionsQuery returns the SQL and positional arguments used by
+// GetQuestions for the given filters. When opts.Fields is non-empty only
+// those question fields are read from the database and the tag joins are
+// skipped unless tags are selected. A limit or offset orders the result by ID
+// so pages are stable. It performs no I/O.
+func buildQuestionsQuery(filters FilterSet, opts QueryOptions) (string, []interface{}) {
+	fields := opts.Fields
+	selected := map[string]bool{}
+	for _, field := range fields {
+		selected[field] = true
+	}
+
+	selectList := make([]string, len(questionColumns))
+	for i, column := range questionColumns {
+		if len(fields) == 0 || selected[column.field] {
+			selectList[i] = column.expr
+		} else {
+			selectList[i] = column.zero
+		}
+	}
+
+	baseQuery := `
+        SELECT ` + strings.Join(selectList, ", ") + ` as tags
+        FROM questions q`
+	if len(fields) == 0 || selected["tags"] {
+		baseQuery += `
+        LEFT JOIN question_tags qt ON q.id = qt.question_id
         LEFT JOIN tags t ON qt.tag_id = t.id`
+	}
 
+	// Placeholders in joins precede those in the WHERE clause, so their
+	// arguments are collected separately and put first.
+	joinArgs := []interface{}{}
 	whereConditions := []string{}
 	args := []interface{}{}
 
-	if language != "" {
+	if filters.Language != "" {
 		whereConditions = append(whereConditions, "q.language = ?")
-		args = append(args, language)
+		args = append(args, filters.Language)
 	}
 
-	if qType != "" {
+	if filters.Type != "" {
 		whereConditions = append(whereConditions, "q.type = ?")
-		args = append(args, qType)
+		args = append(args, filters.Type)
+	}
+
+	// Questions outside their availability window are hidden unless
+	// scheduled questions are explicitly requested.
+	if !filters.IncludeScheduled {
+		now := time.Now()
+		whereConditions = append(whereConditions,
+			"(q.available_from IS NULL OR q.available_from <= ?) AND (q.available_until IS NULL OR q.available_until > ?)")
+		args = append(args, now, now)
+	}
+
+	if filters.HasDareTarget != nil {
+		if *filters.HasDareTarget {
+			whereConditions = append(whereConditions, "q.dare_target IS NOT NULL")
+		} else {
+			whereConditions = append(whereConditions, "q.dare_target IS NULL")
+		}
+	}
+
+	attributeKeys := make([]string, 0, len(filters.Attributes))
+	for key := range filters.Attributes {
+		attributeKeys = append(attributeKeys, key)
+	}
+	sort.Strings(attributeKeys)
+	for _, key := range attributeKeys {
+		// JSON booleans only compare equal to JSON values, strings need
+		// unquoting, and numbers compare numerically as they are.
+		switch value := filters.Attributes[key].(type) {
+		case bool:
+			whereConditions = append(whereConditions, "JSON_EXTRACT(q.attributes, ?) = CAST(? AS JSON)")
+			args = append(args, attributePath(key), strconv.FormatBool(value))
+		case string:
+			whereConditions = append(whereConditions, "JSON_UNQUOTE(JSON_EXTRACT(q.attributes, ?)) = ?")
+			args = append(args, attributePath(key), value)
+		default:
+			whereConditions = append(whereConditions, "JSON_EXTRACT(q.attributes, ?) = ?")
+			args = append(args, attributePath(key), value)
+		}
+	}
+
+	if filters.Search != "" {
+		// Search terms are tokenized like indexed tasks and matched as word
+		// prefixes against the search index. Tasks starting with the search
+		// match too, through a prefix LIKE the task index can serve; only
+		// searches the index cannot find, such as "50%" or a partial word
+		// shorter than the index's minimum token size, fall back to
+		// matching anywhere in the task. The column collation makes the
+		// LIKE case-insensitive. A search made up only of stop words is
+		// matched literally alone.
+		tokens := searchTokens(filters.Search)
+		literal := likePrefixPattern(filters.Search)
+		if needsContainsMatch(filters.Search, tokens) {
+			literal = likeContainsPattern(filters.Search)
+		}
+		if len(tokens) > 0 {
+			whereConditions = append(whereConditions,
+				"(q.id IN (SELECT question_id FROM question_search WHERE MATCH(search_tokens) AGAINST (? IN BOOLEAN MODE)) OR q.task LIKE ? ESCAPE '!')")
+			args = append(args, searchMatchQuery(tokens))
+		} else {
+			whereConditions = append(whereConditions, "q.task LIKE ? ESCAPE '!'")
+		}
+		args = append(args, literal)
+	}
+
+	if excludeTags := uniqueStrings(filters.ExcludeTags); len(excludeTags) > 0 {
+		// Exclusion is independent of the tag match below: a question
+		// carrying an excluded tag is dropped even if that tag is also
+		// one of the requested ones.
+		exact, prefixes := splitTagPatterns(excludeTags)
+		var excludeConditions []string
+		if len(exact) > 0 {
+			excludeConditions = append(excludeConditions, fmt.Sprintf("xt.name IN (%s)", placeholders(len(exact))))
+			for _, tag := range exact {
+				args = append(args, tag)
+			}
+		}
+		for _, prefix := range prefixes {
+			excludeConditions = append(excludeConditions, "xt.name LIKE ? ESCAPE '!'")
+			args = append(args, likePrefixPattern(prefix))
+		}
+		whereConditions = append(whereConditions, `NOT EXISTS (
+                SELECT 1
+                FROM question_tags xqt
+                INNER JOIN tags xt ON xqt.tag_id = xt.id
+                WHERE xqt.question_id = q.id AND (`+strings.Join(excludeConditions, " OR ")+`))`)
 	}
 
-	if len(tags) > 0 {
-		if config != nil && config.MatchAllTags {
-			// Match all tags using COUNT and HAVING
-			baseQuery += fmt.Sprintf(`
-                INNER JOIN (
+	if tags := uniqueStrings(filters.Tags); len(tags) > 0 {
+		// Tag filtering happens in a subquery that yields each matching
+		// question once, so the outer joins still aggregate every tag of
+		// the question and never produce duplicate rows. Wildcard tags
+		// become prefix LIKE conditions; with matchAllTags a wildcard is
+		// satisfied by any one tag with its prefix.
+		exact, prefixes := splitTagPatterns(tags)
+
+		var tagConditions []string
+		if len(exact) > 0 {
+			tagConditions = append(tagConditions, fmt.Sprintf("t.name IN (%s)", placeholders(len(exact))))
+			for _, tag := range exact {
+				joinArgs = append(joinArgs, tag)
+			}
+		}
+		for _, prefix := range prefixes {
+			tagConditions = append(tagConditions, "t.name LIKE ? ESCAPE '!'")
+			joinArgs = append(joinArgs, likePrefixPattern(prefix))
+		}
+
+		tagMatch := `
                     SELECT qt.question_id
                     FROM question_tags qt
                     INNER JOIN tags t ON qt.tag_id = t.id
-                    WHERE t.name IN (?%s)
-                    GROUP BY qt.question_id
-                    HAVING COUNT(DISTINCT t.name) = ?
-                ) matching_tags ON q.id = matching_tags.question_id`,
-				strings.Repeat(",?", len(tags)-1))
-
-			for _, tag := range tags {
-				args = append(args, tag)
+                    WHERE ` + strings.Join(tagConditions, " OR ") + `
+                    GROUP BY qt.question_id`
+		if filters.MatchAllTags {
+			var having []string
+			switch {
+			case len(prefixes) == 0:
+				having = append(having, "COUNT(DISTINCT t.name) = ?")
+				joinArgs = append(joinArgs, len(exact))
+			case len(exact) > 0:
+				// A name matching both an exact tag and a wildcard must
+				// only count towards the exact tags.
+				having = append(having, fmt.Sprintf("COUNT(DISTINCT CASE WHEN t.name IN (%s) THEN t.name END) = ?", placeholders(len(exact))))
+				for _, tag := range exact {
+					joinArgs = append(joinArgs, tag)
+				}
+				joinArgs = append(joinArgs, len(exact))
 			}
-			args = append(args, len(tags))
-		} else {
-			// Match any tag
-			whereConditions = append(whereConditions, fmt.Sprintf("t.name IN (?%s)", strings.Repeat(",?", len(tags)-1)))
-			for _, tag := range tags {
-				args = append(args, tag)
+			for _, prefix := range prefixes {
+				having = append(having, "MAX(t.name LIKE ? ESCAPE '!') = 1")
+				joinArgs = append(joinArgs, likePrefixPattern(prefix))
 			}
+			tagMatch += `
+                    HAVING ` + strings.Join(having, " AND ")
 		}
+
+		baseQuery += `
+                INNER JOIN (` + tagMatch + `
+                ) matching_tags ON q.id = matching_tags.question_id`
 	}
 
 	if len(whereConditions) > 0 {
@@ -134,116 +673,1083 @@ func (d *Database) GetQuestions(language, qType string, tags []string, config *Q
 	}
 
 	baseQuery += " GROUP BY q.id"
+	args = append(joinArgs, args...)
 
-	rows, err := d.db.Query(baseQuery, args...)
-	if err != nil {
-		return nil, fmt.Errorf("failed to fetch questions: %v", err)
+	if opts.Limit > 0 || opts.Offset > 0 {
+		limit := opts.Limit
+		if limit <= 0 {
+			limit = maxQuestionsLimit
+		}
+		baseQuery += " ORDER BY q.id LIMIT ? OFFSET ?"
+		args = append(args, limit, opts.Offset)
 	}
-	defer rows.Close()
 
-	var questions []Question
-	for rows.Next() {
-		var q Question
-		var tags sql.NullString
-		err := rows.Scan(&q.ID, &q.Language, &q.Type, &q.Task, &tags)
-		if err != nil {
-			return nil, fmt.Errorf("failed to parse question: %v", err)
-		}
-		if tags.Valid {
-			q.Tags = strings.Split(tags.String, ",")
-		} else {
-			q.Tags = []string{}
+	return baseQuery, args
+}
+
+// placeholders returns n comma-separated ? placeholders.
+func placeholders(n int) string {
+	if n <= 0 {
+		return ""
+	}
+	return "?" + strings.Repeat(",?", n-1)
+}
+
+// uniqueStrings returns values with case-insensitive duplicates removed,
+// keeping the first occurrence. Tag names compare case-insensitively in the
+// database, so duplicates would break the HAVING COUNT match-all check. The
+// result is never nil, so it encodes as [] even when values is empty.
+func uniqueStrings(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	unique := make([]string, 0, len(values))
+	for _, v := range values {
+		key := strings.ToLower(v)
+		if !seen[key] {
+			seen[key] = true
+			unique = append(unique, v)
 		}
-		questions = append(questions, q)
 	}
+	return unique
+}
 
-	return questions, nil
+// tagSortColumns whitelists the sort fields accepted by GetTags and maps them
+// to their ORDER BY expression.
+var tagSortColumns = map[string]string{
+	"name":  "t.name",
+	"count": "COUNT(qt.question_id)",
 }
 
-// GetTags returns all available question tags
+// GetTags returns all available question tags ordered by sortField ("name"
+// or "count", the number of questions using the tag) in the given order
+// ("asc" or "desc"). Ties are broken by name.
 // @Description Retrieves complete list of available tags from database
 // @Return []string List of tag names
-// @Return error Query execution error
+// @Return error Unknown sort field or order, or query execution error
 // @Example
 //
-//	tags, err := db.GetTags()
-//	// Returns: ["funny", "social", "party", "deep", "romantic"]
-func (d *Database) GetTags() ([]string, error) {
-	rows, err := d.db.Query("SELECT name FROM tags")
+//	tags, err := db.GetTags(ctx, "name", "asc")
+//	// Returns: ["deep", "funny", "party", "romantic", "social"]
+func (d *Database) GetTags(ctx context.Context, sortField, order string) ([]string, error) {
+	column, ok := tagSortColumns[sortField]
+	if !ok {
+		return nil, fmt.Errorf("unknown tag sort field %q", sortField)
+	}
+	if order != "asc" && order != "desc" {
+		return nil, fmt.Errorf("unknown tag sort order %q", order)
+	}
+
+	rows, err := d.db.QueryContext(ctx, `
+        SELECT t.name
+        FROM tags t
+        LEFT JOIN question_tags qt ON qt.tag_id = t.id
+        GROUP BY t.id
+        ORDER BY `+column+" "+order+", t.name")
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch tags: %v", err)
+		return nil, fmt.Errorf("failed to fetch tags: %w", err)
 	}
 	defer rows.Close()
 
-	var tags []string
+	tags := []string{}
 	for rows.Next() {
 		var tag string
-		err := rows.Scan(&tag)
-		if err != nil {
-			return nil, fmt.Errorf("failed to parse tag: %v", err)
+		if err := rows.Scan(&tag); err != nil {
+			return nil, fmt.Errorf("failed to parse tag: %w", err)
 		}
 		tags = append(tags, tag)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read tags: %w", err)
+	}
 
 	return tags, nil
 }
 
-// AddQuestion inserts a new question with associated tags
-// @Description Creates a new question and its tag associations in a transaction
-// @Accept json
-// @Produce json
-// @Param q body Question true "Question object to be created"
-// @Success 201 {object} Question "Successfully created question"
-// @Failure 400 {object} ErrorResponse "Invalid question data"
-// @Failure 500 {object} ErrorResponse "Database error"
-// @Router /questions [post]
-func (d *Database) AddQuestion(q Question) error {
-	tx, err := d.db.Begin()
+// CheckTypeBalance returns the number of questions per type. Types without
+// any question are reported with a count of zero.
+func (d *Database) CheckTypeBalance(ctx context.Context) (map[string]int, error) {
+	rows, err := d.db.QueryContext(ctx, "SELECT type, COUNT(*) FROM questions GROUP BY type")
 	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %v", err)
+		return nil, fmt.Errorf("failed to count question types: %w", err)
 	}
+	defer rows.Close()
 
-	result, err := tx.Exec("INSERT INTO questions (language, type, task) VALUES (?, ?, ?)",
-		q.Language, q.Type, q.Task)
-	if err != nil {
-		tx.Rollback()
-		return fmt.Errorf("failed to insert question: %v", err)
+	counts := map[string]int{"truth": 0, "dare": 0}
+	for rows.Next() {
+		var qType string
+		var count int
+		if err := rows.Scan(&qType, &count); err != nil {
+			return nil, fmt.Errorf("failed to parse type count: %w", err)
+		}
+		counts[qType] = count
 	}
-
-	questionID, err := result.LastInsertId()
-	if err != nil {
-		tx.Rollback()
-		return fmt.Errorf("failed to get last insert ID: %v", err)
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read type counts: %w", err)
 	}
 
-	for _, tag := range q.Tags {
-		var tagID int64
-		err := tx.QueryRow("SELECT id FROM tags WHERE name = ?", tag).Scan(&tagID)
-		if err == sql.ErrNoRows {
-			result, err := tx.Exec("INSERT INTO tags (name) VALUES (?)", tag)
-			if err != nil {
-				tx.Rollback()
-				return fmt.Errorf("failed to insert tag: %v", err)
-			}
-			tagID, err = result.LastInsertId()
-			if err != nil {
-				tx.Rollback()
-				return fmt.Errorf("failed to get tag ID: %v", err)
-			}
-		} else if err != nil {
-			tx.Rollback()
-			return fmt.Errorf("failed to query tag: %v", err)
-		}
+	return counts, nil
+}
 
-		_, err = tx.Exec("INSERT INTO question_tags (question_id, tag_id) VALUES (?, ?)",
-			questionID, tagID)
-		if err != nil {
-			tx.Rollback()
-			return fmt.Errorf("failed to insert question tag: %v", err)
-		}
+// GetTaskLengthHistogram counts questions per task length bucket, optionally
+// restricted to a language and type. Buckets are computed in SQL with a CASE
+// expression, so only one row per non-empty bucket is transferred.
+// @Description Groups questions by CHAR_LENGTH(task) into lengthBuckets
+// @Return []LengthBucket All buckets in ascending order, including empty ones
+// @Return error Query execution error
+func (d *Database) GetTaskLengthHistogram(ctx context.Context, language, qType string) ([]LengthBucket, error) {
+	cases := make([]string, lengthBucketCount)
+	args := []interface{}{}
+	for i := range cases {
+		cases[i] = fmt.Sprintf("WHEN CHAR_LENGTH(task) <= ? THEN %d", i)
+		args = append(args, (i+1)*lengthBucketWidth)
 	}
+	query := fmt.Sprintf(`
+        SELECT CASE %s ELSE %d END AS bucket, COUNT(*)
+        FROM questions`, strings.Join(cases, " "), lengthBucketCount)
 
-	return tx.Commit()
+	var conditions []string
+	if language != "" {
+		conditions = append(conditions, "language = ?")
+		args = append(args, language)
+	}
+	if qType != "" {
+		conditions = append(conditions, "type = ?")
+		args = append(args, qType)
+	}
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " GROUP BY bucket"
+
+	rows, err := d.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count task lengths: %w", err)
+	}
+	defer rows.Close()
+
+	buckets := lengthBuckets()
+	for rows.Next() {
+		var bucket, count int
+		if err := rows.Scan(&bucket, &count); err != nil {
+			return nil, fmt.Errorf("failed to parse length bucket: %w", err)
+		}
+		buckets[bucket].Count = count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read length buckets: %w", err)
+	}
+
+	return buckets, nil
+}
+
+// GetLanguages returns the languages that have at least one question, sorted
+func (d *Database) GetLanguages(ctx context.Context) ([]string, error) {
+	rows, err := d.db.QueryContext(ctx, "SELECT DISTINCT language FROM questions ORDER BY language")
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch languages: %w", err)
+	}
+	defer rows.Close()
+
+	languages := []string{}
+	for rows.Next() {
+		var language string
+		if err := rows.Scan(&language); err != nil {
+			return nil, fmt.Errorf("failed to parse language: %w", err)
+		}
+		languages = append(languages, language)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read languages: %w", err)
+	}
+
+	return languages, nil
+}
+
+// GetCommonTags returns the tags carried by every one of the given questions
+// (intersection) and by at least one of them (union), both sorted by name
+// @Description Computes shared tags for a selection of questions
+// @Return []string Tags present on all questions
+// @Return []string Tags present on any question
+// @Return error Query execution error
+func (d *Database) GetCommonTags(ctx context.Context, ids []int) ([]string, []string, error) {
+	intersection, union := []string{}, []string{}
+	if len(ids) == 0 {
+		return intersection, union, nil
+	}
+
+	args := []interface{}{len(ids)}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+
+	rows, err := d.db.QueryContext(ctx, fmt.Sprintf(`
+        SELECT t.name, COUNT(DISTINCT qt.question_id) = ? AS on_all
+        FROM question_tags qt
+        INNER JOIN tags t ON qt.tag_id = t.id
+        WHERE qt.question_id IN (%s)
+        GROUP BY t.id
+        ORDER BY t.name`, placeholders(len(ids))), args...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to fetch common tags: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		var onAll bool
+		if err := rows.Scan(&name, &onAll); err != nil {
+			return nil, nil, fmt.Errorf("failed to parse tag: %w", err)
+		}
+		union = append(union, name)
+		if onAll {
+			intersection = append(intersection, name)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("failed to read common tags: %w", err)
+	}
+
+	return intersection, union, nil
+}
+
+// ExportTagMetadata returns every tag with its category, description and
+// aliases, ordered by name
+// @Description Reads the full tag vocabulary for export
+// @Return []TagMetadata Tag metadata
+// @Return error Query execution error
+func (d *Database) ExportTagMetadata(ctx context.Context) ([]TagMetadata, error) {
+	return queryTagMetadata(ctx, d.db)
+}
+
+// queryer is implemented by both *sql.DB and *sql.Tx.
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+func queryTagMetadata(ctx context.Context, q queryer) ([]TagMetadata, error) {
+	rows, err := q.QueryContext(ctx, `
+        SELECT t.name, COALESCE(t.category, ''), COALESCE(t.description, ''), `+groupConcat("a.alias", "a.alias")+`
+        FROM tags t
+        LEFT JOIN tag_aliases a ON a.tag_id = t.id
+        GROUP BY t.id
+        ORDER BY t.name`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch tag metadata: %w", err)
+	}
+	defer rows.Close()
+
+	tags := []TagMetadata{}
+	for rows.Next() {
+		var tag TagMetadata
+		var aliases sql.NullString
+		if err := rows.Scan(&tag.Name, &tag.Category, &tag.Description, &aliases); err != nil {
+			return nil, fmt.Errorf("failed to parse tag metadata: %w", err)
+		}
+		tag.Aliases = []string{}
+		if aliases.Valid {
+			tag.Aliases = splitList(aliases.String)
+		}
+		tags = append(tags, tag)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read tag metadata: %w", err)
+	}
+
+	return tags, nil
+}
+
+// ImportTagMetadata applies tags to the tag vocabulary in one transaction.
+// Missing tags are created and tags whose metadata differs are updated. When
+// prune is set, tags absent from the import are deleted unless a question
+// still uses them. Question associations are never modified.
+// @Description Idempotently applies a tag metadata document
+// @Return TagImportReport Summary of applied changes
+// @Return error Query execution error
+func (d *Database) ImportTagMetadata(ctx context.Context, tags []TagMetadata, prune bool) (TagImportReport, error) {
+	var report TagImportReport
+	err := d.withTransaction(ctx, func(tx *sql.Tx) error {
+		report = TagImportReport{Created: []string{}, Updated: []string{}, Pruned: []string{}, KeptInUse: []string{}}
+
+		existing, err := queryTagMetadata(ctx, tx)
+		if err != nil {
+			return err
+		}
+		current := make(map[string]TagMetadata, len(existing))
+		for _, tag := range existing {
+			current[tag.Name] = tag
+		}
+
+		imported := make(map[string]bool, len(tags))
+		for _, tag := range tags {
+			imported[tag.Name] = true
+			old, exists := current[tag.Name]
+			if exists && old.Category == tag.Category && old.Description == tag.Description && sameStrings(old.Aliases, tag.Aliases) {
+				continue
+			}
+
+			_, err := tx.ExecContext(ctx, `
+                INSERT INTO tags (name, category, description) VALUES (?, NULLIF(?, ''), NULLIF(?, ''))
+                ON DUPLICATE KEY UPDATE category = VALUES(category), description = VALUES(description)`,
+				tag.Name, tag.Category, tag.Description)
+			if err != nil {
+				return fmt.Errorf("failed to save tag %q: %w", tag.Name, err)
+			}
+
+			var tagID int64
+			if err := tx.QueryRowContext(ctx, "SELECT id FROM tags WHERE name = ?", tag.Name).Scan(&tagID); err != nil {
+				return fmt.Errorf("failed to query tag %q: %w", tag.Name, err)
+			}
+			if _, err := tx.ExecContext(ctx, "DELETE FROM tag_aliases WHERE tag_id = ?", tagID); err != nil {
+				return fmt.Errorf("failed to clear aliases of %q: %w", tag.Name, err)
+			}
+			for _, alias := range tag.Aliases {
+				if _, err := tx.ExecContext(ctx, "INSERT INTO tag_aliases (tag_id, alias) VALUES (?, ?)", tagID, alias); err != nil {
+					return fmt.Errorf("failed to add alias %q to %q: %w", alias, tag.Name, err)
+				}
+			}
+
+			if exists {
+				report.Updated = append(report.Updated, tag.Name)
+			} else {
+				report.Created = append(report.Created, tag.Name)
+			}
+		}
+
+		if !prune {
+			return nil
+		}
+
+		for _, tag := range existing {
+			if imported[tag.Name] {
+				continue
+			}
+
+			var uses int
+			err := tx.QueryRowContext(ctx, `
+                SELECT COUNT(*) FROM question_tags qt
+                INNER JOIN tags t ON qt.tag_id = t.id
+                WHERE t.name = ?`, tag.Name).Scan(&uses)
+			if err != nil {
+				return fmt.Errorf("failed to count uses of %q: %w", tag.Name, err)
+			}
+			if uses > 0 {
+				report.KeptInUse = append(report.KeptInUse, tag.Name)
+				continue
+			}
+
+			if _, err := tx.ExecContext(ctx, `
+                DELETE a FROM tag_aliases a INNER JOIN tags t ON a.tag_id = t.id WHERE t.name = ?`, tag.Name); err != nil {
+				return fmt.Errorf("failed to delete aliases of %q: %w", tag.Name, err)
+			}
+			if _, err := tx.ExecContext(ctx, `
+                DELETE tt FROM tag_translations tt INNER JOIN tags t ON tt.tag_id = t.id WHERE t.name = ?`, tag.Name); err != nil {
+				return fmt.Errorf("failed to delete translations of %q: %w", tag.Name, err)
+			}
+			if _, err := tx.ExecContext(ctx, "DELETE FROM tags WHERE name = ?", tag.Name); err != nil {
+				return fmt.Errorf("failed to delete tag %q: %w", tag.Name, err)
+			}
+			report.Pruned = append(report.Pruned, tag.Name)
+		}
+
+		return nil
+	})
+	return report, err
+}
+
+// sameStrings reports whether a and b hold the same strings, ignoring order.
+func sameStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	counts := make(map[string]int, len(a))
+	for _, s := range a {
+		counts[s]++
+	}
+	for _, s := range b {
+		counts[s]--
+		if counts[s] < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// AddQuestion inserts a new question with associated tags and returns its ID
+// @Description Creates a new question and its tag associations in a transaction
+// @Return int64 ID of the created question
+// @Return error Validation, content filter or database error
+func (d *Database) AddQuestion(ctx context.Context, q Question) (int64, error) {
+	q, attributes, flags, err := d.prepareQuestion(ctx, q)
+	if err != nil {
+		return 0, err
+	}
+
+	var questionID int64
+	err = d.withTransaction(ctx, func(tx *sql.Tx) error {
+		questionID, err = insertQuestion(ctx, tx, q, attributes, flags)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return questionID, nil
+}
+
+// BulkInsertError reports which question of a bulk insert failed.
+type BulkInsertError struct {
+	Index int
+	Err   error
+}
+
+func (e *BulkInsertError) Error() string {
+	return fmt.Sprintf("question %d: %v", e.Index, e.Err)
+}
+
+func (e *BulkInsertError) Unwrap() error {
+	return e.Err
+}
+
+// AddQuestions inserts questions in a single transaction and returns their
+// IDs in input order. Every question is validated and run through the
+// content filters before the transaction starts. If any question fails,
+// nothing is inserted and the error is a *BulkInsertError naming its index.
+// @Description Inserts a batch of questions atomically
+// @Return []int64 IDs of the inserted questions
+// @Return error *BulkInsertError wrapping a validation, content filter or database error
+func (d *Database) AddQuestions(ctx context.Context, questions []Question) ([]int64, error) {
+	type preparedQuestion struct {
+		q          Question
+		attributes interface{}
+		flags      []ContentFlag
+	}
+	batch := make([]preparedQuestion, len(questions))
+	for i, q := range questions {
+		q, attributes, flags, err := d.prepareQuestion(ctx, q)
+		if err != nil {
+			return nil, &BulkInsertError{Index: i, Err: err}
+		}
+		batch[i] = preparedQuestion{q, attributes, flags}
+	}
+
+	var ids []int64
+	err := d.withTransaction(ctx, func(tx *sql.Tx) error {
+		ids = make([]int64, 0, len(batch))
+		for i, p := range batch {
+			id, err := insertQuestion(ctx, tx, p.q, p.attributes, p.flags)
+			if err != nil {
+				return &BulkInsertError{Index: i, Err: err}
+			}
+			ids = append(ids, id)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// insertQuestion inserts a question prepared by prepareQuestion together
+// with its tags, moderation flags and search entry, and records the
+// creation in the change log.
+func insertQuestion(ctx context.Context, tx *sql.Tx, q Question, attributes interface{}, flags []ContentFlag) (int64, error) {
+	result, err := tx.ExecContext(ctx, "INSERT INTO questions (language, type, task, dare_target, attributes, available_from, available_until) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		normalizeLanguage(q.Language), q.Type, q.Task, q.DareTarget, attributes, q.AvailableFrom, q.AvailableUntil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert question: %w", err)
+	}
+
+	questionID, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get last insert ID: %w", err)
+	}
+
+	if err := insertQuestionTags(ctx, tx, questionID, q.Tags); err != nil {
+		return 0, err
+	}
+	if err := insertQuestionFlags(ctx, tx, questionID, flags); err != nil {
+		return 0, err
+	}
+	if err := upsertSearchEntry(ctx, tx, questionID, q.Task); err != nil {
+		return 0, err
+	}
+
+	return questionID, logChange(ctx, tx, ChangeCreate, questionID)
+}
+
+// UpdateQuestion replaces the language, type, task, dare target, attributes,
+// tags and moderation flags of question id in one transaction. The tag set
+// is replaced as a whole, so an empty Tags slice removes every tag; links to
+// tags that stay are kept, stale ones removed and missing tags created. It
+// returns ErrQuestionNotFound if no question has the given ID.
+// @Description Updates a question and reconciles its tag associations
+// @Return error Validation, content filter, ErrQuestionNotFound or database error
+func (d *Database) UpdateQuestion(ctx context.Context, id int, q Question) error {
+	q.ID = id
+	q, attributes, flags, err := d.prepareQuestion(ctx, q)
+	if err != nil {
+		return err
+	}
+
+	return d.withTransaction(ctx, func(tx *sql.Tx) error {
+		var exists int
+		err := tx.QueryRowContext(ctx, "SELECT id FROM questions WHERE id = ? FOR UPDATE", id).Scan(&exists)
+		if err == sql.ErrNoRows {
+			return ErrQuestionNotFound
+		}
+		if err != nil {
+			return fmt.Errorf("failed to look up question: %w", err)
+		}
+
+		_, err = tx.ExecContext(ctx,
+			"UPDATE questions SET language = ?, type = ?, task = ?, dare_target = ?, attributes = ?, available_from = ?, available_until = ? WHERE id = ?",
+			normalizeLanguage(q.Language), q.Type, q.Task, q.DareTarget, attributes, q.AvailableFrom, q.AvailableUntil, id)
+		if err != nil {
+			return fmt.Errorf("failed to update question: %w", err)
+		}
+
+		missing, err := reconcileQuestionTags(ctx, tx, id, q.Tags)
+		if err != nil {
+			return err
+		}
+		if err := insertQuestionTags(ctx, tx, int64(id), missing); err != nil {
+			return err
+		}
+		// The flags describe the previous text; only those raised for the
+		// new text still apply.
+		if _, err := tx.ExecContext(ctx, "DELETE FROM question_flags WHERE question_id = ?", id); err != nil {
+			return fmt.Errorf("failed to remove moderation flags: %w", err)
+		}
+		if err := insertQuestionFlags(ctx, tx, int64(id), flags); err != nil {
+			return err
+		}
+		if err := upsertSearchEntry(ctx, tx, int64(id), q.Task); err != nil {
+			return err
+		}
+
+		return logChange(ctx, tx, ChangeUpdate, int64(id))
+	})
+}
+
+// prepareQuestion sanitizes and validates q for a write, encodes its
+// attributes for the attributes column and runs the content filters.
+func (d *Database) prepareQuestion(ctx context.Context, q Question) (Question, interface{}, []ContentFlag, error) {
+	q = sanitizeQuestion(q)
+
+	switch {
+	case strings.TrimSpace(q.Language) == "":
+		return q, nil, nil, ErrMissingLanguage
+	case strings.TrimSpace(q.Type) == "":
+		return q, nil, nil, ErrMissingType
+	case strings.TrimSpace(q.Task) == "":
+		return q, nil, nil, ErrMissingTask
+	case q.DareTarget != nil && q.Type != "dare":
+		return q, nil, nil, ErrInvalidFieldForType
+	}
+	if err := attributeSchema.Validate(q.Attributes); err != nil {
+		return q, nil, nil, err
+	}
+	if err := checkBlockedTags(q.Tags); err != nil {
+		return q, nil, nil, err
+	}
+
+	var attributes interface{}
+	if len(q.Attributes) > 0 {
+		data, err := json.Marshal(q.Attributes)
+		if err != nil {
+			return q, nil, nil, fmt.Errorf("failed to encode attributes: %w", err)
+		}
+		attributes = string(data)
+	}
+
+	flags, err := d.filters.Run(ctx, q)
+	if err != nil {
+		return q, nil, nil, err
+	}
+	return q, attributes, flags, nil
+}
+
+// insertQuestionTags associates questionID with tags, creating tags that do
+// not exist yet.
+func insertQuestionTags(ctx context.Context, tx *sql.Tx, questionID int64, tags []string) error {
+	for _, tag := range uniqueStrings(tags) {
+		// FOR UPDATE locks the tag row, or the index gap where it would
+		// go, so concurrent writers creating the same tag are serialized.
+		// The loser of a race sees a deadlock, which withTransaction
+		// retries, and then finds the committed tag.
+		var tagID int64
+		err := tx.QueryRowContext(ctx, "SELECT id FROM tags WHERE name = ? FOR UPDATE", tag).Scan(&tagID)
+		if err == sql.ErrNoRows {
+			result, err := tx.ExecContext(ctx, "INSERT INTO tags (name) VALUES (?)", tag)
+			if err != nil {
+				return fmt.Errorf("failed to insert tag: %w", err)
+			}
+			tagID, err = result.LastInsertId()
+			if err != nil {
+				return fmt.Errorf("failed to get tag ID: %w", err)
+			}
+		} else if err != nil {
+			return fmt.Errorf("failed to query tag: %w", err)
+		}
+
+		_, err = tx.ExecContext(ctx, "INSERT INTO question_tags (question_id, tag_id) VALUES (?, ?)",
+			questionID, tagID)
+		if err != nil {
+			return fmt.Errorf("failed to insert question tag: %w", err)
+		}
+	}
+	return nil
+}
+
+// reconcileQuestionTags removes the tag links of a question that are not in
+// tags and returns the tags the question is not linked to yet. Links that
+// stay are left untouched.
+func reconcileQuestionTags(ctx context.Context, tx *sql.Tx, questionID int, tags []string) ([]string, error) {
+	rows, err := tx.QueryContext(ctx, `
+        SELECT t.id, t.name
+        FROM question_tags qt
+        INNER JOIN tags t ON qt.tag_id = t.id
+        WHERE qt.question_id = ?`, questionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch question tags: %w", err)
+	}
+	current := map[string]int64{}
+	for rows.Next() {
+		var tagID int64
+		var name string
+		if err := rows.Scan(&tagID, &name); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to parse question tag: %w", err)
+		}
+		current[normalizeTagName(name)] = tagID
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read question tags: %w", err)
+	}
+
+	wanted := map[string]bool{}
+	var missing []string
+	for _, tag := range uniqueStrings(tags) {
+		name := normalizeTagName(tag)
+		if wanted[name] {
+			continue
+		}
+		wanted[name] = true
+		if _, ok := current[name]; !ok {
+			missing = append(missing, tag)
+		}
+	}
+
+	for name, tagID := range current {
+		if wanted[name] {
+			continue
+		}
+		_, err := tx.ExecContext(ctx, "DELETE FROM question_tags WHERE question_id = ? AND tag_id = ?", questionID, tagID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to remove question tag: %w", err)
+		}
+	}
+	return missing, nil
+}
+
+// insertQuestionFlags records the moderation flags raised for questionID.
+func insertQuestionFlags(ctx context.Context, tx *sql.Tx, questionID int64, flags []ContentFlag) error {
+	for _, flag := range flags {
+		_, err := tx.ExecContext(ctx, "INSERT INTO question_flags (question_id, filter, reason) VALUES (?, ?, ?)",
+			questionID, flag.Filter, flag.Reason)
+		if err != nil {
+			return fmt.Errorf("failed to record moderation flag: %w", err)
+		}
+	}
+	return nil
+}
+
+// DeleteQuestion removes a question together with its tag associations and
+// moderation flags in one transaction, or returns ErrQuestionNotFound if no
+// question has the given ID. With pruneTags, tags of the question that no
+// other question uses any more are deleted in the same transaction; tags
+// with aliases or translations are kept, since those still refer to them.
+// @Description Deletes a question and its join rows, optionally pruning orphaned tags
+// @Return error ErrQuestionNotFound or database error
+func (d *Database) DeleteQuestion(ctx context.Context, id int, pruneTags bool) error {
+	return d.withTransaction(ctx, func(tx *sql.Tx) error {
+		var tagIDs []interface{}
+		if pruneTags {
+			rows, err := tx.QueryContext(ctx, "SELECT tag_id FROM question_tags WHERE question_id = ?", id)
+			if err != nil {
+				return fmt.Errorf("failed to fetch question tags: %w", err)
+			}
+			for rows.Next() {
+				var tagID int64
+				if err := rows.Scan(&tagID); err != nil {
+					rows.Close()
+					return fmt.Errorf("failed to parse tag ID: %w", err)
+				}
+				tagIDs = append(tagIDs, tagID)
+			}
+			rows.Close()
+			if err := rows.Err(); err != nil {
+				return fmt.Errorf("failed to read question tags: %w", err)
+			}
+		}
+
+		if _, err := tx.ExecContext(ctx, "DELETE FROM question_tags WHERE question_id = ?", id); err != nil {
+			return fmt.Errorf("failed to delete question tags: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx, "DELETE FROM question_flags WHERE question_id = ?", id); err != nil {
+			return fmt.Errorf("failed to delete question flags: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx, "DELETE FROM question_search WHERE question_id = ?", id); err != nil {
+			return fmt.Errorf("failed to delete search entry: %w", err)
+		}
+
+		result, err := tx.ExecContext(ctx, "DELETE FROM questions WHERE id = ?", id)
+		if err != nil {
+			return fmt.Errorf("failed to delete question: %w", err)
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("failed to get affected rows: %w", err)
+		}
+		if affected == 0 {
+			return ErrQuestionNotFound
+		}
+
+		if len(tagIDs) > 0 {
+			_, err := tx.ExecContext(ctx, fmt.Sprintf(`
+                DELETE FROM tags
+                WHERE id IN (%s)
+                AND NOT EXISTS (SELECT 1 FROM question_tags qt WHERE qt.tag_id = tags.id)
+                AND NOT EXISTS (SELECT 1 FROM tag_aliases ta WHERE ta.tag_id = tags.id)
+                AND NOT EXISTS (SELECT 1 FROM tag_translations tt WHERE tt.tag_id = tags.id)`,
+				placeholders(len(tagIDs))), tagIDs...)
+			if err != nil {
+				return fmt.Errorf("failed to prune orphaned tags: %w", err)
+			}
+		}
+
+		return logChange(ctx, tx, ChangeDelete, int64(id))
+	})
+}
+
+// GetQuestionBatch returns up to limit questions with an ID greater than
+// afterID in ID order, without tags. It is used to walk the whole catalog in
+// resumable batches.
+func (d *Database) GetQuestionBatch(ctx context.Context, afterID int64, limit int) ([]Question, error) {
+	rows, err := d.db.QueryContext(ctx,
+		"SELECT id, language, type, task FROM questions WHERE id > ? ORDER BY id LIMIT ?", afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch question batch: %w", err)
+	}
+	defer rows.Close()
+
+	questions := []Question{}
+	for rows.Next() {
+		q := Question{Tags: []string{}}
+		if err := rows.Scan(&q.ID, &q.Language, &q.Type, &q.Task); err != nil {
+			return nil, fmt.Errorf("failed to parse question: %w", err)
+		}
+		questions = append(questions, q)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read question batch: %w", err)
+	}
+
+	return questions, nil
+}
+
+// FindQuestionIDsByKeyword returns the IDs of the questions whose task
+// contains keyword, case-insensitively under the column collation,
+// optionally restricted to a language
+func (d *Database) FindQuestionIDsByKeyword(ctx context.Context, keyword, language string) ([]int64, error) {
+	query := "SELECT id FROM questions WHERE task LIKE ? ESCAPE '!'"
+	args := []interface{}{likeContainsPattern(keyword)}
+	if language != "" {
+		query += " AND language = ?"
+		args = append(args, language)
+	}
+
+	rows, err := d.db.QueryContext(ctx, query+" ORDER BY id", args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find questions: %w", err)
+	}
+	defer rows.Close()
+
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to parse question ID: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read question IDs: %w", err)
+	}
+	return ids, nil
+}
+
+// AddQuestionTags adds tags to questions in one transaction, creating tags
+// that do not exist yet. Tags a question already carries are skipped. Every
+// question that gained a tag is recorded as updated in the change log, and
+// their number is returned.
+func (d *Database) AddQuestionTags(ctx context.Context, additions map[int64][]string) (int, error) {
+	var updated int
+	err := d.withTransaction(ctx, func(tx *sql.Tx) error {
+		updated = 0
+		tagIDs := map[string]int64{}
+		for questionID, tags := range additions {
+			changed := false
+			for _, tag := range uniqueStrings(tags) {
+				tagID, ok := tagIDs[strings.ToLower(tag)]
+				if !ok {
+					result, err := tx.ExecContext(ctx, "INSERT IGNORE INTO tags (name) VALUES (?)", tag)
+					if err != nil {
+						return fmt.Errorf("failed to insert tag: %w", err)
+					}
+					if n, _ := result.RowsAffected(); n > 0 {
+						tagID, err = result.LastInsertId()
+					} else {
+						err = tx.QueryRowContext(ctx, "SELECT id FROM tags WHERE name = ?", tag).Scan(&tagID)
+					}
+					if err != nil {
+						return fmt.Errorf("failed to query tag %q: %w", tag, err)
+					}
+					tagIDs[strings.ToLower(tag)] = tagID
+				}
+
+				result, err := tx.ExecContext(ctx,
+					"INSERT IGNORE INTO question_tags (question_id, tag_id) VALUES (?, ?)", questionID, tagID)
+				if err != nil {
+					return fmt.Errorf("failed to insert question tag: %w", err)
+				}
+				if n, _ := result.RowsAffected(); n > 0 {
+					changed = true
+				}
+			}
+
+			if changed {
+				if err := logChange(ctx, tx, ChangeUpdate, questionID); err != nil {
+					return err
+				}
+				updated++
+			}
+		}
+		return nil
+	})
+	return updated, err
+}
+
+// SetContentFilters installs the pipeline run on every question write. A nil
+// pipeline disables content filtering.
+func (d *Database) SetContentFilters(p *FilterPipeline) {
+	d.filters = p
+}
+
+// TaskExists reports whether a question other than excludeID with exactly
+// this task exists in the given language. Pass 0 to check all questions.
+func (d *Database) TaskExists(ctx context.Context, language, task string, excludeID int) (bool, error) {
+	var exists bool
+	err := d.db.QueryRowContext(ctx,
+		"SELECT EXISTS(SELECT 1 FROM questions WHERE language = ? AND task = ? AND id <> ?)", language, task, excludeID).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("failed to check for duplicate task: %w", err)
+	}
+	return exists, nil
+}
+
+// logChange records a question change in the change log as part of tx so the
+// entry is only visible if the change itself commits.
+func logChange(ctx context.Context, tx *sql.Tx, action string, questionID int64) error {
+	_, err := tx.ExecContext(ctx, "INSERT INTO change_log (action, entity_id) VALUES (?, ?)", action, questionID)
+	if err != nil {
+		return fmt.Errorf("failed to record change: %w", err)
+	}
+	return nil
+}
+
+// GetChanges returns change log entries with a sequence number greater than
+// sinceSeq, oldest first
+// @Description Reads the question change feed used for incremental client sync
+// @Return []ChangeLogEntry Up to limit entries ordered by sequence number
+// @Return error Query execution error
+func (d *Database) GetChanges(ctx context.Context, sinceSeq int64, limit int) ([]ChangeLogEntry, error) {
+	rows, err := d.db.QueryContext(ctx,
+		"SELECT seq, action, entity_id, occurred_at FROM change_log WHERE seq > ? ORDER BY seq LIMIT ?",
+		sinceSeq, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch changes: %w", err)
+	}
+	defer rows.Close()
+
+	changes := []ChangeLogEntry{}
+	for rows.Next() {
+		var c ChangeLogEntry
+		if err := rows.Scan(&c.Seq, &c.Action, &c.EntityID, &c.OccurredAt); err != nil {
+			return nil, fmt.Errorf("failed to parse change: %w", err)
+		}
+		changes = append(changes, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read changes: %w", err)
+	}
+
+	return changes, nil
+}
+
+// WithNamedLock runs fn while holding the MySQL named lock name, which is
+// shared by every replica using the database. If another session holds the
+// lock, fn is not run and acquired is false. The lock lives on a dedicated
+// connection and is released when fn returns.
+func (d *Database) WithNamedLock(ctx context.Context, name string, fn func() error) (acquired bool, err error) {
+	conn, err := d.db.Conn(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer conn.Close()
+
+	var got sql.NullInt64
+	if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, 0)", name).Scan(&got); err != nil {
+		return false, fmt.Errorf("failed to acquire lock %q: %w", name, err)
+	}
+	if got.Int64 != 1 {
+		return false, nil
+	}
+	defer conn.ExecContext(context.Background(), "SELECT RELEASE_LOCK(?)", name)
+
+	return true, fn()
+}
+
+// requiredTables lists the tables the API expects to exist.
+var requiredTables = []string{"questions", "tags", "tag_aliases", "question_tags", "question_search", "question_flags", "change_log", "share_links", "games", "import_sources", "sync_state", "sync_questions", "tag_translations"}
+
+// SaveShareLink stores the filters behind a share link under token
+func (d *Database) SaveShareLink(ctx context.Context, token, filtersJSON string) error {
+	_, err := d.db.ExecContext(ctx, "INSERT INTO share_links (token, filters) VALUES (?, ?)", token, filtersJSON)
+	if err != nil {
+		return fmt.Errorf("failed to save share link: %w", err)
+	}
+	return nil
+}
+
+// SaveGame stores the filters and deck seed of a game under code until
+// expiresAt. Expired games are purged on the way.
+func (d *Database) SaveGame(ctx context.Context, code, filtersJSON string, seed int64, expiresAt time.Time) error {
+	if _, err := d.db.ExecContext(ctx, "DELETE FROM games WHERE expires_at <= NOW()"); err != nil {
+		return fmt.Errorf("failed to purge expired games: %w", err)
+	}
+	_, err := d.db.ExecContext(ctx, "INSERT INTO games (code, filters, seed, expires_at) VALUES (?, ?, ?, ?)",
+		code, filtersJSON, seed, expiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to save game: %w", err)
+	}
+	return nil
+}
+
+// GetGame returns the filters, seed and expiry stored under code. It returns
+// sql.ErrNoRows if the code does not exist or has expired.
+func (d *Database) GetGame(ctx context.Context, code string) (string, int64, time.Time, error) {
+	var filtersJSON string
+	var seed int64
+	var expiresAt time.Time
+	err := d.db.QueryRowContext(ctx,
+		"SELECT filters, seed, expires_at FROM games WHERE code = ? AND expires_at > NOW()", code).
+		Scan(&filtersJSON, &seed, &expiresAt)
+	if err != nil {
+		return "", 0, time.Time{}, fmt.Errorf("failed to look up game %q: %w", code, err)
+	}
+	return filtersJSON, seed, expiresAt, nil
+}
+
+// GetImportSource returns the ETag and Last-Modified validators stored for
+// the last import from url, or empty strings if it was never imported.
+func (d *Database) GetImportSource(ctx context.Context, url string) (etag, lastModified string, err error) {
+	err = d.db.QueryRowContext(ctx,
+		"SELECT etag, last_modified FROM import_sources WHERE url_hash = ?", urlKey(url)).
+		Scan(&etag, &lastModified)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", "", nil
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("failed to look up import source: %w", err)
+	}
+	return etag, lastModified, nil
+}
+
+// SaveImportSource records the validators of the document just imported
+// from url, replacing those of earlier imports.
+func (d *Database) SaveImportSource(ctx context.Context, url, etag, lastModified string) error {
+	_, err := d.db.ExecContext(ctx,
+		`INSERT INTO import_sources (url_hash, url, etag, last_modified) VALUES (?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE etag = VALUES(etag), last_modified = VALUES(last_modified)`,
+		urlKey(url), url, etag, lastModified)
+	if err != nil {
+		return fmt.Errorf("failed to save import source: %w", err)
+	}
+	return nil
+}
+
+// urlKey returns the key under which url is stored in import_sources and
+// the sync tables; URLs are too long to index directly.
+func urlKey(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return hex.EncodeToString(sum[:])
+}
+
+// Ping verifies the database connection is alive
+func (d *Database) Ping(ctx context.Context) error {
+	return d.db.PingContext(ctx)
+}
+
+// CheckSchema verifies that every table the API depends on exists in the
+// connected database
+func (d *Database) CheckSchema(ctx context.Context) error {
+	for _, table := range requiredTables {
+		var count int
+		err := d.db.QueryRowContext(ctx,
+			"SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = DATABASE() AND table_name = ?",
+			table).Scan(&count)
+		if err != nil {
+			return fmt.Errorf("failed to inspect schema: %w", err)
+		}
+		if count == 0 {
+			return fmt.Errorf("missing table %q", table)
+		}
+	}
+	return nil
+}
+
+// CheckReadPath runs a trivial read query against the questions table
+func (d *Database) CheckReadPath(ctx context.Context) error {
+	var count int
+	if err := d.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM questions").Scan(&count); err != nil {
+		return fmt.Errorf("failed to read questions: %w", err)
+	}
+	return nil
+}
+
+// BeginTx starts a transaction on the underlying connection pool, for
+// callers that need control beyond withTransaction, such as savepoints. The
+// caller must commit or roll it back; nothing is retried.
+func (d *Database) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+	return d.db.BeginTx(ctx, opts)
+}
+
+// CheckWritePath inserts a temporary question inside a transaction and rolls
+// it back, proving the connected user can write without leaving data behind
+func (d *Database) CheckWritePath(ctx context.Context) error {
+	tx, err := d.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, "INSERT INTO questions (language, type, task) VALUES (?, ?, ?)",
+		"xx", "truth", "selftest")
+	if err != nil {
+		return fmt.Errorf("failed to insert question: %w", err)
+	}
+	return nil
 }
 
 // Close terminates the database connection
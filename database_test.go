@@ -0,0 +1,517 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// compactSQL collapses the whitespace of a query so tests can compare the
+// SQL without depending on its indentation.
+func compactSQL(query string) string {
+	return strings.Join(strings.Fields(query), " ")
+}
+
+// selectQuestions is the compacted start of every full question query.
+const selectQuestions = "SELECT q.id, q.language, q.type, q.task, q.dare_target, q.attributes, q.available_from, q.available_until, " +
+	"GROUP_CONCAT(t.name SEPARATOR '" + listSeparator + "') as tags FROM questions q " +
+	"LEFT JOIN question_tags qt ON q.id = qt.question_id LEFT JOIN tags t ON qt.tag_id = t.id"
+
+func TestDatabaseDSNRaisesGroupConcatLimit(t *testing.T) {
+	t.Setenv("MYSQL_USER", "app")
+	t.Setenv("MYSQL_PASSWORD", "secret")
+	t.Setenv("MYSQL_HOST", "db.internal")
+	t.Setenv("MYSQL_PORT", "3306")
+	t.Setenv("MYSQL_DATABASE", "truth_or_dare_db")
+
+	cfg, err := mysql.ParseDSN(databaseDSN())
+	if err != nil {
+		t.Fatalf("ParseDSN() error = %v", err)
+	}
+	if cfg.Addr != "db.internal:3306" || cfg.DBName != "truth_or_dare_db" || cfg.User != "app" {
+		t.Errorf("DSN = %s@%s/%s", cfg.User, cfg.Addr, cfg.DBName)
+	}
+	// The driver sends every DSN parameter it does not know as a SET on
+	// each new connection.
+	if got := cfg.Params["group_concat_max_len"]; got != strconv.FormatUint(groupConcatMaxLen, 10) {
+		t.Errorf("group_concat_max_len = %q, want %d", got, groupConcatMaxLen)
+	}
+}
+
+func TestBuildQuestionsQuery(t *testing.T) {
+	const tagMatch = " INNER JOIN ( SELECT qt.question_id FROM question_tags qt INNER JOIN tags t ON qt.tag_id = t.id WHERE "
+	const tagMatchEnd = " ) matching_tags ON q.id = matching_tags.question_id"
+	const excludeMatch = "NOT EXISTS ( SELECT 1 FROM question_tags xqt INNER JOIN tags xt ON xqt.tag_id = xt.id WHERE xqt.question_id = q.id AND ("
+
+	tests := []struct {
+		name     string
+		filters  FilterSet
+		wantSQL  string
+		wantArgs []interface{}
+	}{
+		{
+			name:     "no filters",
+			wantSQL:  selectQuestions + " GROUP BY q.id",
+			wantArgs: []interface{}{},
+		},
+		{
+			name:     "language and type",
+			filters:  FilterSet{Language: "de", Type: "truth"},
+			wantSQL:  selectQuestions + " WHERE q.language = ? AND q.type = ? GROUP BY q.id",
+			wantArgs: []interface{}{"de", "truth"},
+		},
+		{
+			name:     "any tag",
+			filters:  FilterSet{Tags: []string{"funny", "party"}},
+			wantSQL:  selectQuestions + tagMatch + "t.name IN (?,?) GROUP BY qt.question_id" + tagMatchEnd + " GROUP BY q.id",
+			wantArgs: []interface{}{"funny", "party"},
+		},
+		{
+			name:     "all tags",
+			filters:  FilterSet{Tags: []string{"funny", "party"}, MatchAllTags: true},
+			wantSQL:  selectQuestions + tagMatch + "t.name IN (?,?) GROUP BY qt.question_id HAVING COUNT(DISTINCT t.name) = ?" + tagMatchEnd + " GROUP BY q.id",
+			wantArgs: []interface{}{"funny", "party", 2},
+		},
+		{
+			name:     "duplicate tags count once",
+			filters:  FilterSet{Tags: []string{"funny", "Funny", "party"}, MatchAllTags: true},
+			wantSQL:  selectQuestions + tagMatch + "t.name IN (?,?) GROUP BY qt.question_id HAVING COUNT(DISTINCT t.name) = ?" + tagMatchEnd + " GROUP BY q.id",
+			wantArgs: []interface{}{"funny", "party", 2},
+		},
+		{
+			name:     "wildcard and exact tag, any",
+			filters:  FilterSet{Tags: []string{"location:*", "funny"}},
+			wantSQL:  selectQuestions + tagMatch + "t.name IN (?) OR t.name LIKE ? ESCAPE '!' GROUP BY qt.question_id" + tagMatchEnd + " GROUP BY q.id",
+			wantArgs: []interface{}{"funny", "location:%"},
+		},
+		{
+			name:    "wildcard and exact tag, all",
+			filters: FilterSet{Tags: []string{"location:*", "funny"}, MatchAllTags: true},
+			wantSQL: selectQuestions + tagMatch + "t.name IN (?) OR t.name LIKE ? ESCAPE '!' GROUP BY qt.question_id " +
+				"HAVING COUNT(DISTINCT CASE WHEN t.name IN (?) THEN t.name END) = ? AND MAX(t.name LIKE ? ESCAPE '!') = 1" + tagMatchEnd + " GROUP BY q.id",
+			wantArgs: []interface{}{"funny", "location:%", "funny", 1, "location:%"},
+		},
+		{
+			name:     "wildcard only, all",
+			filters:  FilterSet{Tags: []string{"location:*"}, MatchAllTags: true},
+			wantSQL:  selectQuestions + tagMatch + "t.name LIKE ? ESCAPE '!' GROUP BY qt.question_id HAVING MAX(t.name LIKE ? ESCAPE '!') = 1" + tagMatchEnd + " GROUP BY q.id",
+			wantArgs: []interface{}{"location:%", "location:%"},
+		},
+		{
+			name:     "wildcard escapes LIKE metacharacters",
+			filters:  FilterSet{Tags: []string{"100%_*"}},
+			wantSQL:  selectQuestions + tagMatch + "t.name LIKE ? ESCAPE '!' GROUP BY qt.question_id" + tagMatchEnd + " GROUP BY q.id",
+			wantArgs: []interface{}{"100!%!_%"},
+		},
+		{
+			name:     "exclude tags",
+			filters:  FilterSet{ExcludeTags: []string{"nsfw", "drink*"}},
+			wantSQL:  selectQuestions + " WHERE " + excludeMatch + "xt.name IN (?) OR xt.name LIKE ? ESCAPE '!')) GROUP BY q.id",
+			wantArgs: []interface{}{"nsfw", "drink%"},
+		},
+		{
+			name:     "excluded tag also requested, any",
+			filters:  FilterSet{Tags: []string{"funny", "nsfw"}, ExcludeTags: []string{"nsfw"}},
+			wantSQL:  selectQuestions + tagMatch + "t.name IN (?,?) GROUP BY qt.question_id" + tagMatchEnd + " WHERE " + excludeMatch + "xt.name IN (?))) GROUP BY q.id",
+			wantArgs: []interface{}{"funny", "nsfw", "nsfw"},
+		},
+		{
+			name:    "excluded wildcard overlapping requested wildcard, all",
+			filters: FilterSet{Tags: []string{"drink*"}, ExcludeTags: []string{"drink:strong*"}, MatchAllTags: true},
+			wantSQL: selectQuestions + tagMatch + "t.name LIKE ? ESCAPE '!' GROUP BY qt.question_id HAVING MAX(t.name LIKE ? ESCAPE '!') = 1" + tagMatchEnd +
+				" WHERE " + excludeMatch + "xt.name LIKE ? ESCAPE '!')) GROUP BY q.id",
+			wantArgs: []interface{}{"drink%", "drink%", "drink:strong%"},
+		},
+		{
+			name:    "everything together",
+			filters: FilterSet{Language: "de", Type: "truth", Tags: []string{"funny", "party"}, ExcludeTags: []string{"nsfw"}, MatchAllTags: true},
+			wantSQL: selectQuestions + tagMatch + "t.name IN (?,?) GROUP BY qt.question_id HAVING COUNT(DISTINCT t.name) = ?" + tagMatchEnd +
+				" WHERE q.language = ? AND q.type = ? AND " + excludeMatch + "xt.name IN (?))) GROUP BY q.id",
+			wantArgs: []interface{}{"funny", "party", 2, "de", "truth", "nsfw"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.filters.IncludeScheduled = true
+			query, args := buildQuestionsQuery(tt.filters, QueryOptions{})
+
+			if got := compactSQL(query); got != tt.wantSQL {
+				t.Errorf("SQL:\n got %s\nwant %s", got, tt.wantSQL)
+			}
+			if !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("args = %#v, want %#v", args, tt.wantArgs)
+			}
+			if n := strings.Count(query, "?"); n != len(args) {
+				t.Errorf("%d placeholders but %d args", n, len(args))
+			}
+		})
+	}
+}
+
+// TestBuildQuestionsQueryMatchesTagsOncePerQuestion guards against a
+// question carrying several of the requested tags being returned once per
+// matching tag: the tag match is grouped by question before it is joined,
+// and the outer query never filters on the joined tag rows.
+func TestBuildQuestionsQueryMatchesTagsOncePerQuestion(t *testing.T) {
+	query, _ := buildQuestionsQuery(FilterSet{Tags: []string{"funny", "party"}, IncludeScheduled: true}, QueryOptions{})
+	query = compactSQL(query)
+
+	subquery, outer, ok := strings.Cut(query, " ) matching_tags ON q.id = matching_tags.question_id")
+	if !ok {
+		t.Fatalf("tags are not matched in a subquery:\n%s", query)
+	}
+	if !strings.HasSuffix(subquery, "WHERE t.name IN (?,?) GROUP BY qt.question_id") {
+		t.Errorf("tag subquery is not grouped by question:\n%s", subquery)
+	}
+	if strings.Contains(outer, "t.name") {
+		t.Errorf("outer query filters on tag rows:\n%s", outer)
+	}
+	if outer != " GROUP BY q.id" {
+		t.Errorf("outer query = %q, want one row per question", outer)
+	}
+}
+
+func TestBuildQuestionsQueryOptions(t *testing.T) {
+	query, args := buildQuestionsQuery(FilterSet{Language: "en", IncludeScheduled: true}, QueryOptions{Fields: []string{"task"}, Limit: 20, Offset: 40})
+
+	want := "SELECT q.id, '', '', q.task, NULL, NULL, NULL, NULL, NULL as tags FROM questions q WHERE q.language = ? GROUP BY q.id ORDER BY q.id LIMIT ? OFFSET ?"
+	if got := compactSQL(query); got != want {
+		t.Errorf("SQL:\n got %s\nwant %s", got, want)
+	}
+	if wantArgs := []interface{}{"en", 20, 40}; !reflect.DeepEqual(args, wantArgs) {
+		t.Errorf("args = %#v, want %#v", args, wantArgs)
+	}
+}
+
+func TestBuildQuestionsQueryHidesScheduledQuestions(t *testing.T) {
+	query, args := buildQuestionsQuery(FilterSet{}, QueryOptions{})
+
+	want := selectQuestions + " WHERE (q.available_from IS NULL OR q.available_from <= ?) AND (q.available_until IS NULL OR q.available_until > ?) GROUP BY q.id"
+	if got := compactSQL(query); got != want {
+		t.Errorf("SQL:\n got %s\nwant %s", got, want)
+	}
+	if len(args) != 2 || args[0] != args[1] {
+		t.Errorf("args = %#v, want the same timestamp twice", args)
+	}
+}
+
+func TestBuildQuestionsQuerySearch(t *testing.T) {
+	const (
+		matchCondition   = "MATCH(search_tokens) AGAINST (? IN BOOLEAN MODE)"
+		literalCondition = "q.task LIKE ? ESCAPE '!'"
+	)
+	tests := []struct {
+		search      string
+		wantMatch   string
+		wantLiteral string
+	}{
+		{"fear", "fear*", "fear%"},
+		{"Biggest Fear", "biggest* fear*", "Biggest Fear%"},
+		{"fear of the dark", "fear* dark*", "fear of the dark%"},
+		{"50%", "50*", "%50!%%"},
+		{"#party", "party*", "%#party%"},
+		{"what's up", "what* s* up*", "%what's up%"},
+		{"go", "go*", "%go%"},
+		{"the", "", "%the%"},
+		{"under_score", "under* score*", "%under!_score%"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.search, func(t *testing.T) {
+			query, args := buildQuestionsQuery(FilterSet{Search: tt.search, IncludeScheduled: true}, QueryOptions{})
+
+			if got := strings.Contains(query, matchCondition); got != (tt.wantMatch != "") {
+				t.Fatalf("query uses the search index = %v, want %v:\n%s", got, tt.wantMatch != "", query)
+			}
+			if !strings.Contains(query, literalCondition) {
+				t.Fatalf("query has no task LIKE:\n%s", query)
+			}
+
+			want := []interface{}{tt.wantLiteral}
+			if tt.wantMatch != "" {
+				want = []interface{}{tt.wantMatch, tt.wantLiteral}
+			}
+			if len(args) != len(want) {
+				t.Fatalf("args = %v, want %v", args, want)
+			}
+			for i := range want {
+				if args[i] != want[i] {
+					t.Errorf("arg %d = %v, want %v", i, args[i], want[i])
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkGetQuestionsFields compares reading full questions with reading
+// only the fields of fields=id,tags, for which the database sends empty
+// placeholders in the other columns.
+func BenchmarkGetQuestionsFields(b *testing.B) {
+	const n = maxQuestionsLimit
+	availableFrom := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		fields []string
+		row    func(i int) []driver.Value
+	}{
+		{"all", nil, func(i int) []driver.Value {
+			return []driver.Value{int64(i + 1), "en", "dare", "Sing the chorus of your favourite song out loud", "the player to your left",
+				`{"intensity": 2}`, availableFrom, nil, "funny" + listSeparator + "party" + listSeparator + "social"}
+		}},
+		{"id,tags", []string{"id", "tags"}, func(i int) []driver.Value {
+			return []driver.Value{int64(i + 1), "", "", "", nil, nil, nil, nil, "funny" + listSeparator + "party" + listSeparator + "social"}
+		}},
+	}
+	for _, tt := range tests {
+		b.Run(tt.name, func(b *testing.B) {
+			rows := questionRows()
+			for i := 0; i < n; i++ {
+				rows.Values = append(rows.Values, tt.row(i))
+			}
+			mock := NewMockDB(b)
+			mock.Query = func(string, []driver.Value) (*MockRows, error) {
+				return &MockRows{Columns: rows.Columns, Values: rows.Values}, nil
+			}
+			d := &Database{db: mock}
+			opts := QueryOptions{Fields: tt.fields, Limit: n}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				questions, err := d.GetQuestions(context.Background(), FilterSet{Language: "en"}, opts)
+				if err != nil || len(questions) != n {
+					b.Fatalf("GetQuestions() = %d questions, %v", len(questions), err)
+				}
+			}
+		})
+	}
+}
+
+// questionRows returns MockRows in the column order of scanQuestion with
+// one question per tag list.
+func questionRows(tagLists ...string) *MockRows {
+	rows := &MockRows{Columns: []string{"id", "language", "type", "task", "dare_target", "attributes", "available_from", "available_until", "tags"}}
+	for i, tags := range tagLists {
+		rows.Values = append(rows.Values, []driver.Value{int64(i + 1), "en", "truth", "What is your biggest fear?", nil, nil, nil, nil, tags})
+	}
+	return rows
+}
+
+func TestGetQuestionsSplitsTagLists(t *testing.T) {
+	mock := NewMockDB(t)
+	mock.Query = func(string, []driver.Value) (*MockRows, error) {
+		return questionRows("funny"+listSeparator+"party", "legacy,tag"+listSeparator+"deep"), nil
+	}
+	d := &Database{db: mock}
+
+	questions, err := d.GetQuestions(context.Background(), FilterSet{}, QueryOptions{})
+	if err != nil {
+		t.Fatalf("GetQuestions() error = %v", err)
+	}
+	want := [][]string{{"funny", "party"}, {"legacy,tag", "deep"}}
+	if len(questions) != len(want) {
+		t.Fatalf("got %d questions, want %d", len(questions), len(want))
+	}
+	for i, q := range questions {
+		if !reflect.DeepEqual(q.Tags, want[i]) {
+			t.Errorf("question %d tags = %q, want %q", q.ID, q.Tags, want[i])
+		}
+	}
+}
+
+func TestGetQuestionsStopsWhenCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	const total = 5 * cancelCheckInterval
+	var read atomic.Int64
+	mock := NewMockDB(t)
+	mock.Query = func(string, []driver.Value) (*MockRows, error) {
+		tags := make([]string, total)
+		for i := range tags {
+			tags[i] = "party"
+		}
+		rows := questionRows(tags...)
+		rows.OnRow = func(n int) {
+			read.Add(1)
+			if n == 0 {
+				cancel()
+			}
+		}
+		return rows, nil
+	}
+	d := &Database{db: mock}
+
+	questions, err := d.GetQuestions(ctx, FilterSet{}, QueryOptions{})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("GetQuestions() = %d questions, error %v; want context.Canceled", len(questions), err)
+	}
+	// The context is checked every cancelCheckInterval rows, so at most one
+	// interval is read after cancelling.
+	if n := read.Load(); n > cancelCheckInterval+1 {
+		t.Errorf("read %d of %d rows after cancelling, want at most %d", n, total, cancelCheckInterval+1)
+	}
+}
+
+func TestReadErrorsArePropagated(t *testing.T) {
+	lost := errors.New("invalid connection")
+
+	t.Run("GetQuestions", func(t *testing.T) {
+		mock := NewMockDB(t)
+		mock.Query = func(string, []driver.Value) (*MockRows, error) {
+			rows := questionRows("funny", "party")
+			rows.Err = lost
+			return rows, nil
+		}
+		d := &Database{db: mock}
+
+		questions, err := d.GetQuestions(context.Background(), FilterSet{}, QueryOptions{})
+		if !errors.Is(err, lost) {
+			t.Fatalf("GetQuestions() error = %v, want %v", err, lost)
+		}
+		if questions != nil {
+			t.Errorf("GetQuestions() returned %d questions with the error", len(questions))
+		}
+	})
+
+	t.Run("GetTags", func(t *testing.T) {
+		mock := NewMockDB(t)
+		mock.Query = func(string, []driver.Value) (*MockRows, error) {
+			return &MockRows{Columns: []string{"name"}, Values: [][]driver.Value{{"funny"}, {"party"}}, Err: lost}, nil
+		}
+		d := &Database{db: mock}
+
+		tags, err := d.GetTags(context.Background(), "name", "asc")
+		if !errors.Is(err, lost) {
+			t.Fatalf("GetTags() error = %v, want %v", err, lost)
+		}
+		if tags != nil {
+			t.Errorf("GetTags() returned %v with the error", tags)
+		}
+	})
+}
+
+func TestAddQuestionValidatesInput(t *testing.T) {
+	target := "left neighbour"
+	tests := []struct {
+		name     string
+		question Question
+		wantErr  error
+	}{
+		{"missing language", Question{Type: "truth", Task: "What scares you?"}, ErrMissingLanguage},
+		{"blank language", Question{Language: "  ", Type: "truth", Task: "What scares you?"}, ErrMissingLanguage},
+		{"missing type", Question{Language: "en", Task: "What scares you?"}, ErrMissingType},
+		{"missing task", Question{Language: "en", Type: "truth"}, ErrMissingTask},
+		{"whitespace task", Question{Language: "en", Type: "truth", Task: " \t\n"}, ErrMissingTask},
+		{"dare target on truth", Question{Language: "en", Type: "truth", Task: "What scares you?", DareTarget: &target}, ErrInvalidFieldForType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := NewMockDB(t)
+			d := &Database{db: mock}
+
+			id, err := d.AddQuestion(context.Background(), tt.question)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("AddQuestion() error = %v, want %v", err, tt.wantErr)
+			}
+			if id != 0 {
+				t.Errorf("AddQuestion() id = %d, want 0", id)
+			}
+			if statements := mock.Statements(); len(statements) != 0 {
+				t.Errorf("invalid question reached the database: %v", statements)
+			}
+		})
+	}
+}
+
+func TestAddQuestionKeepsDriverErrors(t *testing.T) {
+	tests := []struct {
+		number        uint16
+		wantTransient bool
+	}{
+		{mysqlErrDuplicateEntry, false},
+		{mysqlErrDeadlock, true},
+		{mysqlErrLockWaitTimeout, true},
+	}
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(int(tt.number)), func(t *testing.T) {
+			driverErr := &mysql.MySQLError{Number: tt.number, Message: "from the server"}
+			mock := NewMockDB(t)
+			mock.Exec = func(query string, args []driver.Value) (driver.Result, error) {
+				return nil, driverErr
+			}
+			d := &Database{db: mock}
+
+			_, err := d.AddQuestion(context.Background(), Question{Language: "en", Type: "truth", Task: "What scares you?"})
+
+			if !errors.Is(err, driverErr) {
+				t.Fatalf("AddQuestion() error = %v, want it to wrap %v", err, driverErr)
+			}
+			var mysqlErr *mysql.MySQLError
+			if !errors.As(err, &mysqlErr) || mysqlErr.Number != tt.number {
+				t.Errorf("errors.As found %v, want MySQL error %d", mysqlErr, tt.number)
+			}
+			var transientErr *TransientError
+			if got := errors.As(err, &transientErr); got != tt.wantTransient {
+				t.Errorf("transient = %v, want %v", got, tt.wantTransient)
+			}
+		})
+	}
+}
+
+func TestAddQuestionStopsWhenCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mock := NewMockDB(t)
+	mock.Exec = func(query string, args []driver.Value) (driver.Result, error) {
+		if strings.HasPrefix(query, "INSERT INTO questions ") {
+			cancel()
+		}
+		return MockResult{LastID: 1, Affected: 1}, nil
+	}
+	d := &Database{db: mock}
+
+	_, err := d.AddQuestion(ctx, Question{Language: "en", Type: "truth", Task: "What scares you?", Tags: []string{"funny"}})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("AddQuestion() error = %v, want context.Canceled", err)
+	}
+	for _, statement := range mock.Statements() {
+		if strings.Contains(statement, "tags") || strings.Contains(statement, "change_log") {
+			t.Errorf("ran %q after the context was cancelled", statement)
+		}
+	}
+}
+
+func TestAddQuestionNormalizesLanguage(t *testing.T) {
+	for _, language := range []string{"en", "EN", "En", "en-US", "en_gb"} {
+		t.Run(language, func(t *testing.T) {
+			var inserted []driver.Value
+			mock := NewMockDB(t)
+			mock.Exec = func(query string, args []driver.Value) (driver.Result, error) {
+				if strings.HasPrefix(query, "INSERT INTO questions ") {
+					inserted = args
+				}
+				return MockResult{LastID: 1, Affected: 1}, nil
+			}
+			d := &Database{db: mock}
+
+			if _, err := d.AddQuestion(context.Background(), Question{Language: language, Type: "truth", Task: "What scares you?"}); err != nil {
+				t.Fatalf("AddQuestion() error = %v", err)
+			}
+			if len(inserted) == 0 {
+				t.Fatal("no question inserted")
+			}
+			if inserted[0] != "en" {
+				t.Errorf("inserted language = %v, want en", inserted[0])
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"sort"
+)
+
+// maxDiagnosedTags is the largest tag filter that is diagnosed tag by tag.
+// Larger tag filters are diagnosed as a whole to bound the number of COUNT
+// queries.
+const maxDiagnosedTags = 10
+
+// FilterRelaxation reports how many questions match when one filter is
+// dropped
+// @Description Effect of removing a single filter from an empty query
+type FilterRelaxation struct {
+	// Filter that was dropped: language, type, tag, tags, excludeTags,
+	// matchAllTags, has_dare_target, search, attr.<key> or includeScheduled
+	// (the availability window)
+	// @example "tag"
+	Filter string `json:"filter"`
+
+	// Value of the dropped filter
+	// @example "romantic"
+	Value interface{} `json:"value"`
+
+	// Number of questions matching without this filter
+	// @example 12
+	Count int `json:"count"`
+}
+
+// EmptyResultDiagnostics explains why a filtered query matched nothing
+// @Description Per-filter counts that show which filter over-constrains a query
+type EmptyResultDiagnostics struct {
+	// One entry per applied filter
+	Relaxations []FilterRelaxation `json:"relaxations"`
+}
+
+// ExplainedQuestionsResponse is returned instead of a plain array when
+// explain=true and nothing matched
+// @Description An empty question list together with zero-result diagnostics
+type ExplainedQuestionsResponse struct {
+	// Always empty
+	Questions []Question `json:"questions"`
+
+	// Counts with each filter dropped in turn
+	Diagnostics EmptyResultDiagnostics `json:"diagnostics"`
+
+	// NOT_FOUND when the response is sent with status 404
+	// @example "NOT_FOUND"
+	Code string `json:"code,omitempty"`
+}
+
+// diagnoseEmptyResult counts the questions that would match if each applied
+// filter were dropped on its own. It issues one COUNT query per filter, so it
+// must only be called for queries that already came back empty.
+func diagnoseEmptyResult(ctx context.Context, d *Database, filters FilterSet) (EmptyResultDiagnostics, error) {
+	type candidate struct {
+		filter  string
+		value   interface{}
+		relaxed FilterSet
+	}
+	var candidates []candidate
+
+	if filters.Language != "" {
+		relaxed := filters
+		relaxed.Language = ""
+		candidates = append(candidates, candidate{"language", filters.Language, relaxed})
+	}
+
+	if filters.Type != "" {
+		relaxed := filters
+		relaxed.Type = ""
+		candidates = append(candidates, candidate{"type", filters.Type, relaxed})
+	}
+
+	tags := uniqueStrings(filters.Tags)
+	switch {
+	case len(tags) == 1 || len(tags) > maxDiagnosedTags:
+		relaxed := filters
+		relaxed.Tags = nil
+		candidates = append(candidates, candidate{"tags", tags, relaxed})
+	case len(tags) > 1:
+		for i, tag := range tags {
+			relaxed := filters
+			relaxed.Tags = append(append([]string{}, tags[:i]...), tags[i+1:]...)
+			candidates = append(candidates, candidate{"tag", tag, relaxed})
+		}
+	}
+	if filters.MatchAllTags && len(tags) > 1 {
+		relaxed := filters
+		relaxed.MatchAllTags = false
+		candidates = append(candidates, candidate{"matchAllTags", true, relaxed})
+	}
+
+	if excludeTags := uniqueStrings(filters.ExcludeTags); len(excludeTags) > 0 {
+		relaxed := filters
+		relaxed.ExcludeTags = nil
+		candidates = append(candidates, candidate{"excludeTags", excludeTags, relaxed})
+	}
+
+	if filters.HasDareTarget != nil {
+		relaxed := filters
+		relaxed.HasDareTarget = nil
+		candidates = append(candidates, candidate{"has_dare_target", *filters.HasDareTarget, relaxed})
+	}
+
+	if filters.Search != "" {
+		relaxed := filters
+		relaxed.Search = ""
+		candidates = append(candidates, candidate{"search", filters.Search, relaxed})
+	}
+
+	// Seasonal questions may be the only matches.
+	if !filters.IncludeScheduled {
+		relaxed := filters
+		relaxed.IncludeScheduled = true
+		candidates = append(candidates, candidate{"includeScheduled", false, relaxed})
+	}
+
+	attributeKeys := make([]string, 0, len(filters.Attributes))
+	for key := range filters.Attributes {
+		attributeKeys = append(attributeKeys, key)
+	}
+	sort.Strings(attributeKeys)
+	for _, key := range attributeKeys {
+		relaxed := filters
+		relaxed.Attributes = make(map[string]interface{}, len(filters.Attributes)-1)
+		for k, v := range filters.Attributes {
+			if k != key {
+				relaxed.Attributes[k] = v
+			}
+		}
+		candidates = append(candidates, candidate{"attr." + key, filters.Attributes[key], relaxed})
+	}
+
+	diagnostics := EmptyResultDiagnostics{Relaxations: []FilterRelaxation{}}
+	for _, c := range candidates {
+		count, err := d.CountQuestions(ctx, c.relaxed)
+		if err != nil {
+			return EmptyResultDiagnostics{}, err
+		}
+		diagnostics.Relaxations = append(diagnostics.Relaxations, FilterRelaxation{Filter: c.filter, Value: c.value, Count: count})
+	}
+	return diagnostics, nil
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// csvExportHeader is the header row of CSV exports.
+var csvExportHeader = []string{"id", "language", "type", "task", "tags"}
+
+// sqlEscaper escapes string literals the same way MySQL's
+// mysql_real_escape_string does.
+var sqlEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	`'`, `\'`,
+	"\x00", `\0`,
+	"\n", `\n`,
+	"\r", `\r`,
+	"\x1a", `\Z`,
+)
+
+// sqlQuote returns s as a single-quoted MySQL string literal.
+func sqlQuote(s string) string {
+	return "'" + sqlEscaper.Replace(s) + "'"
+}
+
+// sqlDatetime returns t as a MySQL DATETIME literal in local time, matching
+// how the driver stores times, or NULL if t is nil.
+func sqlDatetime(t *time.Time) string {
+	if t == nil {
+		return "NULL"
+	}
+	return sqlQuote(t.Local().Format("2006-01-02 15:04:05"))
+}
+
+// writeSQLExport writes questions as a MySQL script that recreates them, and
+// their tag associations, in an empty or existing database. Question IDs are
+// not preserved; each tag link refers to the row just inserted.
+func writeSQLExport(w io.Writer, questions []Question) error {
+	bw := bufio.NewWriter(w)
+
+	fmt.Fprintln(bw, "SET NAMES utf8mb4;")
+	fmt.Fprintln(bw, "SET FOREIGN_KEY_CHECKS=0;")
+	fmt.Fprintln(bw)
+
+	for _, q := range questions {
+		dareTarget := "NULL"
+		if q.DareTarget != nil {
+			dareTarget = sqlQuote(*q.DareTarget)
+		}
+		attributes := "NULL"
+		if len(q.Attributes) > 0 {
+			data, err := json.Marshal(q.Attributes)
+			if err != nil {
+				return fmt.Errorf("failed to encode attributes: %w", err)
+			}
+			attributes = sqlQuote(string(data))
+		}
+		fmt.Fprintf(bw, "INSERT INTO questions (language, type, task, dare_target, attributes, available_from, available_until) VALUES (%s,%s,%s,%s,%s,%s,%s);\n",
+			sqlQuote(q.Language), sqlQuote(q.Type), sqlQuote(q.Task), dareTarget, attributes,
+			sqlDatetime(q.AvailableFrom), sqlDatetime(q.AvailableUntil))
+		if len(q.Tags) > 0 {
+			fmt.Fprintln(bw, "SET @question_id = LAST_INSERT_ID();")
+		}
+		for _, tag := range q.Tags {
+			fmt.Fprintf(bw, "INSERT IGNORE INTO tags (name) VALUES (%s);\n", sqlQuote(tag))
+			fmt.Fprintf(bw, "INSERT IGNORE INTO question_tags (question_id, tag_id) SELECT @question_id, id FROM tags WHERE name = %s;\n",
+				sqlQuote(tag))
+		}
+	}
+
+	fmt.Fprintln(bw)
+	fmt.Fprintln(bw, "SET FOREIGN_KEY_CHECKS=1;")
+	return bw.Flush()
+}
+
+// writeCSVExport writes the questions in rows, as returned by
+// StreamQuestions, as CSV with the columns in csvExportHeader. Tags are
+// joined with semicolons. Each question is written as soon as it is scanned.
+func writeCSVExport(w io.Writer, rows *sql.Rows) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvExportHeader); err != nil {
+		return fmt.Errorf("failed to write question: %w", err)
+	}
+	for rows.Next() {
+		q, err := scanQuestion(rows)
+		if err != nil {
+			return err
+		}
+		record := []string{strconv.Itoa(q.ID), q.Language, q.Type, q.Task, strings.Join(q.Tags, ";")}
+		if err := cw.Write(record); err != nil {
+			return fmt.Errorf("failed to write question: %w", err)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read questions: %w", err)
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeJSONLinesExport writes the questions in rows, as returned by
+// StreamQuestions, as JSON lines, one Question object per line.
+func writeJSONLinesExport(w io.Writer, rows *sql.Rows) error {
+	enc := json.NewEncoder(w)
+	for rows.Next() {
+		q, err := scanQuestion(rows)
+		if err != nil {
+			return err
+		}
+		if err := enc.Encode(q); err != nil {
+			return fmt.Errorf("failed to write question: %w", err)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read questions: %w", err)
+	}
+	return nil
+}
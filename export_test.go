@@ -0,0 +1,26 @@
+package main
+
+import "testing"
+
+func TestSQLQuote(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"", `''`},
+		{"Sing a song", `'Sing a song'`},
+		{"What's your name?", `'What\'s your name?'`},
+		{`C:\temp`, `'C:\\temp'`},
+		{`\'`, `'\\\''`},
+		{"line one\nline two\r\n", `'line one\nline two\r\n'`},
+		{"nul\x00byte", `'nul\0byte'`},
+		{"ctrl\x1az", `'ctrl\Zz'`},
+		{`"double" and %_ stay`, `'"double" and %_ stay'`},
+		{"Über straße", `'Über straße'`},
+	}
+	for _, tt := range tests {
+		if got := sqlQuote(tt.input); got != tt.want {
+			t.Errorf("sqlQuote(%q) = %s, want %s", tt.input, got, tt.want)
+		}
+	}
+}
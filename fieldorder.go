@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// canonicalQuestion serializes a Question with its fields in the documented
+// canonical order used by ?field_order=canonical:
+//
+//	id, language, type, task, dare_target (only when set),
+//	attributes (only when set), available_from (only when set),
+//	available_until (only when set), highlightedTask (only when set), tags
+//
+// The order is part of the API contract for parsers that depend on it, so
+// new fields must be appended at the documented position rather than
+// wherever they happen to be declared on Question.
+type canonicalQuestion Question
+
+// MarshalJSON implements json.Marshaler.
+func (q canonicalQuestion) MarshalJSON() ([]byte, error) {
+	tags := q.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+
+	fields := []struct {
+		name      string
+		value     interface{}
+		omitEmpty bool
+	}{
+		{"id", q.ID, false},
+		{"language", q.Language, false},
+		{"type", q.Type, false},
+		{"task", q.Task, false},
+		{"dare_target", q.DareTarget, q.DareTarget == nil},
+		{"attributes", q.Attributes, len(q.Attributes) == 0},
+		{"available_from", q.AvailableFrom, q.AvailableFrom == nil},
+		{"available_until", q.AvailableUntil, q.AvailableUntil == nil},
+		{"highlightedTask", q.HighlightedTask, q.HighlightedTask == ""},
+		{"tags", tags, false},
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	first := true
+	for _, field := range fields {
+		if field.omitEmpty {
+			continue
+		}
+		value, err := json.Marshal(field.value)
+		if err != nil {
+			return nil, err
+		}
+		if !first {
+			buf.WriteByte(',')
+		}
+		first = false
+		buf.WriteString(`"` + field.name + `":`)
+		buf.Write(json.RawMessage(value))
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// canonicalQuestions converts questions for canonical field order output.
+func canonicalQuestions(questions []Question) []canonicalQuestion {
+	out := make([]canonicalQuestion, len(questions))
+	for i, q := range questions {
+		out[i] = canonicalQuestion(q)
+	}
+	return out
+}
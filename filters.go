@@ -0,0 +1,365 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/2Friendly4You/TruthOrDare/apierror"
+)
+
+// filterSetVersion is mixed into every fingerprint. Bump it whenever a field
+// is added to FilterSet or the canonical form changes so that keys produced
+// by older releases never collide with new ones.
+const filterSetVersion = 7
+
+// maxFilterTags caps the number of tags a single filter may reference, which
+// bounds the size of the generated IN (...) placeholder lists.
+const maxFilterTags = 100
+
+// tagNamePattern restricts tag names to letters, digits, hyphens and
+// underscores, plus the + and : already used by the catalog ("18+",
+// "location:indoor").
+var tagNamePattern = regexp.MustCompile(`^[\p{L}\p{N}_+:-]+$`)
+
+// maxWildcardTags caps the number of wildcard tags in a single filter, since
+// each one becomes a LIKE condition that cannot use an equality lookup.
+const maxWildcardTags = 10
+
+// FilterSet is the validated set of question filters shared by every read
+// endpoint. Handlers build it once from the query string and pass it down to
+// the storage layer.
+// @Description Filters applied when selecting questions
+type FilterSet struct {
+	// ISO language code, already normalized
+	// @example "en"
+	Language string `json:"language,omitempty"`
+
+	// Question type, either "truth" or "dare"
+	// @example "truth"
+	Type string `json:"type,omitempty"`
+
+	// Tag names to filter by. A trailing * matches every tag with that
+	// prefix, so "location:*" matches "location:indoor" and
+	// "location:outdoor"
+	// @example ["funny","location:*"]
+	Tags []string `json:"tags,omitempty"`
+
+	// Tag names that rule a question out: questions carrying any of them
+	// are not returned, whatever tags matched. Wildcards work as in Tags.
+	// @example ["nsfw","alcohol"]
+	ExcludeTags []string `json:"excludeTags,omitempty"`
+
+	// Determines if all tags must match (true) or any tag matches (false)
+	// @example false
+	MatchAllTags bool `json:"matchAllTags,omitempty"`
+
+	// Restrict to directed dares (true) or to questions without a dare
+	// target (false); nil means no restriction
+	// @example true
+	HasDareTarget *bool `json:"hasDareTarget,omitempty"`
+
+	// Full-text search terms matched as word prefixes against the task
+	// text; tasks starting with the search match as well, and so do tasks
+	// containing it anywhere when it has characters the index ignores
+	// @example "fear"
+	Search string `json:"search,omitempty"`
+
+	// Attribute values the questions must carry, keyed by attribute name
+	// and typed according to the attribute schema
+	// @example {"indoor":true}
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+
+	// Also return questions outside their availability window
+	// @example false
+	IncludeScheduled bool `json:"includeScheduled,omitempty"`
+}
+
+// QueryConfig contains configuration options for database queries
+// @Description Configuration options for filtering questions
+//
+// Deprecated: GetQuestions takes a FilterSet, which carries MatchAllTags
+// along with every other filter. Convert existing call sites with
+// QueryConfig.FilterSet; QueryConfig will be removed in the next release.
+type QueryConfig struct {
+	// Determines if all tags must match (true) or any tag matches (false)
+	// @example false
+	MatchAllTags bool
+}
+
+// FilterSet converts the arguments of the former GetQuestions(language,
+// qType, tags, config) signature to the equivalent FilterSet. A nil config
+// matches any of the tags.
+//
+// Deprecated: Build a FilterSet directly.
+func (c *QueryConfig) FilterSet(language, qType string, tags []string) FilterSet {
+	f := FilterSet{Language: normalizeLanguage(language), Type: qType, Tags: tags}
+	if c != nil {
+		f.MatchAllTags = c.MatchAllTags
+	}
+	return f
+}
+
+// ParseFilterSet builds a FilterSet from URL query parameters. Tags may be
+// given as repeated parameters, comma-separated, or both, and may end in a
+// * wildcard. A "pack" parameter produced by FilterSet.Pack supplies
+// defaults; any filter given explicitly in the query overrides the packed
+// value. Parameters of the form attr.<key> filter on question attributes and
+// are checked against attributeSchema. Unknown parameters are ignored.
+//
+// Invalid filters are rejected rather than ignored. Errors are
+// *apierror.Error values whose code names the problem, such as
+// INVALID_LANGUAGE or INVALID_TYPE, or *AttributeError values.
+func ParseFilterSet(query url.Values) (FilterSet, error) {
+	var f FilterSet
+	if pack := query.Get("pack"); pack != "" {
+		var err error
+		f, err = unpackFilterSet(pack)
+		if err != nil {
+			return FilterSet{}, apierror.New(apierror.InvalidParam, err.Error())
+		}
+	}
+
+	if query.Has("language") {
+		f.Language = query.Get("language")
+	}
+	f.Language = normalizeLanguage(f.Language)
+	if f.Language != "" && !languageCodePattern.MatchString(f.Language) {
+		return FilterSet{}, apierror.Newf(apierror.InvalidLanguage, "invalid language %q: must be a two-letter ISO 639-1 code", query.Get("language"))
+	}
+
+	if query.Has("type") {
+		f.Type = query.Get("type")
+	}
+	if f.Type != "" && f.Type != "truth" && f.Type != "dare" {
+		return FilterSet{}, apierror.Newf(apierror.InvalidType, "invalid type %q: must be \"truth\" or \"dare\"", f.Type)
+	}
+
+	if query.Has("tags") {
+		tags, err := parseTagList("tags", query["tags"])
+		if err != nil {
+			return FilterSet{}, err
+		}
+		f.Tags = tags
+	}
+	if len(f.Tags) > maxFilterTags {
+		return FilterSet{}, apierror.Newf(apierror.InvalidTag, "too many tags: at most %d may be given", maxFilterTags)
+	}
+	if err := validateTagPatterns(f.Tags); err != nil {
+		return FilterSet{}, apierror.New(apierror.InvalidTag, err.Error())
+	}
+
+	if query.Has("excludeTags") {
+		excludeTags, err := parseTagList("excludeTags", query["excludeTags"])
+		if err != nil {
+			return FilterSet{}, err
+		}
+		f.ExcludeTags = excludeTags
+	}
+	if len(f.ExcludeTags) > maxFilterTags {
+		return FilterSet{}, apierror.Newf(apierror.InvalidTag, "too many excluded tags: at most %d may be given", maxFilterTags)
+	}
+	if err := validateTagPatterns(f.ExcludeTags); err != nil {
+		return FilterSet{}, apierror.New(apierror.InvalidTag, err.Error())
+	}
+
+	if raw := query.Get("matchAllTags"); raw != "" {
+		matchAll, err := strconv.ParseBool(raw)
+		if err != nil {
+			return FilterSet{}, apierror.Newf(apierror.InvalidParam, "invalid matchAllTags %q: must be true or false", raw)
+		}
+		f.MatchAllTags = matchAll
+	}
+
+	if raw := query.Get("has_dare_target"); raw != "" {
+		hasTarget, err := strconv.ParseBool(raw)
+		if err != nil {
+			return FilterSet{}, apierror.Newf(apierror.InvalidParam, "invalid has_dare_target %q: must be true or false", raw)
+		}
+		f.HasDareTarget = &hasTarget
+	}
+
+	if raw := query.Get("includeScheduled"); raw != "" {
+		includeScheduled, err := strconv.ParseBool(raw)
+		if err != nil {
+			return FilterSet{}, apierror.Newf(apierror.InvalidParam, "invalid includeScheduled %q: must be true or false", raw)
+		}
+		f.IncludeScheduled = includeScheduled
+	}
+
+	if query.Has("search") {
+		f.Search = query.Get("search")
+	}
+	f.Search = strings.TrimSpace(f.Search)
+
+	if err := attributeSchema.Validate(f.Attributes); err != nil {
+		return FilterSet{}, err
+	}
+	for param := range query {
+		key, ok := strings.CutPrefix(param, "attr.")
+		if !ok {
+			continue
+		}
+		value, err := attributeSchema.ParseFilter(key, query.Get(param))
+		if err != nil {
+			return FilterSet{}, err
+		}
+		if f.Attributes == nil {
+			f.Attributes = map[string]interface{}{}
+		}
+		f.Attributes[key] = value
+	}
+
+	return f, nil
+}
+
+// parseTagList collects the tag names of a repeatable, comma-separated tag
+// parameter. An empty parameter means no tags, but an empty tag inside a
+// list is a mistake.
+func parseTagList(param string, values []string) ([]string, error) {
+	var tags []string
+	for _, value := range values {
+		if strings.TrimSpace(value) == "" {
+			continue
+		}
+		for _, tag := range strings.Split(value, ",") {
+			tag = strings.TrimSpace(tag)
+			if tag == "" {
+				return nil, apierror.Newf(apierror.InvalidTag, "invalid %s %q: tag names must not be empty", param, value)
+			}
+			tags = append(tags, tag)
+		}
+	}
+	return tags, nil
+}
+
+// Pack encodes the filter set as URL-safe base64 JSON for use in the "pack"
+// query parameter.
+func (f FilterSet) Pack() string {
+	data, _ := json.Marshal(f)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func unpackFilterSet(pack string) (FilterSet, error) {
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(pack, "="))
+	if err != nil {
+		return FilterSet{}, fmt.Errorf("invalid pack: not base64url encoded")
+	}
+	var f FilterSet
+	if err := json.Unmarshal(data, &f); err != nil {
+		return FilterSet{}, fmt.Errorf("invalid pack: %v", err)
+	}
+	return f, nil
+}
+
+// Fingerprint returns a deterministic key for the filter set. Two filter sets
+// that select the same questions produce the same fingerprint regardless of
+// tag order, tag case, duplicate tags or language formatting.
+func (f FilterSet) Fingerprint() string {
+	tags := canonicalTags(f.Tags)
+	excludeTags := canonicalTags(f.ExcludeTags)
+
+	hasDareTarget := "any"
+	if f.HasDareTarget != nil {
+		hasDareTarget = strconv.FormatBool(*f.HasDareTarget)
+	}
+
+	attributes := make([]string, 0, len(f.Attributes))
+	for key, value := range f.Attributes {
+		attributes = append(attributes, fmt.Sprintf("%s:%v", key, value))
+	}
+	sort.Strings(attributes)
+
+	canonical := fmt.Sprintf("v%d|language=%s|type=%s|tags=%s|excludeTags=%s|matchAllTags=%t|hasDareTarget=%s|search=%q|attributes=%q|includeScheduled=%t",
+		filterSetVersion,
+		normalizeLanguage(f.Language),
+		f.Type,
+		strings.Join(tags, ","),
+		strings.Join(excludeTags, ","),
+		f.MatchAllTags,
+		hasDareTarget,
+		strings.ToLower(f.Search),
+		strings.Join(attributes, ","),
+		f.IncludeScheduled,
+	)
+
+	sum := sha256.Sum256([]byte(canonical))
+	return fmt.Sprintf("v%d-%s", filterSetVersion, hex.EncodeToString(sum[:16]))
+}
+
+// canonicalTags returns tags deduplicated, lowercased and sorted.
+func canonicalTags(tags []string) []string {
+	tags = uniqueStrings(tags)
+	for i, tag := range tags {
+		tags[i] = strings.ToLower(tag)
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// normalizeLanguage reduces a client supplied language tag such as "EN",
+// "en-US" or "en_gb" to the lowercase two-letter code stored in the
+// database. Region and script subtags are discarded.
+func normalizeLanguage(language string) string {
+	language = strings.TrimSpace(language)
+	if i := strings.IndexAny(language, "-_"); i >= 0 {
+		language = language[:i]
+	}
+	return strings.ToLower(language)
+}
+
+// splitTagPatterns separates exact tag names from trailing-wildcard tags and
+// returns the wildcards as their prefixes.
+func splitTagPatterns(tags []string) (exact, prefixes []string) {
+	for _, tag := range tags {
+		if prefix, ok := strings.CutSuffix(tag, "*"); ok {
+			prefixes = append(prefixes, prefix)
+		} else {
+			exact = append(exact, tag)
+		}
+	}
+	return exact, prefixes
+}
+
+// validateTagPatterns checks that tag names match tagNamePattern and that
+// wildcards only appear at the end of a tag, have a non-empty prefix, and
+// stay within maxWildcardTags.
+func validateTagPatterns(tags []string) error {
+	_, prefixes := splitTagPatterns(tags)
+	if len(prefixes) > maxWildcardTags {
+		return fmt.Errorf("too many wildcard tags: at most %d may be given", maxWildcardTags)
+	}
+	for _, tag := range tags {
+		prefix := strings.TrimSuffix(tag, "*")
+		if prefix == "" {
+			return fmt.Errorf("invalid tag %q: a wildcard needs a prefix", tag)
+		}
+		if strings.Contains(prefix, "*") {
+			return fmt.Errorf("invalid tag %q: * is only allowed at the end", tag)
+		}
+		if !tagNamePattern.MatchString(prefix) {
+			return fmt.Errorf("invalid tag %q: only letters, digits, -, _, + and : are allowed", tag)
+		}
+	}
+	return nil
+}
+
+// likePrefixPattern returns a LIKE pattern matching every string that starts
+// with prefix. % and _ in the prefix match literally; the pattern must be used
+// with ESCAPE '!'.
+func likePrefixPattern(prefix string) string {
+	return strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(prefix) + "%"
+}
+
+// likeContainsPattern returns a LIKE pattern matching every string that
+// contains s, escaped like likePrefixPattern.
+func likeContainsPattern(s string) string {
+	return "%" + likePrefixPattern(s)
+}
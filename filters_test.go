@@ -0,0 +1,350 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/2Friendly4You/TruthOrDare/apierror"
+)
+
+func TestQueryConfigFilterSet(t *testing.T) {
+	tests := []struct {
+		name   string
+		config *QueryConfig
+		want   FilterSet
+	}{
+		{"nil config", nil, FilterSet{Language: "en", Type: "truth", Tags: []string{"funny"}}},
+		{"match any", &QueryConfig{}, FilterSet{Language: "en", Type: "truth", Tags: []string{"funny"}}},
+		{"match all", &QueryConfig{MatchAllTags: true}, FilterSet{Language: "en", Type: "truth", Tags: []string{"funny"}, MatchAllTags: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.config.FilterSet("EN", "truth", []string{"funny"})
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("FilterSet() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestMatchAllTagsKeepsLanguageAndType checks that a match-all tag filter
+// parsed from a request is combined with the language and type filters:
+// both apply to the outer query, the HAVING count covers exactly the
+// requested tags, and the tag match yields each question once so it cannot
+// inflate the aggregated tag list.
+func TestMatchAllTagsKeepsLanguageAndType(t *testing.T) {
+	query, err := url.ParseQuery("language=DE&type=truth&tags=funny,party&matchAllTags=true")
+	if err != nil {
+		t.Fatal(err)
+	}
+	filters, err := ParseFilterSet(query)
+	if err != nil {
+		t.Fatalf("ParseFilterSet() error = %v", err)
+	}
+	want := FilterSet{Language: "de", Type: "truth", Tags: []string{"funny", "party"}, MatchAllTags: true}
+	if !reflect.DeepEqual(filters, want) {
+		t.Fatalf("ParseFilterSet() = %+v, want %+v", filters, want)
+	}
+
+	filters.IncludeScheduled = true
+	sql, args := buildQuestionsQuery(filters, QueryOptions{})
+	sql = compactSQL(sql)
+
+	_, rest, _ := strings.Cut(sql, "INNER JOIN (")
+	subquery, outer, ok := strings.Cut(rest, ") matching_tags ON q.id = matching_tags.question_id")
+	if !ok {
+		t.Fatalf("no matching_tags subquery in %s", sql)
+	}
+	if !strings.Contains(subquery, "GROUP BY qt.question_id HAVING COUNT(DISTINCT t.name) = ?") {
+		t.Errorf("tag match does not yield one row per question with all tags: %s", subquery)
+	}
+	if strings.Contains(subquery, "q.language") || strings.Contains(subquery, "q.type") {
+		t.Errorf("language or type filtered inside the tag match: %s", subquery)
+	}
+	if !strings.HasPrefix(strings.TrimSpace(outer), "WHERE q.language = ? AND q.type = ?") {
+		t.Errorf("language and type do not filter the outer query: %s", outer)
+	}
+	if n := strings.Count(sql, "LEFT JOIN tags t"); n != 1 {
+		t.Errorf("tags joined %d times for aggregation, want 1", n)
+	}
+
+	wantArgs := []interface{}{"funny", "party", 2, "de", "truth"}
+	if !reflect.DeepEqual(args, wantArgs) {
+		t.Errorf("args = %#v, want %#v", args, wantArgs)
+	}
+}
+
+func TestParseFilterSet(t *testing.T) {
+	yes := true
+	tests := []struct {
+		query    string
+		want     FilterSet
+		wantCode apierror.Code
+	}{
+		{query: "", want: FilterSet{}},
+		{query: "language=EN&type=dare", want: FilterSet{Language: "en", Type: "dare"}},
+		{query: "language=en-US", want: FilterSet{Language: "en"}},
+		{query: "tags=funny,party&tags=deep", want: FilterSet{Tags: []string{"funny", "party", "deep"}}},
+		{query: "tags=", want: FilterSet{}},
+		{query: "tags=location:*", want: FilterSet{Tags: []string{"location:*"}}},
+		{query: "excludeTags=nsfw,drink*", want: FilterSet{ExcludeTags: []string{"nsfw", "drink*"}}},
+		{query: "matchAllTags=true&has_dare_target=1&includeScheduled=true", want: FilterSet{MatchAllTags: true, HasDareTarget: &yes, IncludeScheduled: true}},
+		{query: "search=%20fear%20", want: FilterSet{Search: "fear"}},
+		{query: "unknown=1", want: FilterSet{}},
+		{query: "language=english", wantCode: apierror.InvalidLanguage},
+		{query: "type=Truth", wantCode: apierror.InvalidType},
+		{query: "tags=funny,,party", wantCode: apierror.InvalidTag},
+		{query: "tags=fun%20ny", wantCode: apierror.InvalidTag},
+		{query: "tags=*", wantCode: apierror.InvalidTag},
+		{query: "tags=a*b", wantCode: apierror.InvalidTag},
+		{query: "excludeTags=bad%3Btag", wantCode: apierror.InvalidTag},
+		{query: "matchAllTags=yes", wantCode: apierror.InvalidParam},
+		{query: "has_dare_target=maybe", wantCode: apierror.InvalidParam},
+		{query: "pack=%25%25", wantCode: apierror.InvalidParam},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			query, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := ParseFilterSet(query)
+			if tt.wantCode != "" {
+				if code := codeForError(err); code != tt.wantCode {
+					t.Fatalf("ParseFilterSet() error = %v (%s), want code %s", err, code, tt.wantCode)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseFilterSet() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseFilterSet() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseFilterSetTagLimits(t *testing.T) {
+	tags := make([]string, maxFilterTags+1)
+	for i := range tags {
+		tags[i] = fmt.Sprintf("tag%d", i)
+	}
+	wildcards := make([]string, maxWildcardTags+1)
+	for i := range wildcards {
+		wildcards[i] = fmt.Sprintf("tag%d*", i)
+	}
+
+	tests := []struct {
+		name  string
+		query url.Values
+		ok    bool
+	}{
+		{"max tags", url.Values{"tags": {strings.Join(tags[:maxFilterTags], ",")}}, true},
+		{"too many tags", url.Values{"tags": {strings.Join(tags, ",")}}, false},
+		{"too many excluded tags", url.Values{"excludeTags": {strings.Join(tags, ",")}}, false},
+		{"max wildcards", url.Values{"tags": {strings.Join(wildcards[:maxWildcardTags], ",")}}, true},
+		{"too many wildcards", url.Values{"tags": {strings.Join(wildcards, ",")}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseFilterSet(tt.query)
+			if tt.ok && err != nil {
+				t.Fatalf("ParseFilterSet() error = %v", err)
+			}
+			if !tt.ok && codeForError(err) != apierror.InvalidTag {
+				t.Fatalf("ParseFilterSet() error = %v, want INVALID_TAG", err)
+			}
+		})
+	}
+}
+
+// TestBuildQuestionsQueryMaxTags checks that the IN lists built for the
+// largest accepted tag filter have one placeholder per argument, in order.
+func TestBuildQuestionsQueryMaxTags(t *testing.T) {
+	tags := make([]string, maxFilterTags)
+	for i := range tags {
+		tags[i] = fmt.Sprintf("tag%d", i)
+	}
+
+	for _, matchAll := range []bool{false, true} {
+		t.Run(fmt.Sprintf("matchAllTags=%v", matchAll), func(t *testing.T) {
+			filters := FilterSet{Tags: tags, ExcludeTags: tags, MatchAllTags: matchAll, IncludeScheduled: true}
+			query, args := buildQuestionsQuery(filters, QueryOptions{})
+
+			if n := strings.Count(query, "?"); n != len(args) {
+				t.Fatalf("%d placeholders but %d args", n, len(args))
+			}
+			if !strings.Contains(query, "t.name IN ("+placeholders(maxFilterTags)+")") {
+				t.Errorf("tag IN list does not have %d placeholders", maxFilterTags)
+			}
+			for i, tag := range tags {
+				if args[i] != tag {
+					t.Fatalf("arg %d = %v, want %s", i, args[i], tag)
+				}
+			}
+			if matchAll && args[maxFilterTags] != maxFilterTags {
+				t.Errorf("HAVING count arg = %v, want %d", args[maxFilterTags], maxFilterTags)
+			}
+			excluded := args[len(args)-maxFilterTags:]
+			for i, tag := range tags {
+				if excluded[i] != tag {
+					t.Fatalf("excluded arg %d = %v, want %s", i, excluded[i], tag)
+				}
+			}
+		})
+	}
+}
+
+func TestFilterSetFingerprint(t *testing.T) {
+	base := FilterSet{Language: "en", Type: "truth", Tags: []string{"funny", "party"}}
+
+	same := []FilterSet{
+		{Language: "EN-us", Type: "truth", Tags: []string{"party", "funny"}},
+		{Language: "en", Type: "truth", Tags: []string{"Funny", "party", "FUNNY"}},
+	}
+	for _, f := range same {
+		if f.Fingerprint() != base.Fingerprint() {
+			t.Errorf("%+v and %+v have different fingerprints", f, base)
+		}
+	}
+
+	no := false
+	different := []FilterSet{
+		{Language: "de", Type: "truth", Tags: []string{"funny", "party"}},
+		{Language: "en", Type: "dare", Tags: []string{"funny", "party"}},
+		{Language: "en", Type: "truth", Tags: []string{"funny"}},
+		{Language: "en", Type: "truth", Tags: []string{"funny", "party"}, MatchAllTags: true},
+		{Language: "en", Type: "truth", Tags: []string{"funny"}, ExcludeTags: []string{"party"}},
+		{Language: "en", Type: "truth", Tags: []string{"funny", "party"}, HasDareTarget: &no},
+		{Language: "en", Type: "truth", Tags: []string{"funny", "party"}, Search: "fear"},
+		{Language: "en", Type: "truth", Tags: []string{"funny", "party"}, IncludeScheduled: true},
+		{Language: "en", Type: "truth", Tags: []string{"funny", "party"}, Attributes: map[string]interface{}{"indoor": true}},
+	}
+	for _, f := range different {
+		if f.Fingerprint() == base.Fingerprint() {
+			t.Errorf("%+v has the same fingerprint as %+v", f, base)
+		}
+	}
+
+	if prefix := fmt.Sprintf("v%d-", filterSetVersion); !strings.HasPrefix(base.Fingerprint(), prefix) {
+		t.Errorf("fingerprint %s does not start with %s", base.Fingerprint(), prefix)
+	}
+}
+
+func TestFilterSetPack(t *testing.T) {
+	yes := true
+	filters := FilterSet{
+		Language:      "en",
+		Type:          "dare",
+		Tags:          []string{"funny", "location:*"},
+		ExcludeTags:   []string{"nsfw"},
+		MatchAllTags:  true,
+		HasDareTarget: &yes,
+		Search:        "sing",
+	}
+
+	got, err := ParseFilterSet(url.Values{"pack": {filters.Pack()}})
+	if err != nil {
+		t.Fatalf("ParseFilterSet(pack) error = %v", err)
+	}
+	if !reflect.DeepEqual(got, filters) {
+		t.Errorf("unpacked %+v, want %+v", got, filters)
+	}
+
+	// Explicit parameters override the packed values.
+	got, err = ParseFilterSet(url.Values{"pack": {filters.Pack()}, "type": {"truth"}, "tags": {""}})
+	if err != nil {
+		t.Fatalf("ParseFilterSet(pack, overrides) error = %v", err)
+	}
+	if got.Type != "truth" || got.Tags != nil || got.Language != "en" {
+		t.Errorf("overrides not applied: %+v", got)
+	}
+}
+
+func TestNormalizeLanguage(t *testing.T) {
+	tests := map[string]string{
+		"en":         "en",
+		"EN":         "en",
+		"En":         "en",
+		"en-US":      "en",
+		"en_gb":      "en",
+		" de-AT":     "de",
+		"zh-Hant-TW": "zh",
+		"":           "",
+	}
+	for input, want := range tests {
+		if got := normalizeLanguage(input); got != want {
+			t.Errorf("normalizeLanguage(%q) = %q, want %q", input, got, want)
+		}
+	}
+}
+
+func TestValidateTagPatterns(t *testing.T) {
+	tests := []struct {
+		tags    []string
+		wantErr string
+	}{
+		{[]string{"funny", "18+", "location:indoor", "über", "snake_case", "kebab-case"}, ""},
+		{[]string{"location:*"}, ""},
+		{[]string{"*"}, "needs a prefix"},
+		{[]string{"lo*cation"}, "only allowed at the end"},
+		{[]string{"loc**"}, "only allowed at the end"},
+		{[]string{"two words"}, "only letters"},
+		{[]string{"100%"}, "only letters"},
+		{[]string{"a*", "b*", "c*", "d*", "e*", "f*", "g*", "h*", "i*", "j*", "k*"}, "too many wildcard tags"},
+	}
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.tags, ","), func(t *testing.T) {
+			err := validateTagPatterns(tt.tags)
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("validateTagPatterns() error = %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("validateTagPatterns() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLikePatterns(t *testing.T) {
+	tests := []struct {
+		input        string
+		wantPrefix   string
+		wantContains string
+	}{
+		{"location:", "location:%", "%location:%"},
+		{"50%", "50!%%", "%50!%%"},
+		{"snake_case", "snake!_case%", "%snake!_case%"},
+		{"wow!", "wow!!%", "%wow!!%"},
+		{"", "%", "%%"},
+	}
+	for _, tt := range tests {
+		if got := likePrefixPattern(tt.input); got != tt.wantPrefix {
+			t.Errorf("likePrefixPattern(%q) = %q, want %q", tt.input, got, tt.wantPrefix)
+		}
+		if got := likeContainsPattern(tt.input); got != tt.wantContains {
+			t.Errorf("likeContainsPattern(%q) = %q, want %q", tt.input, got, tt.wantContains)
+		}
+	}
+}
+
+func TestParseTagList(t *testing.T) {
+	got, err := parseTagList("tags", []string{" funny , party", "", "deep"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"funny", "party", "deep"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("parseTagList() = %v, want %v", got, want)
+	}
+
+	_, err = parseTagList("excludeTags", []string{"nsfw,"})
+	var apiErr *apierror.Error
+	if !errors.As(err, &apiErr) || apiErr.Code != apierror.InvalidTag || !strings.Contains(apiErr.Message, "excludeTags") {
+		t.Errorf("parseTagList() error = %v, want INVALID_TAG naming excludeTags", err)
+	}
+}
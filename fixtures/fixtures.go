@@ -0,0 +1,95 @@
+// Package fixtures defines the on-disk format of recorded API responses and
+// a replay server that serves them, so client test suites can run offline
+// against real response shapes.
+package fixtures
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Fixture is a single recorded request/response pair.
+type Fixture struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+// Request is the sanitized part of a recorded request. Headers are never
+// recorded so credentials cannot leak into fixture files.
+type Request struct {
+	Method string     `json:"method"`
+	Path   string     `json:"path"`
+	Query  url.Values `json:"query,omitempty"`
+}
+
+// Response is a recorded response.
+type Response struct {
+	Status      int             `json:"status"`
+	ContentType string          `json:"contentType"`
+	Body        json.RawMessage `json:"body"`
+}
+
+// FileName returns the file name used for a fixture of path with the given
+// deduplication key.
+func FileName(path, key string) string {
+	name := strings.Trim(strings.ReplaceAll(path, "/", "_"), "_")
+	return fmt.Sprintf("%s_%s.json", name, key)
+}
+
+// Load reads every fixture in dir.
+func Load(dir string) ([]Fixture, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	loaded := make([]Fixture, 0, len(paths))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read fixture %s: %w", path, err)
+		}
+		var f Fixture
+		if err := json.Unmarshal(data, &f); err != nil {
+			return nil, fmt.Errorf("failed to parse fixture %s: %w", path, err)
+		}
+		loaded = append(loaded, f)
+	}
+	return loaded, nil
+}
+
+// NewServer starts an httptest.Server that replays the fixtures in dir. A
+// request is matched on method, path and query parameters; unmatched
+// requests get a 404. The caller must Close the server.
+func NewServer(dir string) (*httptest.Server, error) {
+	loaded, err := Load(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byKey := make(map[string]Fixture, len(loaded))
+	for _, f := range loaded {
+		byKey[matchKey(f.Request.Method, f.Request.Path, f.Request.Query)] = f
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f, ok := byKey[matchKey(r.Method, r.URL.Path, r.URL.Query())]
+		if !ok {
+			http.Error(w, "no fixture recorded for this request", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", f.Response.ContentType)
+		w.WriteHeader(f.Response.Status)
+		w.Write(f.Response.Body)
+	})), nil
+}
+
+func matchKey(method, path string, query url.Values) string {
+	return method + " " + path + "?" + query.Encode()
+}
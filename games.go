@@ -0,0 +1,181 @@
+package main
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/2Friendly4You/TruthOrDare/apierror"
+	"github.com/go-sql-driver/mysql"
+)
+
+const (
+	// gameCodeAlphabet leaves out characters that are easily confused when
+	// a code is read aloud or typed from a screen (0/O, 1/I/L).
+	gameCodeAlphabet = "ABCDEFGHJKMNPQRSTUVWXYZ23456789"
+	gameCodeLength   = 6
+
+	// gameCodeAttempts bounds retries after a code collision.
+	gameCodeAttempts = 5
+
+	defaultGameTTL = 24 * time.Hour
+	maxGameDeck    = 200
+)
+
+// GameResponse describes a stored game setup
+// @Description A short code that reproduces a game's filter set and deck
+type GameResponse struct {
+	// Code to share with other players
+	// @example "K7XQ2M"
+	Code string `json:"code"`
+
+	// Filters stored under the code
+	Filters FilterSet `json:"filters"`
+
+	// Time after which the code no longer resolves
+	ExpiresAt time.Time `json:"expiresAt"`
+
+	// Deck selected with the game's seed, only present when deck is given
+	// and questions matched
+	Questions []Question `json:"questions,omitempty"`
+}
+
+// gameTTL returns how long game codes stay valid, configured through
+// GAME_CODE_TTL as a Go duration such as "12h". It falls back to 24 hours.
+func gameTTL() time.Duration {
+	if ttl, err := time.ParseDuration(os.Getenv("GAME_CODE_TTL")); err == nil && ttl > 0 {
+		return ttl
+	}
+	return defaultGameTTL
+}
+
+// newGameCode returns a random code drawn from gameCodeAlphabet.
+func newGameCode() (string, error) {
+	var b strings.Builder
+	max := big.NewInt(int64(len(gameCodeAlphabet)))
+	for i := 0; i < gameCodeLength; i++ {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		b.WriteByte(gameCodeAlphabet[n.Int64()])
+	}
+	return b.String(), nil
+}
+
+// @Summary Create a game code
+// @Description Store the given filters under a short code that other players can use to join the same game setup. Codes expire after GAME_CODE_TTL (default 24h).
+// @Tags games
+// @Produce json
+// @Param language query string false "ISO 639-1 language code filter" example(en)
+// @Param type query string false "Question type filter" Enums(truth, dare)
+// @Param tags query []string false "Filter questions by tags (comma-separated); a trailing * matches every tag with that prefix" example(funny,party,social)
+// @Param excludeTags query []string false "Leave out questions carrying any of these tags (comma-separated); a trailing * matches every tag with that prefix" example(nsfw,alcohol)
+// @Param matchAllTags query boolean false "Require all specified tags to match (true) or any tag (false)" default(false)
+// @Success 201 {object} GameResponse "Created game"
+// @Failure 400 {object} ErrorResponse "Invalid request parameters"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /games [post]
+func createGame(w http.ResponseWriter, r *http.Request) {
+	filters, err := ParseFilterSet(r.URL.Query())
+	if err != nil {
+		respondError(w, err, "Invalid filters")
+		return
+	}
+
+	seed, err := rand.Int(rand.Reader, big.NewInt(1<<31))
+	if err != nil {
+		log.Printf("Failed to generate game seed: %v", err)
+		writeError(w, apierror.Internal, "Failed to create game")
+		return
+	}
+
+	filtersJSON, _ := json.Marshal(filters)
+	expiresAt := time.Now().Add(gameTTL()).Truncate(time.Second)
+
+	for attempt := 1; ; attempt++ {
+		code, err := newGameCode()
+		if err != nil {
+			log.Printf("Failed to generate game code: %v", err)
+			writeError(w, apierror.Internal, "Failed to create game")
+			return
+		}
+
+		err = db.SaveGame(r.Context(), code, string(filtersJSON), seed.Int64(), expiresAt)
+		var mysqlErr *mysql.MySQLError
+		if errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlErrDuplicateEntry && attempt < gameCodeAttempts {
+			continue
+		}
+		if err != nil {
+			log.Printf("Failed to save game: %v", err)
+			respondError(w, err, "Failed to create game")
+			return
+		}
+
+		respondJSON(w, http.StatusCreated, GameResponse{Code: code, Filters: filters, ExpiresAt: expiresAt})
+		return
+	}
+}
+
+// @Summary Look up a game code
+// @Description Return the filters stored under a game code. With deck, also return that many questions chosen with the game's seed, so every player requesting the same deck size gets the same questions in the same order.
+// @Tags games
+// @Produce json
+// @Param code path string true "Game code" example(K7XQ2M)
+// @Param deck query integer false "Number of questions to include (max 200)"
+// @Success 200 {object} GameResponse "Stored game"
+// @Failure 400 {object} ErrorResponse "Invalid deck size"
+// @Failure 404 {object} ErrorResponse "Unknown or expired code"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /games/{code} [get]
+func getGame(w http.ResponseWriter, r *http.Request) {
+	code := strings.ToUpper(strings.TrimPrefix(r.URL.Path, "/api/games/"))
+
+	deckSize := 0
+	if raw := r.URL.Query().Get("deck"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxGameDeck {
+			writeError(w, apierror.InvalidParam, fmt.Sprintf("deck must be an integer between 1 and %d", maxGameDeck))
+			return
+		}
+		deckSize = n
+	}
+
+	filtersJSON, seed, expiresAt, err := db.GetGame(r.Context(), code)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, apierror.NotFound, "Game not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to fetch game %q: %v", code, err)
+		respondError(w, err, "Failed to fetch game")
+		return
+	}
+
+	resp := GameResponse{Code: code, ExpiresAt: expiresAt}
+	if err := json.Unmarshal([]byte(filtersJSON), &resp.Filters); err != nil {
+		log.Printf("Failed to parse filters of game %q: %v", code, err)
+		writeError(w, apierror.Internal, "Failed to fetch game")
+		return
+	}
+
+	if deckSize > 0 {
+		resp.Questions, err = db.GetSeededQuestions(r.Context(), resp.Filters, seed, deckSize)
+		if err != nil {
+			log.Printf("Failed to build deck for game %q: %v", code, err)
+			respondError(w, err, "Failed to build deck")
+			return
+		}
+	}
+
+	respondJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"html"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Default markup wrapped around search matches in HighlightedTask.
+const (
+	defaultHighlightOpenTag  = "<mark>"
+	defaultHighlightCloseTag = "</mark>"
+)
+
+// highlightTags returns the markup configured through HIGHLIGHT_OPEN_TAG and
+// HIGHLIGHT_CLOSE_TAG, falling back to <mark></mark>.
+func highlightTags() (string, string) {
+	openTag, closeTag := os.Getenv("HIGHLIGHT_OPEN_TAG"), os.Getenv("HIGHLIGHT_CLOSE_TAG")
+	if openTag == "" || closeTag == "" {
+		return defaultHighlightOpenTag, defaultHighlightCloseTag
+	}
+	return openTag, closeTag
+}
+
+// searchTermPattern compiles a case-insensitive pattern matching any of the
+// whitespace-separated terms in search. It returns nil if search has no terms.
+func searchTermPattern(search string) *regexp.Regexp {
+	terms := strings.Fields(search)
+	if len(terms) == 0 {
+		return nil
+	}
+	for i, term := range terms {
+		terms[i] = regexp.QuoteMeta(term)
+	}
+	return regexp.MustCompile("(?i)" + strings.Join(terms, "|"))
+}
+
+// highlightTask HTML-escapes task and wraps every match of pattern in
+// openTag and closeTag. Escaping happens per segment so that matches never
+// split an HTML entity and the task text cannot inject markup of its own.
+func highlightTask(task string, pattern *regexp.Regexp, openTag, closeTag string) string {
+	var b strings.Builder
+	last := 0
+	for _, match := range pattern.FindAllStringIndex(task, -1) {
+		b.WriteString(html.EscapeString(task[last:match[0]]))
+		b.WriteString(openTag)
+		b.WriteString(html.EscapeString(task[match[0]:match[1]]))
+		b.WriteString(closeTag)
+		last = match[1]
+	}
+	b.WriteString(html.EscapeString(task[last:]))
+	return b.String()
+}
+
+// highlightQuestions sets HighlightedTask on every question for the terms in
+// search.
+func highlightQuestions(questions []Question, search string) {
+	pattern := searchTermPattern(search)
+	if pattern == nil {
+		return
+	}
+	openTag, closeTag := highlightTags()
+	for i := range questions {
+		questions[i].HighlightedTask = highlightTask(questions[i].Task, pattern, openTag, closeTag)
+	}
+}
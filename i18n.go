@@ -0,0 +1,361 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/2Friendly4You/TruthOrDare/apierror"
+)
+
+// fallbackLocale supplies every display string missing from the requested
+// locale.
+const fallbackLocale = "en"
+
+// maxDisplayNameLength is the longest tag display name accepted, matching
+// the tag_translations.display_name column.
+const maxDisplayNameLength = 100
+
+// typeLabels holds the built-in display names of the question types per
+// locale. Locales not listed here fall back to fallbackLocale.
+var typeLabels = map[string]map[string]string{
+	"en": {"truth": "Truth", "dare": "Dare"},
+	"de": {"truth": "Wahrheit", "dare": "Pflicht"},
+	"fr": {"truth": "Vérité", "dare": "Action"},
+	"es": {"truth": "Verdad", "dare": "Reto"},
+}
+
+// I18nBundle holds the display strings of server-known entities for one
+// locale
+// @Description Display strings for question types and tags in one locale, with English fallback
+type I18nBundle struct {
+	// The requested locale
+	// @example "de"
+	Locale string `json:"locale"`
+
+	// Display names of the question types
+	// @example {"truth":"Wahrheit","dare":"Pflicht"}
+	Types map[string]string `json:"types"`
+
+	// Display names of all tags keyed by tag name. Tags without a
+	// translation in the locale or in English are shown by name.
+	// @example {"alcohol":"Alkohol","food":"Essen"}
+	Tags map[string]string `json:"tags"`
+}
+
+// TagTranslation is the display name of a tag in one locale
+// @Description Per-locale display name override for a tag
+type TagTranslation struct {
+	// Tag name
+	// @example "alcohol"
+	Tag string `json:"tag"`
+
+	// Two-letter ISO 639-1 locale
+	// @example "de"
+	Locale string `json:"locale"`
+
+	// Name shown to players using this locale
+	// @example "Alkohol"
+	DisplayName string `json:"displayName"`
+}
+
+// buildI18nBundle assembles the bundle for locale from the built-in type
+// labels and the stored tag display names.
+func buildI18nBundle(ctx context.Context, locale string) (I18nBundle, error) {
+	tags, err := db.GetTagDisplayNames(ctx, locale)
+	if err != nil {
+		return I18nBundle{}, err
+	}
+
+	return I18nBundle{Locale: locale, Types: typeLabelsFor(locale), Tags: tags}, nil
+}
+
+// typeLabelsFor returns the display names of the question types in locale,
+// falling back to fallbackLocale for missing ones.
+func typeLabelsFor(locale string) map[string]string {
+	types := map[string]string{}
+	for key, label := range typeLabels[fallbackLocale] {
+		types[key] = label
+	}
+	for key, label := range typeLabels[locale] {
+		types[key] = label
+	}
+	return types
+}
+
+// parseLocale normalizes a locale such as "de-AT" to its language code and
+// validates it.
+func parseLocale(raw string) (string, error) {
+	locale := normalizeLanguage(raw)
+	if !languageCodePattern.MatchString(locale) {
+		return "", apierror.New(apierror.InvalidLanguage, "locale must be a two-letter ISO 639-1 code")
+	}
+	return locale, nil
+}
+
+// @Summary Get display strings for a locale
+// @Description Return the display names of the question types and of every tag in a locale, so clients do not maintain their own translations. Strings missing from the locale fall back to English, and tags without any translation to their name. The response carries an ETag; send it back in If-None-Match to get 304 Not Modified while nothing changed.
+// @Tags meta
+// @Produce json
+// @Param locale path string true "Two-letter ISO 639-1 locale; region suffixes such as de-AT are ignored"
+// @Param If-None-Match header string false "ETag of a cached bundle"
+// @Success 200 {object} I18nBundle "Display strings"
+// @Success 304 "Bundle unchanged"
+// @Failure 400 {object} ErrorResponse "Invalid locale"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /i18n/{locale} [get]
+func getI18nBundle(w http.ResponseWriter, r *http.Request) {
+	locale, err := parseLocale(strings.TrimPrefix(r.URL.Path, "/api/i18n/"))
+	if err != nil {
+		respondError(w, err, "Invalid locale")
+		return
+	}
+
+	bundle, err := buildI18nBundle(r.Context(), locale)
+	if err != nil {
+		log.Printf("Failed to build i18n bundle for %q: %v", locale, err)
+		respondError(w, err, "Failed to fetch display strings")
+		return
+	}
+
+	// encoding/json sorts map keys, so equal bundles hash equally
+	body, err := json.Marshal(bundle)
+	if err != nil {
+		log.Printf("Failed to encode i18n bundle: %v", err)
+		writeError(w, apierror.Internal, "Failed to fetch display strings")
+		return
+	}
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache")
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	respondJSON(w, http.StatusOK, bundle)
+}
+
+// @Summary List tag translations
+// @Description List the stored tag display names, optionally for one locale only, ordered by tag and locale
+// @Tags tags
+// @Produce json
+// @Security BearerAuth
+// @Param locale query string false "Only list translations into this locale"
+// @Success 200 {array} TagTranslation "Tag translations"
+// @Failure 400 {object} ErrorResponse "Invalid locale"
+// @Failure 401 {object} ErrorResponse "Missing or invalid API key"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /admin/tag-translations [get]
+func listTagTranslations(w http.ResponseWriter, r *http.Request) {
+	locale := ""
+	if raw := r.URL.Query().Get("locale"); raw != "" {
+		var err error
+		if locale, err = parseLocale(raw); err != nil {
+			respondError(w, err, "Invalid locale")
+			return
+		}
+	}
+
+	translations, err := db.GetTagTranslations(r.Context(), locale)
+	if err != nil {
+		log.Printf("Failed to fetch tag translations: %v", err)
+		respondError(w, err, "Failed to fetch tag translations")
+		return
+	}
+	respondJSON(w, http.StatusOK, translations)
+}
+
+// @Summary Set a tag translation
+// @Description Create or replace the display name of an existing tag in one locale
+// @Tags tags
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param translation body TagTranslation true "Tag, locale and display name"
+// @Success 200 {object} TagTranslation "Stored translation"
+// @Failure 400 {object} ErrorResponse "Invalid translation"
+// @Failure 401 {object} ErrorResponse "Missing or invalid API key"
+// @Failure 404 {object} ErrorResponse "Tag not found"
+// @Failure 413 {object} ErrorResponse "Request body too large"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /admin/tag-translations [put]
+func putTagTranslation(w http.ResponseWriter, r *http.Request) {
+	var t TagTranslation
+	if err := decodeJSONBody(w, r, &t); err != nil {
+		writeBodyError(w, err)
+		return
+	}
+
+	t.Locale = normalizeLanguage(t.Locale)
+	t.DisplayName = strings.TrimSpace(t.DisplayName)
+	var fields []apierror.FieldError
+	if t.Tag == "" {
+		fields = append(fields, apierror.FieldError{Field: "tag", Message: "tag is required"})
+	}
+	if !languageCodePattern.MatchString(t.Locale) {
+		fields = append(fields, apierror.FieldError{Field: "locale", Message: "locale must be a two-letter ISO 639-1 code"})
+	}
+	if t.DisplayName == "" || utf8.RuneCountInString(t.DisplayName) > maxDisplayNameLength {
+		fields = append(fields, apierror.FieldError{Field: "displayName", Message: fmt.Sprintf("displayName must be 1 to %d characters", maxDisplayNameLength)})
+	}
+	if len(fields) > 0 {
+		respondError(w, apierror.Validation(fields...), "Invalid translation")
+		return
+	}
+
+	if err := db.SetTagTranslation(r.Context(), t); err != nil {
+		if !errors.Is(err, ErrTagNotFound) {
+			log.Printf("Failed to save translation of %q: %v", t.Tag, err)
+		}
+		respondError(w, err, "Failed to save translation")
+		return
+	}
+	respondJSON(w, http.StatusOK, t)
+}
+
+// @Summary Delete a tag translation
+// @Description Remove the display name of a tag in one locale; the bundle falls back to English again
+// @Tags tags
+// @Produce json
+// @Security BearerAuth
+// @Param tag query string true "Tag name"
+// @Param locale query string true "Locale of the translation"
+// @Success 204 "Translation deleted"
+// @Failure 400 {object} ErrorResponse "Invalid locale"
+// @Failure 401 {object} ErrorResponse "Missing or invalid API key"
+// @Failure 404 {object} ErrorResponse "Translation not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /admin/tag-translations [delete]
+func deleteTagTranslation(w http.ResponseWriter, r *http.Request) {
+	tag := r.URL.Query().Get("tag")
+	if tag == "" {
+		writeError(w, apierror.InvalidParam, "tag is required")
+		return
+	}
+	locale, err := parseLocale(r.URL.Query().Get("locale"))
+	if err != nil {
+		respondError(w, err, "Invalid locale")
+		return
+	}
+
+	deleted, err := db.DeleteTagTranslation(r.Context(), tag, locale)
+	if err != nil {
+		log.Printf("Failed to delete translation of %q: %v", tag, err)
+		respondError(w, err, "Failed to delete translation")
+		return
+	}
+	if !deleted {
+		writeError(w, apierror.NotFound, "Translation not found")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetTagDisplayNames returns the display name of every tag in locale, keyed
+// by tag name, falling back to the English translation and then to the
+// tag name
+func (d *Database) GetTagDisplayNames(ctx context.Context, locale string) (map[string]string, error) {
+	rows, err := d.db.QueryContext(ctx, `
+        SELECT t.name, COALESCE(l.display_name, f.display_name, t.name)
+        FROM tags t
+        LEFT JOIN tag_translations l ON l.tag_id = t.id AND l.locale = ?
+        LEFT JOIN tag_translations f ON f.tag_id = t.id AND f.locale = ?`, locale, fallbackLocale)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch tag display names: %w", err)
+	}
+	defer rows.Close()
+
+	names := map[string]string{}
+	for rows.Next() {
+		var tag, name string
+		if err := rows.Scan(&tag, &name); err != nil {
+			return nil, fmt.Errorf("failed to parse tag display name: %w", err)
+		}
+		names[tag] = name
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read tag display names: %w", err)
+	}
+	return names, nil
+}
+
+// GetTagTranslations returns the stored tag translations ordered by tag and
+// locale, restricted to locale unless it is empty
+func (d *Database) GetTagTranslations(ctx context.Context, locale string) ([]TagTranslation, error) {
+	query := `
+        SELECT t.name, tt.locale, tt.display_name
+        FROM tag_translations tt
+        INNER JOIN tags t ON tt.tag_id = t.id`
+	var args []interface{}
+	if locale != "" {
+		query += " WHERE tt.locale = ?"
+		args = append(args, locale)
+	}
+
+	rows, err := d.db.QueryContext(ctx, query+" ORDER BY t.name, tt.locale", args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch tag translations: %w", err)
+	}
+	defer rows.Close()
+
+	translations := []TagTranslation{}
+	for rows.Next() {
+		var t TagTranslation
+		if err := rows.Scan(&t.Tag, &t.Locale, &t.DisplayName); err != nil {
+			return nil, fmt.Errorf("failed to parse tag translation: %w", err)
+		}
+		translations = append(translations, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read tag translations: %w", err)
+	}
+	return translations, nil
+}
+
+// SetTagTranslation creates or replaces the display name of a tag in a
+// locale, or returns ErrTagNotFound if the tag does not exist
+func (d *Database) SetTagTranslation(ctx context.Context, t TagTranslation) error {
+	var tagID int64
+	err := d.db.QueryRowContext(ctx, "SELECT id FROM tags WHERE name = ?", t.Tag).Scan(&tagID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrTagNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to query tag %q: %w", t.Tag, err)
+	}
+
+	_, err = d.db.ExecContext(ctx, `
+        INSERT INTO tag_translations (tag_id, locale, display_name) VALUES (?, ?, ?)
+        ON DUPLICATE KEY UPDATE display_name = VALUES(display_name)`,
+		tagID, t.Locale, t.DisplayName)
+	if err != nil {
+		return fmt.Errorf("failed to save translation of %q: %w", t.Tag, err)
+	}
+	return nil
+}
+
+// DeleteTagTranslation removes the display name of a tag in a locale and
+// reports whether one existed
+func (d *Database) DeleteTagTranslation(ctx context.Context, tag, locale string) (bool, error) {
+	result, err := d.db.ExecContext(ctx, `
+        DELETE tt FROM tag_translations tt INNER JOIN tags t ON tt.tag_id = t.id
+        WHERE t.name = ? AND tt.locale = ?`, tag, locale)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete translation of %q: %w", tag, err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get affected rows: %w", err)
+	}
+	return affected > 0, nil
+}
@@ -0,0 +1,406 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/2Friendly4You/TruthOrDare/apierror"
+)
+
+const (
+	// importFetchTimeout bounds the whole fetch of an import document,
+	// including redirects and reading the body.
+	importFetchTimeout = 30 * time.Second
+
+	// maxImportRedirects caps the redirects followed while fetching.
+	maxImportRedirects = 5
+)
+
+// errNonPublicAddress is returned when an import URL resolves to an address
+// that is not publicly routable and IMPORT_URL_ALLOW_PRIVATE is not set.
+var errNonPublicAddress = errors.New("destination address is not publicly routable")
+
+// sharedAddressSpace is the carrier-grade NAT range, which netip does not
+// classify as private.
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// importClient fetches import documents. Every connection, including those
+// made for redirects, is checked by checkPublicAddress after DNS resolution,
+// so a hostname cannot be used to reach internal services. No proxy is used.
+var importClient = &http.Client{
+	Timeout: importFetchTimeout,
+	Transport: &http.Transport{
+		DialContext:         (&net.Dialer{Timeout: 10 * time.Second, Control: checkPublicAddress}).DialContext,
+		TLSHandshakeTimeout: 10 * time.Second,
+	},
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) >= maxImportRedirects {
+			return fmt.Errorf("stopped after %d redirects", maxImportRedirects)
+		}
+		if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+			return fmt.Errorf("redirect to unsupported scheme %q", req.URL.Scheme)
+		}
+		return nil
+	},
+}
+
+// allowPrivateImports reports whether IMPORT_URL_ALLOW_PRIVATE=true, which
+// lets import URLs point at loopback, private and link-local addresses.
+func allowPrivateImports() bool {
+	return os.Getenv("IMPORT_URL_ALLOW_PRIVATE") == "true"
+}
+
+// checkPublicAddress is a net.Dialer Control function rejecting connections
+// to loopback, private, link-local, multicast and unspecified addresses.
+func checkPublicAddress(network, address string, _ syscall.RawConn) error {
+	if allowPrivateImports() {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	ip = ip.Unmap()
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() || sharedAddressSpace.Contains(ip) {
+		return fmt.Errorf("%w: %s", errNonPublicAddress, ip)
+	}
+	return nil
+}
+
+// importDocument is a fetched import document with the validators to store
+// for the next conditional fetch.
+type importDocument struct {
+	body         []byte
+	etag         string
+	lastModified string
+	notModified  bool
+}
+
+// fetchImportDocument downloads rawURL, sending etag and lastModified as
+// conditional request headers when set. Documents larger than
+// maxImportDocumentSize are rejected.
+func fetchImportDocument(ctx context.Context, rawURL, etag, lastModified string) (importDocument, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return importDocument{}, err
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	if lastModified != "" {
+		req.Header.Set("If-Modified-Since", lastModified)
+	}
+
+	resp, err := importClient.Do(req)
+	if err != nil {
+		return importDocument{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		return importDocument{notModified: true, etag: etag, lastModified: lastModified}, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return importDocument{}, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxImportDocumentSize+1))
+	if err != nil {
+		return importDocument{}, fmt.Errorf("failed to read document: %w", err)
+	}
+	if len(body) > maxImportDocumentSize {
+		return importDocument{}, apierror.Newf(apierror.InvalidBody, "document must not be larger than %d bytes", maxImportDocumentSize)
+	}
+
+	return importDocument{
+		body:         body,
+		etag:         resp.Header.Get("ETag"),
+		lastModified: resp.Header.Get("Last-Modified"),
+	}, nil
+}
+
+// parseImportDocument decodes questions from data. format is json (an array
+// of questions), jsonl (one question per line) or csv (a header row naming
+// the columns language, type, task and optionally tags, semicolon-joined,
+// and dare_target; other columns such as id are ignored).
+func parseImportDocument(format string, data []byte) ([]Question, error) {
+	var questions []Question
+	switch format {
+	case "json":
+		if err := json.Unmarshal(data, &questions); err != nil {
+			return nil, fmt.Errorf("document is not a JSON array of questions: %v", err)
+		}
+	case "jsonl":
+		dec := json.NewDecoder(bytes.NewReader(data))
+		for line := 1; ; line++ {
+			var q Question
+			err := dec.Decode(&q)
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("question %d is not a JSON object: %v", line, err)
+			}
+			questions = append(questions, q)
+		}
+	case "csv":
+		records, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+		if err != nil {
+			return nil, fmt.Errorf("document is not valid CSV: %v", err)
+		}
+		if len(records) == 0 {
+			return nil, errors.New("document has no CSV header row")
+		}
+		columns := map[string]int{}
+		for i, name := range records[0] {
+			columns[strings.TrimSpace(name)] = i
+		}
+		for _, name := range []string{"language", "type", "task"} {
+			if _, ok := columns[name]; !ok {
+				return nil, fmt.Errorf("CSV header is missing the %q column", name)
+			}
+		}
+		for _, record := range records[1:] {
+			q := Question{
+				Language: record[columns["language"]],
+				Type:     record[columns["type"]],
+				Task:     record[columns["task"]],
+			}
+			if i, ok := columns["tags"]; ok && record[i] != "" {
+				q.Tags = strings.Split(record[i], ";")
+			}
+			if i, ok := columns["dare_target"]; ok && record[i] != "" {
+				q.DareTarget = &record[i]
+			}
+			questions = append(questions, q)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported format %q", format)
+	}
+	return questions, nil
+}
+
+// ImportURLRequest names a remote document to import questions from
+// @Description Remote document to import and how to handle it
+type ImportURLRequest struct {
+	// http or https URL of the document
+	// @example "https://raw.githubusercontent.com/example/questions/main/questions.json"
+	URL string `json:"url"`
+
+	// Document format: json (array of questions), jsonl or csv
+	// @example "json"
+	Format string `json:"format"`
+
+	// Validate the document and report what would be imported without
+	// inserting anything
+	// @example false
+	DryRun bool `json:"dryRun"`
+
+	// What to do with questions whose task already exists in the same
+	// language: "error" (default) lets the duplicate content filter decide,
+	// "skip" leaves them out of the import
+	// @example "skip"
+	OnConflict string `json:"onConflict,omitempty"`
+}
+
+// ImportURLResponse summarizes an import from a URL
+// @Description Outcome of importing questions from a remote document
+type ImportURLResponse struct {
+	// The imported URL
+	// @example "https://raw.githubusercontent.com/example/questions/main/questions.json"
+	URL string `json:"url"`
+
+	// The document is unchanged since the last import and was not
+	// imported again
+	// @example false
+	NotModified bool `json:"notModified"`
+
+	// Nothing was inserted because dryRun was set
+	// @example false
+	DryRun bool `json:"dryRun"`
+
+	// Number of questions in the document
+	// @example 120
+	Fetched int `json:"fetched"`
+
+	// Number of questions left out because they already exist
+	// @example 20
+	Skipped int `json:"skipped"`
+
+	// Number of questions inserted, or that would be inserted in a dry run
+	// @example 100
+	Inserted int `json:"inserted"`
+
+	// IDs of the inserted questions in document order; empty in a dry run
+	// @example [101,102]
+	IDs []int64 `json:"ids"`
+}
+
+// @Summary Import questions from a URL
+// @Description Fetch a JSON, JSON-lines or CSV document server-side and import its questions in one transaction, like POST /questions/bulk. Only http and https URLs are fetched, with a 30 second timeout and a 4 MiB size cap; URLs resolving to private, loopback or link-local addresses are rejected unless IMPORT_URL_ALLOW_PRIVATE=true. The ETag and Last-Modified of each imported URL are stored, so importing an unchanged document again is a no-op reporting notModified.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param import body ImportURLRequest true "Document to import"
+// @Success 200 {object} ImportURLResponse "Dry run, or the document has not changed"
+// @Success 201 {object} ImportURLResponse "Questions imported"
+// @Failure 400 {object} ErrorResponse "Invalid request, document or question; see fields"
+// @Failure 401 {object} ErrorResponse "Missing or invalid API key"
+// @Failure 413 {object} ErrorResponse "Request body too large"
+// @Failure 502 {object} ErrorResponse "The document could not be fetched"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /questions/import-url [post]
+func importQuestionsFromURL(w http.ResponseWriter, r *http.Request) {
+	var req ImportURLRequest
+	if err := decodeJSONBody(w, r, &req); err != nil {
+		writeBodyError(w, err)
+		return
+	}
+
+	var fields []apierror.FieldError
+	if u, err := url.Parse(req.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		fields = append(fields, apierror.FieldError{Field: "url", Message: "must be an absolute http or https URL"})
+	}
+	if req.Format != "json" && req.Format != "jsonl" && req.Format != "csv" {
+		fields = append(fields, apierror.FieldError{Field: "format", Message: `must be "json", "jsonl" or "csv"`})
+	}
+	if req.OnConflict == "" {
+		req.OnConflict = "error"
+	}
+	if req.OnConflict != "error" && req.OnConflict != "skip" {
+		fields = append(fields, apierror.FieldError{Field: "onConflict", Message: `must be "error" or "skip"`})
+	}
+	if len(fields) > 0 {
+		respondError(w, apierror.Validation(fields...), "Invalid import request")
+		return
+	}
+
+	// A dry run always fetches the document so it can be checked even if
+	// it was imported before.
+	var etag, lastModified string
+	if !req.DryRun {
+		var err error
+		etag, lastModified, err = db.GetImportSource(r.Context(), req.URL)
+		if err != nil {
+			log.Printf("Failed to look up import source: %v", err)
+			respondError(w, err, "Failed to import questions")
+			return
+		}
+	}
+
+	doc, err := fetchImportDocument(r.Context(), req.URL, etag, lastModified)
+	var apiErr *apierror.Error
+	switch {
+	case errors.As(err, &apiErr):
+		respondError(w, err, "Failed to fetch document")
+		return
+	case errors.Is(err, errNonPublicAddress):
+		writeError(w, apierror.InvalidParam, "url resolves to an address that is not publicly routable")
+		return
+	case err != nil:
+		log.Printf("Failed to fetch import document %s: %v", req.URL, err)
+		writeError(w, apierror.UpstreamFailed, fmt.Sprintf("Failed to fetch document: %v", err))
+		return
+	}
+
+	resp := ImportURLResponse{URL: req.URL, DryRun: req.DryRun, IDs: []int64{}}
+	if doc.notModified {
+		resp.NotModified = true
+		respondJSON(w, http.StatusOK, resp)
+		return
+	}
+
+	questions, err := parseImportDocument(req.Format, doc.body)
+	if err != nil {
+		writeError(w, apierror.InvalidBody, err.Error())
+		return
+	}
+	resp.Fetched = len(questions)
+	if len(questions) == 0 || len(questions) > maxImportRows {
+		writeError(w, apierror.InvalidBody, fmt.Sprintf("document must contain between 1 and %d questions", maxImportRows))
+		return
+	}
+	if err := validateBulkQuestions(questions, 0); err != nil {
+		respondError(w, err, "Invalid questions")
+		return
+	}
+
+	// positions maps each question kept for the import to its index in the
+	// document, so errors name the question the client can find.
+	var kept []Question
+	var positions []int
+	for i, q := range questions {
+		if req.OnConflict == "skip" {
+			exists, err := db.TaskExists(r.Context(), q.Language, q.Task, 0)
+			if err != nil {
+				log.Printf("Failed to check for existing question: %v", err)
+				respondError(w, err, "Failed to import questions")
+				return
+			}
+			if exists {
+				resp.Skipped++
+				continue
+			}
+		}
+		kept = append(kept, q)
+		positions = append(positions, i)
+	}
+
+	if req.DryRun {
+		for i, q := range kept {
+			if _, _, _, err := db.prepareQuestion(r.Context(), q); err != nil {
+				respondError(w, bulkImportError(&BulkInsertError{Index: positions[i], Err: err}), "Failed to check questions")
+				return
+			}
+		}
+		resp.Inserted = len(kept)
+		respondJSON(w, http.StatusOK, resp)
+		return
+	}
+
+	if len(kept) > 0 {
+		ids, err := db.AddQuestions(r.Context(), kept)
+		if err != nil {
+			var bulkErr *BulkInsertError
+			if errors.As(err, &bulkErr) {
+				bulkErr.Index = positions[bulkErr.Index]
+			}
+			err = bulkImportError(err)
+			if statusForError(err) >= http.StatusInternalServerError {
+				log.Printf("Failed to import questions from %s: %v", req.URL, err)
+			}
+			respondError(w, err, "Failed to import questions")
+			return
+		}
+		resp.Inserted = len(ids)
+		resp.IDs = ids
+	}
+
+	// The questions are committed; failing to store the validators only
+	// costs a full fetch next time.
+	if err := db.SaveImportSource(r.Context(), req.URL, doc.etag, doc.lastModified); err != nil {
+		log.Printf("Failed to save import source %s: %v", req.URL, err)
+	}
+
+	respondJSON(w, http.StatusCreated, resp)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCheckPublicAddress(t *testing.T) {
+	tests := []struct {
+		address string
+		public  bool
+	}{
+		{"93.184.216.34:443", true},
+		{"[2606:2800:220:1:248:1893:25c8:1946]:443", true},
+		{"127.0.0.1:80", false},
+		{"[::1]:80", false},
+		{"10.1.2.3:80", false},
+		{"172.16.0.1:80", false},
+		{"192.168.1.1:80", false},
+		{"169.254.169.254:80", false},
+		{"100.64.0.1:80", false},
+		{"0.0.0.0:80", false},
+		{"[::]:80", false},
+		{"224.0.0.1:80", false},
+		{"[fd00::1]:80", false},
+		{"[fe80::1]:80", false},
+		{"[::ffff:127.0.0.1]:80", false},
+		{"[::ffff:10.0.0.1]:80", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.address, func(t *testing.T) {
+			err := checkPublicAddress("tcp", tt.address, nil)
+			if tt.public && err != nil {
+				t.Errorf("checkPublicAddress() error = %v", err)
+			}
+			if !tt.public && !errors.Is(err, errNonPublicAddress) {
+				t.Errorf("checkPublicAddress() error = %v, want errNonPublicAddress", err)
+			}
+		})
+	}
+}
+
+func TestCheckPublicAddressAllowPrivate(t *testing.T) {
+	t.Setenv("IMPORT_URL_ALLOW_PRIVATE", "true")
+	if err := checkPublicAddress("tcp", "127.0.0.1:80", nil); err != nil {
+		t.Errorf("checkPublicAddress() error = %v with IMPORT_URL_ALLOW_PRIVATE=true", err)
+	}
+}
+
+func TestCheckPublicAddressMalformed(t *testing.T) {
+	for _, address := range []string{"127.0.0.1", "localhost:80"} {
+		if err := checkPublicAddress("tcp", address, nil); err == nil {
+			t.Errorf("checkPublicAddress(%q) accepted a malformed address", address)
+		}
+	}
+}
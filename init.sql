@@ -8,12 +8,38 @@ CREATE TABLE IF NOT EXISTS questions (
     id INT AUTO_INCREMENT PRIMARY KEY,
     language VARCHAR(50) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL,
     type ENUM('truth', 'dare') NOT NULL,
-    task TEXT CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL
+    task TEXT CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL,
+    dare_target VARCHAR(100) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NULL,
+    attributes JSON NULL,
+    available_from DATETIME NULL,
+    available_until DATETIME NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_questions_language_created_at (language, created_at),
+    INDEX idx_questions_created_at (created_at),
+    INDEX idx_task_prefix (task(255)),
+    FULLTEXT INDEX ft_questions_task (task)
 );
 
 CREATE TABLE IF NOT EXISTS tags (
     id INT AUTO_INCREMENT PRIMARY KEY,
-    name VARCHAR(50) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL UNIQUE
+    name VARCHAR(50) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL UNIQUE,
+    category VARCHAR(50) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NULL,
+    description VARCHAR(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NULL
+);
+
+CREATE TABLE IF NOT EXISTS tag_aliases (
+    tag_id INT NOT NULL,
+    alias VARCHAR(50) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL UNIQUE,
+    FOREIGN KEY (tag_id) REFERENCES tags(id),
+    PRIMARY KEY (tag_id, alias)
+);
+
+CREATE TABLE IF NOT EXISTS tag_translations (
+    tag_id INT NOT NULL,
+    locale CHAR(2) NOT NULL,
+    display_name VARCHAR(100) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL,
+    FOREIGN KEY (tag_id) REFERENCES tags(id),
+    PRIMARY KEY (tag_id, locale)
 );
 
 CREATE TABLE IF NOT EXISTS question_tags (
@@ -24,6 +50,71 @@ CREATE TABLE IF NOT EXISTS question_tags (
     PRIMARY KEY (question_id, tag_id)
 );
 
+CREATE TABLE IF NOT EXISTS question_search (
+    question_id INT PRIMARY KEY,
+    search_tokens TEXT CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL,
+    FOREIGN KEY (question_id) REFERENCES questions(id),
+    FULLTEXT INDEX ft_question_search_tokens (search_tokens)
+);
+
+CREATE TABLE IF NOT EXISTS question_flags (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    question_id INT NOT NULL,
+    filter VARCHAR(50) NOT NULL,
+    reason VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (question_id) REFERENCES questions(id)
+);
+
+CREATE TABLE IF NOT EXISTS change_log (
+    seq BIGINT AUTO_INCREMENT PRIMARY KEY,
+    action ENUM('create', 'update', 'delete') NOT NULL,
+    entity_id INT NOT NULL,
+    occurred_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS share_links (
+    token CHAR(16) PRIMARY KEY,
+    filters JSON NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS games (
+    code CHAR(6) PRIMARY KEY,
+    filters JSON NOT NULL,
+    seed BIGINT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL,
+    INDEX idx_games_expires_at (expires_at)
+);
+
+CREATE TABLE IF NOT EXISTS import_sources (
+    url_hash CHAR(64) PRIMARY KEY,
+    url TEXT NOT NULL,
+    etag VARCHAR(255) NOT NULL DEFAULT '',
+    last_modified VARCHAR(64) NOT NULL DEFAULT '',
+    imported_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS sync_state (
+    upstream_hash CHAR(64) PRIMARY KEY,
+    upstream TEXT NOT NULL,
+    cursor_seq BIGINT NOT NULL DEFAULT 0,
+    applied BIGINT NOT NULL DEFAULT 0,
+    skipped BIGINT NOT NULL DEFAULT 0,
+    last_sync_at DATETIME NULL,
+    last_error TEXT NULL,
+    last_error_at DATETIME NULL
+);
+
+CREATE TABLE IF NOT EXISTS sync_questions (
+    upstream_hash CHAR(64) NOT NULL,
+    upstream_id INT NOT NULL,
+    local_id INT NOT NULL,
+    PRIMARY KEY (upstream_hash, upstream_id),
+    UNIQUE INDEX idx_sync_questions_local_id (local_id)
+);
+
 INSERT INTO questions (language, type, task) VALUES
     ('en', 'truth', 'Have you ever lied to your best friend?'),
     ('en', 'dare', 'Take a shot of vodka.'),
@@ -0,0 +1,426 @@
+//go:build integration
+
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Integration tests run against the MySQL database configured by the
+// variables documented on NewDatabase, which must have the schema of
+// init.sql:
+//
+//	go test -tags integration ./...
+//
+// They only create questions in the otherwise unused language "zz", with
+// tags carrying a per-run prefix, and delete them again.
+
+// integrationLanguage keeps test questions apart from real ones.
+const integrationLanguage = "zz"
+
+// integrationDatabase connects to the configured database or skips the test
+// when MYSQL_HOST is not set.
+func integrationDatabase(t testing.TB) *Database {
+	t.Helper()
+	if os.Getenv("MYSQL_HOST") == "" {
+		t.Skip("MYSQL_HOST not set")
+	}
+	d, err := openDatabase()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { d.Close() })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := d.Ping(ctx); err != nil {
+		t.Fatalf("database not reachable: %v", err)
+	}
+	if err := d.CheckSchema(ctx); err != nil {
+		t.Fatalf("database schema: %v", err)
+	}
+	return d
+}
+
+// testTag returns a tag name unique to this test run.
+func testTag(t testing.TB, name string) string {
+	t.Helper()
+	return fmt.Sprintf("it%d-%s", time.Now().UnixNano()%1e9, name)
+}
+
+// addTestQuestion inserts a question in integrationLanguage with the given
+// tags and deletes it, together with tags no other question uses, when the
+// test ends.
+func addTestQuestion(t testing.TB, d *Database, task string, tags ...string) int {
+	t.Helper()
+	ctx := context.Background()
+	id, err := d.AddQuestion(ctx, Question{Language: integrationLanguage, Type: "truth", Task: task, Tags: tags})
+	if err != nil {
+		t.Fatalf("AddQuestion() error = %v", err)
+	}
+	t.Cleanup(func() {
+		if err := d.DeleteQuestion(context.Background(), int(id), true); err != nil {
+			t.Errorf("failed to delete test question %d: %v", id, err)
+		}
+	})
+	return int(id)
+}
+
+// findQuestion returns the question with the given ID from questions.
+func findQuestion(t *testing.T, questions []Question, id int) Question {
+	t.Helper()
+	for _, q := range questions {
+		if q.ID == id {
+			return q
+		}
+	}
+	t.Fatalf("question %d not returned", id)
+	return Question{}
+}
+
+// sameTags reports whether got and want hold the same tags in any order.
+func sameTags(got, want []string) bool {
+	got = append([]string(nil), got...)
+	want = append([]string(nil), want...)
+	sort.Strings(got)
+	sort.Strings(want)
+	return fmt.Sprint(got) == fmt.Sprint(want)
+}
+
+func TestIntegrationTagFilterReturnsCompleteTagLists(t *testing.T) {
+	d := integrationDatabase(t)
+	funny, party, social := testTag(t, "funny"), testTag(t, "party"), testTag(t, "social")
+	id := addTestQuestion(t, d, "What is the funniest thing you did at a party?", funny, party, social)
+
+	for _, matchAll := range []bool{false, true} {
+		filters := FilterSet{Language: integrationLanguage, Tags: []string{funny}, MatchAllTags: matchAll}
+		questions, err := d.GetQuestions(context.Background(), filters, QueryOptions{})
+		if err != nil {
+			t.Fatalf("GetQuestions() error = %v", err)
+		}
+		if q := findQuestion(t, questions, id); !sameTags(q.Tags, []string{funny, party, social}) {
+			t.Errorf("matchAllTags=%v: tags = %v, want all three", matchAll, q.Tags)
+		}
+	}
+}
+
+func TestIntegrationAnyTagMatchReturnsQuestionOnce(t *testing.T) {
+	d := integrationDatabase(t)
+	funny, party := testTag(t, "funny"), testTag(t, "party")
+	id := addTestQuestion(t, d, "Who was the funniest guest at your last party?", funny, party)
+
+	filters := FilterSet{Language: integrationLanguage, Tags: []string{funny, party}}
+	questions, err := d.GetQuestions(context.Background(), filters, QueryOptions{})
+	if err != nil {
+		t.Fatalf("GetQuestions() error = %v", err)
+	}
+	seen := 0
+	for _, q := range questions {
+		if q.ID == id {
+			seen++
+		}
+	}
+	if seen != 1 {
+		t.Fatalf("question %d returned %d times, want once", id, seen)
+	}
+	if q := findQuestion(t, questions, id); !sameTags(q.Tags, []string{funny, party}) {
+		t.Errorf("tags = %v, want both", q.Tags)
+	}
+}
+
+func TestIntegrationManyTagsAreNotTruncated(t *testing.T) {
+	d := integrationDatabase(t)
+	prefix := testTag(t, "many")
+	tags := make([]string, 200)
+	for i := range tags {
+		tags[i] = fmt.Sprintf("%s-%03d", prefix, i)
+	}
+	id := addTestQuestion(t, d, "Which of your two hundred hobbies do you like best?", tags...)
+
+	questions, err := d.GetQuestions(context.Background(), FilterSet{Language: integrationLanguage, Tags: tags[:1]}, QueryOptions{})
+	if err != nil {
+		t.Fatalf("GetQuestions() error = %v", err)
+	}
+	if q := findQuestion(t, questions, id); !sameTags(q.Tags, tags) {
+		t.Errorf("got %d tags back, want all %d intact", len(q.Tags), len(tags))
+	}
+
+	q, err := d.GetQuestionByID(context.Background(), id)
+	if err != nil {
+		t.Fatalf("GetQuestionByID() error = %v", err)
+	}
+	if !sameTags(q.Tags, tags) {
+		t.Errorf("GetQuestionByID: got %d tags back, want all %d intact", len(q.Tags), len(tags))
+	}
+}
+
+func TestIntegrationExcludeTagsWithTagFilters(t *testing.T) {
+	d := integrationDatabase(t)
+	party, funny, nsfw := testTag(t, "party"), testTag(t, "funny"), testTag(t, "nsfw")
+	clean := addTestQuestion(t, d, "What is your favourite party game?", party)
+	both := addTestQuestion(t, d, "What is the funniest party you remember?", party, funny)
+	excluded := addTestQuestion(t, d, "What is the wildest party you have been to?", party, funny, nsfw)
+	ours := map[int]bool{clean: true, both: true, excluded: true}
+
+	tests := []struct {
+		name    string
+		filters FilterSet
+		want    []int
+	}{
+		{"exclude only", FilterSet{ExcludeTags: []string{nsfw}}, []int{clean, both}},
+		{"include and exclude", FilterSet{Tags: []string{party}, ExcludeTags: []string{nsfw}}, []int{clean, both}},
+		{"excluded tag also requested, any", FilterSet{Tags: []string{funny, nsfw}, ExcludeTags: []string{nsfw}}, []int{both}},
+		{"excluded tag also requested, all", FilterSet{Tags: []string{funny, nsfw}, ExcludeTags: []string{nsfw}, MatchAllTags: true}, nil},
+		{"match all with exclusion", FilterSet{Tags: []string{party, funny}, ExcludeTags: []string{nsfw}, MatchAllTags: true}, []int{both}},
+		{"exclude by wildcard", FilterSet{Tags: []string{party}, ExcludeTags: []string{nsfw[:len(nsfw)-1] + "*"}}, []int{clean, both}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.filters.Language = integrationLanguage
+			questions, err := d.GetQuestions(context.Background(), tt.filters, QueryOptions{})
+			if err != nil {
+				t.Fatalf("GetQuestions() error = %v", err)
+			}
+			var got []int
+			for _, q := range questions {
+				if ours[q.ID] {
+					got = append(got, q.ID)
+				}
+			}
+			sort.Ints(got)
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("got questions %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIntegrationSearch(t *testing.T) {
+	d := integrationDatabase(t)
+	tag := testTag(t, "search")
+	fear := addTestQuestion(t, d, "What is your biggest fear?", tag)
+	percent := addTestQuestion(t, d, "Give away 50% of your snacks", tag)
+	plain := addTestQuestion(t, d, "Do 50 push-ups", tag)
+	ours := map[int]bool{fear: true, percent: true, plain: true}
+
+	tests := []struct {
+		search string
+		want   []int
+	}{
+		{"fear", []int{fear}},
+		{"FEAR", []int{fear}},
+		{"biggest fe", []int{fear}},
+		{"50%", []int{percent}},
+		{"%", []int{percent}},
+		{"_", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.search, func(t *testing.T) {
+			filters := FilterSet{Language: integrationLanguage, Tags: []string{tag}, Search: tt.search}
+			questions, err := d.GetQuestions(context.Background(), filters, QueryOptions{})
+			if err != nil {
+				t.Fatalf("GetQuestions() error = %v", err)
+			}
+			var got []int
+			for _, q := range questions {
+				if ours[q.ID] {
+					got = append(got, q.ID)
+				}
+			}
+			sort.Ints(got)
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("search %q found %v, want %v", tt.search, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestIntegrationDeadlockIsRetried runs two transactions that lock the same
+// two questions in opposite order. The server aborts one of them with a
+// deadlock; withTransaction must re-run it so both succeed.
+func TestIntegrationDeadlockIsRetried(t *testing.T) {
+	d := integrationDatabase(t)
+	tag := testTag(t, "deadlock")
+	first := addTestQuestion(t, d, "Who would you call at 3am?", tag)
+	second := addTestQuestion(t, d, "Who would you never call at 3am?", tag)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// Both transactions hold their first lock before either asks for its
+	// second one, so the first attempts are guaranteed to deadlock.
+	var locked sync.WaitGroup
+	locked.Add(2)
+	var mu sync.Mutex
+	attempts := 0
+
+	lockBoth := func(ids ...int) error {
+		calls := 0
+		return d.withTransaction(ctx, func(tx *sql.Tx) error {
+			calls++
+			mu.Lock()
+			attempts++
+			mu.Unlock()
+			for i, id := range ids {
+				var got int
+				if err := tx.QueryRowContext(ctx, "SELECT id FROM questions WHERE id = ? FOR UPDATE", id).Scan(&got); err != nil {
+					return err
+				}
+				if i == 0 && calls == 1 {
+					locked.Done()
+					locked.Wait()
+				}
+			}
+			return nil
+		})
+	}
+
+	errs := make(chan error, 2)
+	go func() { errs <- lockBoth(first, second) }()
+	go func() { errs <- lockBoth(second, first) }()
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != nil {
+			t.Errorf("withTransaction() error = %v", err)
+		}
+	}
+	if attempts < 3 {
+		t.Errorf("%d attempts, want the deadlocked transaction to be retried", attempts)
+	}
+}
+
+// TestIntegrationConcurrentInsertsShareTags inserts questions with
+// overlapping sets of new tags at the same time. Every tag must be created
+// exactly once and every question must end up with all of its tags.
+func TestIntegrationConcurrentInsertsShareTags(t *testing.T) {
+	d := integrationDatabase(t)
+	shared := []string{testTag(t, "a"), testTag(t, "b"), testTag(t, "c"), testTag(t, "d")}
+
+	const writers = 8
+	tagSets := make([][]string, writers)
+	ids := make([]int64, writers)
+	errs := make([]error, writers)
+	var start, done sync.WaitGroup
+	start.Add(1)
+	for i := range tagSets {
+		// Each writer takes three of the four tags, in a rotating order.
+		tagSets[i] = []string{shared[i%4], shared[(i+1)%4], shared[(i+2)%4]}
+		done.Add(1)
+		go func(i int) {
+			defer done.Done()
+			start.Wait()
+			q := Question{Language: integrationLanguage, Type: "truth", Task: fmt.Sprintf("Concurrent question %d?", i), Tags: tagSets[i]}
+			ids[i], errs[i] = d.AddQuestion(context.Background(), q)
+		}(i)
+	}
+	start.Done()
+	done.Wait()
+
+	inserted := 0
+	for i, id := range ids {
+		var transientErr *TransientError
+		switch {
+		case errs[i] == nil:
+			inserted++
+			id := int(id)
+			t.Cleanup(func() {
+				if err := d.DeleteQuestion(context.Background(), id, true); err != nil {
+					t.Errorf("failed to delete test question %d: %v", id, err)
+				}
+			})
+		case errors.As(errs[i], &transientErr):
+			t.Logf("writer %d gave up after retries: %v", i, errs[i])
+		default:
+			t.Errorf("writer %d: AddQuestion() error = %v", i, errs[i])
+		}
+	}
+	if inserted == 0 {
+		t.Fatal("no concurrent insert succeeded")
+	}
+
+	for _, tag := range shared {
+		var n int
+		if err := d.db.QueryRowContext(context.Background(), "SELECT COUNT(*) FROM tags WHERE name = ?", tag).Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		if n != 1 {
+			t.Errorf("tag %s exists %d times, want once", tag, n)
+		}
+	}
+	for i, id := range ids {
+		if errs[i] != nil {
+			continue
+		}
+		q, err := d.GetQuestionByID(context.Background(), int(id))
+		if err != nil {
+			t.Fatalf("GetQuestionByID(%d) error = %v", id, err)
+		}
+		if !sameTags(q.Tags, tagSets[i]) {
+			t.Errorf("question %d tags = %v, want %v", id, q.Tags, tagSets[i])
+		}
+	}
+}
+
+// BenchmarkIntegrationSearch measures searches against MySQL: one served by
+// the search index and the prefix LIKE, and one that needs the contains
+// LIKE. It seeds searchBenchmarkSize questions first.
+func BenchmarkIntegrationSearch(b *testing.B) {
+	const searchBenchmarkSize = 2000
+	d := integrationDatabase(b)
+	tag := testTag(b, "searchbench")
+
+	ctx := context.Background()
+	subjects := []string{"heights", "spiders", "the dark", "public speaking", "clowns"}
+	var ids []int64
+	b.Cleanup(func() {
+		for _, id := range ids {
+			if err := d.DeleteQuestion(context.Background(), int(id), true); err != nil {
+				b.Errorf("failed to delete benchmark question %d: %v", id, err)
+			}
+		}
+	})
+	for len(ids) < searchBenchmarkSize {
+		batch := make([]Question, importBatchSize)
+		for i := range batch {
+			n := len(ids) + i
+			task := fmt.Sprintf("Question %d: how afraid are you of %s?", n, subjects[n%len(subjects)])
+			if n%10 == 0 {
+				task = fmt.Sprintf("Question %d: give away 50%% of your snacks or tell us about %s", n, subjects[n%len(subjects)])
+			}
+			batch[i] = Question{Language: integrationLanguage, Type: "truth", Task: task, Tags: []string{tag}}
+		}
+		batchIDs, err := d.AddQuestions(ctx, batch)
+		if err != nil {
+			b.Fatalf("AddQuestions() error = %v", err)
+		}
+		ids = append(ids, batchIDs...)
+	}
+
+	for _, search := range []string{"spiders", "50%"} {
+		b.Run(search, func(b *testing.B) {
+			if needsContainsMatch(search, searchTokens(search)) != (search == "50%") {
+				b.Fatalf("search %q does not take the path this benchmark is meant to measure", search)
+			}
+			filters := FilterSet{Language: integrationLanguage, Tags: []string{tag}, Search: search}
+			opts := QueryOptions{Limit: defaultQuestionsLimit}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				questions, err := d.GetQuestions(ctx, filters, opts)
+				if err != nil {
+					b.Fatalf("GetQuestions() error = %v", err)
+				}
+				if len(questions) == 0 {
+					b.Fatalf("search %q found nothing", search)
+				}
+			}
+		})
+	}
+}
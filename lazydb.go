@@ -0,0 +1,83 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"sync/atomic"
+
+	"github.com/2Friendly4You/TruthOrDare/apierror"
+)
+
+// dbReady is set once db has been connected and prepared. Handlers behind
+// requireDB only touch db after observing it, which is what makes assigning
+// db from the background connect in LAZY_DB_INIT mode safe.
+var dbReady atomic.Bool
+
+// lazyDBInit reports whether LAZY_DB_INIT=true, in which case the HTTP
+// server starts before the database is connected.
+func lazyDBInit() bool {
+	return os.Getenv("LAZY_DB_INIT") == "true"
+}
+
+// requireDB answers 503 DB_UNAVAILABLE until the database is ready.
+func requireDB(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !dbReady.Load() {
+			w.Header().Set("Retry-After", "5")
+			writeError(w, apierror.DBUnavailable, "Database is not ready")
+			return
+		}
+		next(w, r)
+	}
+}
+
+// connectDatabaseInBackground connects and prepares the database in its own
+// goroutine, calls onReady and then marks the database ready. Like the eager
+// startup path it exits the program if the connection cannot be established.
+func connectDatabaseInBackground(onReady func()) {
+	go func() {
+		connectDatabase()
+		onReady()
+		dbReady.Store(true)
+		log.Println("Database ready, serving all endpoints.")
+	}()
+}
+
+// ProbeResponse is the body of the liveness and readiness probes
+// @Description Result of a liveness or readiness probe
+type ProbeResponse struct {
+	// Probe result
+	// @example "ok"
+	Status string `json:"status"`
+}
+
+// @Summary Liveness probe
+// @Description Report that the process is up and serving HTTP. Never touches the database.
+// @Tags health
+// @Produce json
+// @Success 200 {object} ProbeResponse "Process is alive"
+// @Router /health/live [get]
+func getHealthLive(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, http.StatusOK, ProbeResponse{Status: "ok"})
+}
+
+// @Summary Readiness probe
+// @Description Report whether the database is connected and answering. Responds 503 while a LAZY_DB_INIT startup is still connecting or when the database stops responding.
+// @Tags health
+// @Produce json
+// @Success 200 {object} ProbeResponse "Ready to serve requests"
+// @Failure 503 {object} ErrorResponse "Database not connected yet or unreachable"
+// @Router /health/ready [get]
+func getHealthReady(w http.ResponseWriter, r *http.Request) {
+	if !dbReady.Load() {
+		writeError(w, apierror.DBUnavailable, "Database is not ready")
+		return
+	}
+	if err := db.Ping(r.Context()); err != nil {
+		log.Printf("Readiness check failed: %v", err)
+		writeError(w, apierror.DBUnavailable, "Database is unreachable")
+		return
+	}
+	respondJSON(w, http.StatusOK, ProbeResponse{Status: "ok"})
+}
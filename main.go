@@ -9,17 +9,37 @@
 // @contact.name API Support
 // @contact.url https://github.com/2Friendly4You/TruthOrDare
 // @license.name MIT
+// @securityDefinitions.apikey BearerAuth
+// @in header
+// @name Authorization
+// @description Type "Bearer" followed by a space and the API key.
 package main
 
 import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+	"unicode/utf8"
 
+	"github.com/2Friendly4You/TruthOrDare/apierror"
 	_ "github.com/2Friendly4You/TruthOrDare/docs" // Generated swagger docs
 	"github.com/joho/godotenv"
-	httpSwagger "github.com/swaggo/http-swagger"
 )
 
 // ErrorResponse represents a standard error response
@@ -27,8 +47,11 @@ import (
 type ErrorResponse struct {
 	// Error message describing what went wrong
 	Message string `json:"message"`
-	// Optional error code for client handling
-	Code string `json:"code,omitempty"`
+	// Machine-readable error code from the catalog at GET /errors
+	// @example "INVALID_PARAM"
+	Code string `json:"code"`
+	// Per-field problems, present with VALIDATION_FAILED
+	Fields []apierror.FieldError `json:"fields,omitempty"`
 }
 
 // Question represents a truth or dare question with its associated metadata
@@ -53,66 +76,1265 @@ type Question struct {
 	// @minLength 3
 	Task string `json:"task"`
 
+	// Player placeholder for directed dares, filled in client side from the
+	// player list. Only valid when type is "dare".
+	// @example "{player_name}"
+	DareTarget *string `json:"dare_target,omitempty"`
+
+	// Extension attributes allowed by the attribute schema, mapping keys to
+	// string, number or bool values
+	// @example {"indoor":true,"players":2}
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+
+	// Start of the window in which the question is served; unset means
+	// available since creation
+	// @example "2026-10-01T00:00:00Z"
+	AvailableFrom *time.Time `json:"available_from,omitempty"`
+
+	// End of the window in which the question is served, exclusive; unset
+	// means no expiry
+	// @example "2026-11-01T00:00:00Z"
+	AvailableUntil *time.Time `json:"available_until,omitempty"`
+
 	// Array of associated tag names
 	// @example ["funny","social","party"]
 	Tags []string `json:"tags"`
+
+	// HTML-escaped task with search matches wrapped in highlight markup,
+	// only present when a search term was given
+	// @example "What is your biggest <mark>fear</mark>?"
+	HighlightedTask string `json:"highlightedTask,omitempty"`
+}
+
+// Change log actions recorded for question writes.
+const (
+	ChangeCreate = "create"
+	ChangeUpdate = "update"
+	ChangeDelete = "delete"
+)
+
+// Limits for the change feed page size.
+const (
+	defaultChangesLimit = 100
+	maxChangesLimit     = 1000
+)
+
+// ChangeLogEntry describes a single change to a question
+// @Description An entry in the question change feed
+type ChangeLogEntry struct {
+	// Monotonically increasing sequence number
+	// @example 1234
+	Seq int64 `json:"seq"`
+
+	// Kind of change
+	// @example "create"
+	// @enum "create" "update" "delete"
+	Action string `json:"action"`
+
+	// ID of the question that changed
+	// @example 42
+	EntityID int64 `json:"entity_id"`
+
+	// Time the change was committed
+	OccurredAt time.Time `json:"occurred_at"`
+}
+
+// ChangesResponse is a page of the change feed
+// @Description A page of question changes and the cursor for the next poll
+type ChangesResponse struct {
+	// Changes in sequence order
+	Changes []ChangeLogEntry `json:"changes"`
+
+	// Value to pass as since_seq on the next poll
+	// @example 1334
+	NextSeq int64 `json:"next_seq"`
+}
+
+// ExplainResponse shows the SQL generated for a filter set
+// @Description Generated SQL statement and bound parameters for a question query
+type ExplainResponse struct {
+	// SQL statement with ? placeholders
+	SQL string `json:"sql"`
+
+	// Parameters bound to the placeholders, in order
+	// @example ["en","truth","funny"]
+	Args []interface{} `json:"args"`
+}
+
+// HealthResponse reports the process status
+// @Description Service status and uptime information
+type HealthResponse struct {
+	// Overall status
+	// @example "ok"
+	Status string `json:"status"`
+
+	// Time the process started
+	StartedAt time.Time `json:"startedAt"`
+
+	// Seconds since the process started
+	// @example 3600
+	UptimeSeconds int64 `json:"uptimeSeconds"`
+
+	// Number of questions per type, omitted if the database could not be
+	// queried
+	// @example {"truth":500,"dare":3}
+	TypeCounts map[string]int `json:"type_counts,omitempty"`
+}
+
+// defaultMinQuestionsPerType is the question count per type below which
+// startup logs a warning, unless MIN_QUESTIONS_PER_TYPE overrides it.
+const defaultMinQuestionsPerType = 10
+
+// S3ExportRequest names the destination of an S3 export
+// @Description Destination object for a compressed question export
+type S3ExportRequest struct {
+	// Target bucket
+	// @example "my-bucket"
+	Bucket string `json:"bucket"`
+
+	// Target object key
+	// @example "backup.jsonl.gz"
+	Key string `json:"key"`
+}
+
+// S3ExportResponse reports a completed S3 export
+// @Description Destination of a completed question export
+type S3ExportResponse struct {
+	// Target bucket
+	Bucket string `json:"bucket"`
+
+	// Target object key
+	Key string `json:"key"`
+}
+
+// ShareLinkResponse holds a shareable question pack URL
+// @Description A URL that reproduces a set of question filters
+type ShareLinkResponse struct {
+	// URL of the question list with the filters encoded in the pack
+	// parameter; a path relative to the API host when BASE_URL is not set
+	// @example "https://example.com/api/questions?pack=eyJsYW5ndWFnZSI6ImVuIn0"
+	URL string `json:"url"`
+
+	// Token under which the filters were stored, only set when save=true
+	// @example "3f9a1c2b7d4e8f60"
+	Token string `json:"token,omitempty"`
+}
+
+// Limits for GET /questions/new.
+const (
+	newQuestionsMaxAge       = 365 * 24 * time.Hour
+	defaultNewQuestionsLimit = 20
+	maxNewQuestionsLimit     = 100
+)
+
+// NewQuestionsResponse reports questions added since a point in time
+// @Description Count and optional first page of questions created after a point in time
+type NewQuestionsResponse struct {
+	// Start of the window that was counted
+	Since time.Time `json:"since"`
+
+	// Number of questions created after since
+	// @example 12
+	Count int `json:"count"`
+
+	// Newest questions first, only present when includeQuestions=true
+	Questions []Question `json:"questions,omitempty"`
+}
+
+// maxCommonTagsIDs caps the number of questions in a common-tags request.
+const maxCommonTagsIDs = 500
+
+// CommonTagsRequest selects the questions to compare
+// @Description A selection of question IDs
+type CommonTagsRequest struct {
+	// IDs of the selected questions
+	// @example [1,2,4]
+	IDs []int `json:"ids"`
+}
+
+// CommonTagsResponse lists the tags shared by a selection of questions
+// @Description Tags shared by all and by any of the selected questions
+type CommonTagsResponse struct {
+	// Tags present on every selected question
+	// @example ["18+"]
+	Intersection []string `json:"intersection"`
+
+	// Tags present on at least one selected question
+	// @example ["18+","alcohol"]
+	Union []string `json:"union"`
 }
 
 var db *Database
 
-// initializeDatabase loads environment variables and establishes
-// the database connection. Exits the program if initialization fails.
-func initializeDatabase() {
-	err := godotenv.Load()
+// startTime records when the process started, for uptime reporting.
+var startTime = time.Now()
+
+// connectDatabase establishes the database connection and prepares it for
+// serving. Exits the program if initialization fails. It does not mark the
+// database ready; see dbReady.
+func connectDatabase() {
+	conn, err := NewDatabase()
 	if err != nil {
-		log.Fatalf("Error loading .env file: %v", err)
+		log.Fatal(err)
 	}
 
-	var dbErr error
-	db, dbErr = NewDatabase()
-	if dbErr != nil {
-		log.Fatal(dbErr)
+	log.Println("Connected to the database.")
+
+	filters, err := loadContentFilters(conn)
+	if err != nil {
+		log.Fatal(err)
 	}
+	conn.SetContentFilters(filters)
+	db = conn
 
-	log.Println("Connected to the database.")
+	warnOnTypeImbalance()
+	ensureSearchIndex()
+}
+
+// warnOnTypeImbalance logs a warning for every question type with fewer
+// questions than MIN_QUESTIONS_PER_TYPE (default 10), so content gaps show up
+// at startup rather than during a game.
+func warnOnTypeImbalance() {
+	minPerType := defaultMinQuestionsPerType
+	if raw := os.Getenv("MIN_QUESTIONS_PER_TYPE"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			log.Printf("Ignoring invalid MIN_QUESTIONS_PER_TYPE %q", raw)
+		} else {
+			minPerType = n
+		}
+	}
+
+	counts, err := db.CheckTypeBalance(context.Background())
+	if err != nil {
+		log.Printf("Failed to check question type balance: %v", err)
+		return
+	}
+	for _, qType := range []string{"truth", "dare"} {
+		if counts[qType] < minPerType {
+			log.Printf("WARNING: only %d '%s' questions available — game quality may be poor", counts[qType], qType)
+		}
+	}
+}
+
+// QuestionsByType is the response of GET /questions with groupBy=type
+// @Description A page of questions partitioned by type
+type QuestionsByType struct {
+	// Truth questions of the page, in ID order
+	Truth []Question `json:"truth"`
+
+	// Dare questions of the page, in ID order
+	Dare []Question `json:"dare"`
+}
+
+// groupQuestionsByType partitions questions by type, keeping their order.
+// Both groups are non-nil so they encode as arrays.
+func groupQuestionsByType(questions []Question) QuestionsByType {
+	grouped := QuestionsByType{Truth: []Question{}, Dare: []Question{}}
+	for _, q := range questions {
+		if q.Type == "dare" {
+			grouped.Dare = append(grouped.Dare, q)
+		} else {
+			grouped.Truth = append(grouped.Truth, q)
+		}
+	}
+	return grouped
 }
 
 // @Summary Retrieve questions
-// @Description Get a list of truth or dare questions with optional filtering capabilities
+// @Description Get a list of truth or dare questions with optional filtering capabilities. Results are paged in ID order, 100 questions per page unless limit is given, and X-Total-Count holds the number of matching questions. With groupBy=type the page is returned as an object holding the truths and the dares separately. Send Accept: application/msgpack to receive MessagePack instead of JSON.
 // @Tags questions
 // @Accept json
-// @Produce json
-// @Param language query string false "ISO 639-1 language code filter (2 characters)" example(en)
+// @Produce json,application/msgpack
+// @Param language query string false "ISO 639-1 language code filter; region subtags and case are ignored" example(en)
 // @Param type query string false "Question type filter" Enums(truth, dare)
-// @Param tags query []string false "Filter questions by tags (comma-separated)" example(funny,party,social)
+// @Param tags query []string false "Filter questions by tags (comma-separated); a trailing * matches every tag with that prefix" example(funny,party,social)
+// @Param excludeTags query []string false "Leave out questions carrying any of these tags (comma-separated); a trailing * matches every tag with that prefix" example(nsfw,alcohol)
 // @Param matchAllTags query boolean false "Require all specified tags to match (true) or any tag (false)" default(false)
+// @Param has_dare_target query boolean false "Only directed dares (true) or only questions without a target (false)"
+// @Param includeScheduled query boolean false "Also return questions outside their available_from/available_until window" default(false)
+// @Param search query string false "Full-text search over the task text matching word prefixes, plus tasks that start with the text; text with symbols such as 50% or words under three letters is matched anywhere in the task; matches are highlighted in highlightedTask" example(fear)
+// @Param attr.{key} query string false "Filter on a question attribute from the attribute schema, e.g. attr.indoor=true"
+// @Param pack query string false "Filters from a share link; explicit filter parameters take precedence"
+// @Param field_order query string false "canonical: emit question fields in the fixed order id, language, type, task, dare_target, attributes, available_from, available_until, highlightedTask, tags" Enums(canonical)
+// @Param fields query []string false "Only return these fields; id is always included and other fields come back empty" Enums(id, language, type, task, dare_target, attributes, available_from, available_until, tags)
+// @Param limit query integer false "Maximum number of questions to return (max 500); questions are ordered by ID" default(100)
+// @Param offset query integer false "Number of questions to skip, in ID order" default(0)
+// @Param groupBy query string false "type: return an object with truth and dare arrays instead of a flat array; limit and offset apply before grouping" Enums(type)
+// @Param emptyAs204 query boolean false "Respond 204 No Content instead of an empty array when nothing matches" default(false)
+// @Param explain query boolean false "When nothing matches, respond with an object holding per-filter diagnostics instead of an empty array; takes precedence over emptyAs204" default(false)
 // @Success 200 {array} Question "List of matching questions"
+// @Header 200 {integer} X-Total-Count "Number of questions matching the filters across all pages"
+// @Success 200 {object} QuestionsByType "Matching questions grouped by type when groupBy=type"
+// @Success 200 {object} ExplainedQuestionsResponse "Empty result with diagnostics when explain=true"
+// @Success 204 "No questions matched and emptyAs204=true"
 // @Failure 400 {object} ErrorResponse "Invalid request parameters"
 // @Failure 500 {object} ErrorResponse "Internal server error"
 // @Router /questions [get]
 func getQuestions(w http.ResponseWriter, r *http.Request) {
-	language := r.URL.Query().Get("language")
-	qType := r.URL.Query().Get("type")
-	tags := r.URL.Query()["tags"]
-	matchAllTags := r.URL.Query().Get("matchAllTags") == "true"
+	filters, err := ParseFilterSet(r.URL.Query())
+	if err != nil {
+		respondError(w, err, "Invalid filters")
+		return
+	}
 
-	config := &QueryConfig{
-		MatchAllTags: matchAllTags,
+	fieldOrder := r.URL.Query().Get("field_order")
+	if fieldOrder != "" && fieldOrder != "canonical" {
+		writeError(w, apierror.InvalidParam, "field_order must be \"canonical\"")
+		return
+	}
+
+	groupBy := r.URL.Query().Get("groupBy")
+	if groupBy != "" && groupBy != "type" {
+		writeError(w, apierror.InvalidParam, "groupBy must be \"type\"")
+		return
+	}
+
+	opts := QueryOptions{Limit: defaultQuestionsLimit}
+	if raw := r.URL.Query().Get("fields"); raw != "" {
+		for _, field := range strings.Split(raw, ",") {
+			field = strings.TrimSpace(field)
+			if !IsQuestionField(field) {
+				writeError(w, apierror.InvalidParam, fmt.Sprintf("unknown field %q in fields", field))
+				return
+			}
+			opts.Fields = append(opts.Fields, field)
+		}
+	}
+
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		opts.Limit, err = strconv.Atoi(raw)
+		if err != nil || opts.Limit < 1 || opts.Limit > maxQuestionsLimit {
+			writeError(w, apierror.InvalidParam, fmt.Sprintf("limit must be an integer between 1 and %d", maxQuestionsLimit))
+			return
+		}
+	}
+	if raw := r.URL.Query().Get("offset"); raw != "" {
+		opts.Offset, err = strconv.Atoi(raw)
+		if err != nil || opts.Offset < 0 {
+			writeError(w, apierror.InvalidParam, "offset must be a non-negative integer")
+			return
+		}
 	}
 
 	// deepcode ignore Sqli: <is validated by the database driver>
-	questions, err := db.GetQuestions(language, qType, tags, config)
+	questions, err := db.GetQuestions(r.Context(), filters, opts)
+	if errors.Is(err, context.Canceled) {
+		log.Printf("Client went away while fetching questions")
+		return
+	}
 	if err != nil {
 		log.Printf("Failed to fetch questions: %v", err)
-		http.Error(w, "Failed to fetch questions", http.StatusInternalServerError)
+		respondError(w, err, "Failed to fetch questions")
+		return
+	}
+
+	total, err := db.CountQuestions(r.Context(), filters)
+	if err != nil {
+		log.Printf("Failed to count questions: %v", err)
+		respondError(w, err, "Failed to fetch questions")
+		return
+	}
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+
+	if len(questions) == 0 && r.URL.Query().Get("explain") == "true" {
+		diagnostics, err := diagnoseEmptyResult(r.Context(), db, filters)
+		if err != nil {
+			log.Printf("Failed to diagnose empty result: %v", err)
+			respondError(w, err, "Failed to fetch questions")
+			return
+		}
+		respondNegotiated(w, r, http.StatusOK, ExplainedQuestionsResponse{Questions: []Question{}, Diagnostics: diagnostics})
+		return
+	}
+
+	if len(questions) == 0 && r.URL.Query().Get("emptyAs204") == "true" {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if filters.Search != "" {
+		highlightQuestions(questions, filters.Search)
+	}
+
+	if groupBy == "type" {
+		grouped := groupQuestionsByType(questions)
+		if fieldOrder == "canonical" {
+			respondNegotiated(w, r, http.StatusOK, struct {
+				Truth []canonicalQuestion `json:"truth"`
+				Dare  []canonicalQuestion `json:"dare"`
+			}{canonicalQuestions(grouped.Truth), canonicalQuestions(grouped.Dare)})
+			return
+		}
+		respondNegotiated(w, r, http.StatusOK, grouped)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json; charset=utf-8")
-	if err := json.NewEncoder(w).Encode(questions); err != nil {
-		log.Printf("Failed to encode questions to JSON: %v", err)
-		http.Error(w, "Failed to encode questions to JSON", http.StatusInternalServerError)
+	if fieldOrder == "canonical" {
+		respondNegotiated(w, r, http.StatusOK, canonicalQuestions(questions))
+		return
+	}
+	respondNegotiated(w, r, http.StatusOK, questions)
+}
+
+// languageCodePattern matches the two-letter codes questions are stored with.
+var languageCodePattern = regexp.MustCompile(`^[a-z]{2}$`)
+
+// minTaskLength is the shortest task accepted by createQuestion.
+const minTaskLength = 3
+
+// maxRequestBodySize caps JSON request bodies read by decodeJSONBody.
+const maxRequestBodySize = 64 << 10
+
+// decodeJSONBody decodes the request body into v. Decoding errors are turned
+// into messages that name the offending field or position, suitable for
+// returning to the client. Bodies larger than maxRequestBodySize and trailing
+// data after the JSON value are rejected.
+func decodeJSONBody(w http.ResponseWriter, r *http.Request, v interface{}) error {
+	return decodeJSONBodyLimit(w, r, v, maxRequestBodySize)
+}
+
+// decodeJSONBodyLimit is decodeJSONBody with a custom body size limit.
+func decodeJSONBodyLimit(w http.ResponseWriter, r *http.Request, v interface{}, limit int64) error {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, limit))
+	err := dec.Decode(v)
+	if err == nil && dec.More() {
+		return errors.New("request body must contain a single JSON value")
+	}
+	return describeJSONError(err)
+}
+
+// describeJSONError turns an error from decoding a request body into a
+// message suitable for the client, or returns nil for a nil error.
+func describeJSONError(err error) error {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case err == nil:
+		return nil
+	case errors.As(err, &maxBytesErr):
+		return apierror.Newf(apierror.PayloadTooLarge, "request body must not be larger than %d bytes", maxBytesErr.Limit)
+	case errors.Is(err, io.EOF):
+		return errors.New("request body is empty")
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return errors.New("request body contains incomplete JSON")
+	case errors.As(err, &syntaxErr):
+		return fmt.Errorf("request body contains malformed JSON at position %d", syntaxErr.Offset)
+	case errors.As(err, &typeErr):
+		if typeErr.Field == "" {
+			return fmt.Errorf("request body must be a JSON %s, not %s", jsonTypeName(typeErr.Type), typeErr.Value)
+		}
+		return fmt.Errorf("field %q must be of type %s, not %s", typeErr.Field, jsonTypeName(typeErr.Type), typeErr.Value)
+	default:
+		return fmt.Errorf("invalid request body: %v", err)
+	}
+}
+
+// writeBodyError reports an error returned by decodeJSONBody:
+// PAYLOAD_TOO_LARGE for a body over the size limit and
+// INVALID_BODY for anything else.
+func writeBodyError(w http.ResponseWriter, err error) {
+	code := apierror.InvalidBody
+	var apiErr *apierror.Error
+	if errors.As(err, &apiErr) {
+		code = apiErr.Code
 	}
+	writeError(w, code, err.Error())
+}
+
+// jsonTypeName describes a Go type by the JSON type a client should send.
+func jsonTypeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	case reflect.Ptr:
+		return jsonTypeName(t.Elem())
+	default:
+		return "object"
+	}
+}
+
+// validateQuestion checks a question submitted by a client and returns a
+// VALIDATION_FAILED error listing every invalid field, or nil if it is
+// valid. The language must already be normalized.
+func validateQuestion(q Question) error {
+	var fields []apierror.FieldError
+	if !languageCodePattern.MatchString(q.Language) {
+		fields = append(fields, apierror.FieldError{Field: "language", Message: "language must be a two-letter ISO 639-1 code"})
+	}
+	if q.Type != "truth" && q.Type != "dare" {
+		fields = append(fields, apierror.FieldError{Field: "type", Message: "type must be \"truth\" or \"dare\""})
+	}
+	if utf8.RuneCountInString(strings.TrimSpace(q.Task)) < minTaskLength {
+		fields = append(fields, apierror.FieldError{Field: "task", Message: "task must be at least 3 characters"})
+	}
+	for _, tag := range q.Tags {
+		if !tagNamePattern.MatchString(tag) {
+			fields = append(fields, apierror.FieldError{Field: "tags", Message: fmt.Sprintf("tag %q may only contain letters, digits, -, _, + and :", tag)})
+			break
+		}
+	}
+	if q.AvailableFrom != nil && q.AvailableUntil != nil && !q.AvailableUntil.After(*q.AvailableFrom) {
+		fields = append(fields, apierror.FieldError{Field: "available_until", Message: "available_until must be after available_from"})
+	}
+	if len(fields) > 0 {
+		return apierror.Validation(fields...)
+	}
+	return nil
+}
+
+// @Summary Create a question
+// @Description Add a new truth or dare question with optional tags. The language is normalized before validation, so "EN" and "en-US" are stored as "en".
+// @Tags questions
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param question body Question true "Question to create; id is ignored"
+// @Success 201 {object} Question "Created question including its ID"
+// @Failure 400 {object} ErrorResponse "Invalid question data"
+// @Failure 401 {object} ErrorResponse "Missing or invalid API key"
+// @Failure 409 {object} ErrorResponse "Conflicting question"
+// @Failure 413 {object} ErrorResponse "Request body too large"
+// @Failure 422 {object} ErrorResponse "Field not allowed for the question type or rejected by a content filter"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /questions [post]
+func createQuestion(w http.ResponseWriter, r *http.Request) {
+	var q Question
+	if err := decodeJSONBody(w, r, &q); err != nil {
+		writeBodyError(w, err)
+		return
+	}
+
+	q.Language = normalizeLanguage(q.Language)
+	if err := validateQuestion(q); err != nil {
+		respondError(w, err, "Invalid question")
+		return
+	}
+
+	id, err := db.AddQuestion(r.Context(), q)
+	if err != nil {
+		log.Printf("Failed to create question: %v", err)
+		respondError(w, err, "Failed to create question")
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, writtenQuestion(q, int(id)))
+}
+
+// writtenQuestion returns q as createQuestion and updateQuestion echo it
+// after the write: sanitized like the stored row, with its ID and without
+// duplicate tags. Tags is never nil, so a question without tags is echoed
+// with "tags": [] just as the read endpoints return it.
+func writtenQuestion(q Question, id int) Question {
+	q = sanitizeQuestion(q)
+	q.ID = id
+	q.Tags = uniqueStrings(q.Tags)
+	return q
+}
+
+const (
+	// defaultMaxImportRows is the number of questions a bulk import may
+	// contain when MAX_IMPORT_ROWS is not set.
+	defaultMaxImportRows = 100000
+
+	// importBatchSize is the number of questions a bulk import inserts per
+	// transaction.
+	importBatchSize = 100
+
+	// maxImportRowSize is the request body allowance per question of a bulk
+	// import; the body may be at most maxImportRows times this size.
+	maxImportRowSize = 4 << 10
+
+	// maxImportDocumentSize caps documents fetched by an import from a URL
+	// and responses from the sync upstream.
+	maxImportDocumentSize = 4 << 20
+)
+
+// maxImportRows caps the number of questions in one bulk import, see
+// loadMaxImportRows.
+var maxImportRows = defaultMaxImportRows
+
+// loadMaxImportRows reads MAX_IMPORT_ROWS, the most questions a single bulk
+// import or import from a URL may contain (default 100000).
+func loadMaxImportRows() (int, error) {
+	raw := os.Getenv("MAX_IMPORT_ROWS")
+	if raw == "" {
+		return defaultMaxImportRows, nil
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("invalid MAX_IMPORT_ROWS %q: must be a positive integer", raw)
+	}
+	return n, nil
+}
+
+// BulkImportResponse reports the questions created by a bulk import
+// @Description IDs of the questions created by a bulk import. When the import stopped early, code, message and fields describe the error and the questions listed were still inserted.
+type BulkImportResponse struct {
+	// Number of questions inserted
+	// @example 2
+	Inserted int `json:"inserted"`
+
+	// IDs of the inserted questions, in request order
+	// @example [101,102]
+	IDs []int64 `json:"ids"`
+
+	// Error code from the catalog when the import stopped early
+	// @example "VALIDATION_FAILED"
+	Code string `json:"code,omitempty"`
+
+	// Why the import stopped early
+	Message string `json:"message,omitempty"`
+
+	// Per-field problems of the question the import stopped at
+	Fields []apierror.FieldError `json:"fields,omitempty"`
+}
+
+// @Summary Import questions in bulk
+// @Description Create up to MAX_IMPORT_ROWS questions (default 100000). The body is read as a stream and the questions are inserted in transactions of 100. If a question is invalid or rejected, the import stops there: the response lists the failing question's index in fields, e.g. "[3].task", and, if earlier batches were already inserted, their IDs.
+// @Tags questions
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param questions body []Question true "Questions to create; ids are ignored"
+// @Success 201 {object} BulkImportResponse "Created questions"
+// @Failure 400 {object} BulkImportResponse "Invalid request body, too many questions or a question failed; see fields"
+// @Failure 401 {object} ErrorResponse "Missing or invalid API key"
+// @Failure 413 {object} BulkImportResponse "Request body too large"
+// @Failure 500 {object} BulkImportResponse "Internal server error"
+// @Router /questions/bulk [post]
+func importQuestions(w http.ResponseWriter, r *http.Request) {
+	ids, err := importQuestionStream(w, r)
+	if err != nil {
+		if statusForError(err) >= http.StatusInternalServerError {
+			log.Printf("Failed to import questions after %d inserted: %v", len(ids), err)
+		}
+		if len(ids) == 0 {
+			respondError(w, err, "Failed to import questions")
+			return
+		}
+		errResp := errorResponse(err, "Failed to import questions")
+		respondJSON(w, statusForError(err), BulkImportResponse{
+			Inserted: len(ids),
+			IDs:      ids,
+			Code:     errResp.Code,
+			Message:  errResp.Message,
+			Fields:   errResp.Fields,
+		})
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, BulkImportResponse{Inserted: len(ids), IDs: ids})
+}
+
+// importQuestionStream reads the JSON array of a bulk import one question at
+// a time and inserts the questions in batches of importBatchSize, so only one
+// batch is held in memory. It returns the IDs inserted so far together with
+// the error that stopped the import, if any. A body with more than
+// maxImportRows questions is rejected as soon as the limit is passed, and
+// errors name the index of the offending question.
+func importQuestionStream(w http.ResponseWriter, r *http.Request) ([]int64, error) {
+	countErr := apierror.Newf(apierror.InvalidBody, "request body must contain between 1 and %d questions", maxImportRows)
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, int64(maxImportRows)*maxImportRowSize))
+
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, bodyError(describeJSONError(err))
+	}
+	if tok != json.Delim('[') {
+		return nil, apierror.New(apierror.InvalidBody, "request body must be a JSON array of questions")
+	}
+
+	var ids []int64
+	batch := make([]Question, 0, importBatchSize)
+	flush := func() error {
+		offset := len(ids)
+		if err := validateBulkQuestions(batch, offset); err != nil {
+			return err
+		}
+		batchIDs, err := db.AddQuestions(r.Context(), batch)
+		if err != nil {
+			var bulkErr *BulkInsertError
+			if errors.As(err, &bulkErr) {
+				bulkErr.Index += offset
+			}
+			return bulkImportError(err)
+		}
+		ids = append(ids, batchIDs...)
+		batch = batch[:0]
+		return nil
+	}
+
+	for n := 0; dec.More(); n++ {
+		if n == maxImportRows {
+			return ids, countErr
+		}
+		var q Question
+		if err := dec.Decode(&q); err != nil {
+			return ids, bodyError(fmt.Errorf("[%d]: %w", n, describeJSONError(err)))
+		}
+		batch = append(batch, q)
+		if len(batch) == importBatchSize {
+			if err := flush(); err != nil {
+				return ids, err
+			}
+		}
+	}
+	if _, err := dec.Token(); err != nil {
+		return ids, bodyError(describeJSONError(err))
+	}
+	if dec.More() {
+		return ids, apierror.New(apierror.InvalidBody, "request body must contain a single JSON value")
+	}
+	if len(batch) > 0 {
+		if err := flush(); err != nil {
+			return ids, err
+		}
+	}
+	if len(ids) == 0 {
+		return nil, countErr
+	}
+	return ids, nil
+}
+
+// bodyError returns err as an INVALID_BODY error unless it already carries
+// a catalog code, such as PAYLOAD_TOO_LARGE.
+func bodyError(err error) error {
+	var apiErr *apierror.Error
+	if errors.As(err, &apiErr) {
+		return err
+	}
+	return apierror.New(apierror.InvalidBody, err.Error())
+}
+
+// validateBulkQuestions normalizes the language of every question and
+// validates it. Field errors of all questions are collected into one
+// validation error, with each field prefixed by the question's index plus
+// offset, e.g. "[3].task".
+func validateBulkQuestions(questions []Question, offset int) error {
+	var fields []apierror.FieldError
+	for i := range questions {
+		questions[i].Language = normalizeLanguage(questions[i].Language)
+		var validationErr *apierror.Error
+		if errors.As(validateQuestion(questions[i]), &validationErr) {
+			for _, field := range validationErr.Fields {
+				field.Field = fmt.Sprintf("[%d].%s", offset+i, field.Field)
+				fields = append(fields, field)
+			}
+		}
+	}
+	if len(fields) > 0 {
+		return apierror.Validation(fields...)
+	}
+	return nil
+}
+
+// bulkImportError turns a client error from AddQuestions into a validation
+// error naming the failing question's index. Other errors are returned
+// unchanged.
+func bulkImportError(err error) error {
+	var bulkErr *BulkInsertError
+	if errors.As(err, &bulkErr) && statusForError(bulkErr.Err) < http.StatusInternalServerError {
+		return apierror.Validation(apierror.FieldError{
+			Field:   fmt.Sprintf("[%d]", bulkErr.Index),
+			Message: bulkErr.Err.Error(),
+		})
+	}
+	return err
+}
+
+// maxRandomCount caps the count parameter of GET /questions/random.
+const maxRandomCount = 50
+
+// @Summary Retrieve random questions
+// @Description Get one random question matching the filters, selected in the database. With count, return up to that many distinct random questions as an array instead. Send Accept: application/msgpack to receive MessagePack instead of JSON.
+// @Tags questions
+// @Produce json,application/msgpack
+// @Param language query string false "ISO 639-1 language code filter" example(en)
+// @Param type query string false "Question type filter" Enums(truth, dare)
+// @Param tags query []string false "Filter questions by tags (comma-separated); a trailing * matches every tag with that prefix" example(funny,party,social)
+// @Param excludeTags query []string false "Leave out questions carrying any of these tags (comma-separated); a trailing * matches every tag with that prefix" example(nsfw,alcohol)
+// @Param matchAllTags query boolean false "Require all specified tags to match (true) or any tag (false)" default(false)
+// @Param count query integer false "Return an array of up to count distinct questions (max 50)"
+// @Param explain query boolean false "When nothing matches, include per-filter diagnostics in the response" default(false)
+// @Success 200 {object} Question "A random question"
+// @Success 200 {array} Question "Random questions when count is given"
+// @Failure 400 {object} ErrorResponse "Invalid request parameters"
+// @Failure 404 {object} ErrorResponse "No question matches the filters"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /questions/random [get]
+func getRandomQuestions(w http.ResponseWriter, r *http.Request) {
+	filters, err := ParseFilterSet(r.URL.Query())
+	if err != nil {
+		respondError(w, err, "Invalid filters")
+		return
+	}
+
+	count := 1
+	rawCount := r.URL.Query().Get("count")
+	if rawCount != "" {
+		count, err = strconv.Atoi(rawCount)
+		if err != nil || count < 1 || count > maxRandomCount {
+			writeError(w, apierror.InvalidParam, fmt.Sprintf("count must be an integer between 1 and %d", maxRandomCount))
+			return
+		}
+	}
+
+	var questions []Question
+	if rawCount == "" {
+		var question *Question
+		question, err = db.GetRandomQuestion(r.Context(), filters)
+		if err == nil {
+			respondNegotiated(w, r, http.StatusOK, question)
+			return
+		}
+	} else {
+		questions, err = db.GetRandomQuestions(r.Context(), filters, count)
+	}
+	if err != nil && !errors.Is(err, ErrQuestionNotFound) {
+		log.Printf("Failed to fetch random questions: %v", err)
+		respondError(w, err, "Failed to fetch random questions")
+		return
+	}
+
+	// Only empty results get here when no count was given.
+	if len(questions) == 0 && r.URL.Query().Get("explain") == "true" {
+		diagnostics, err := diagnoseEmptyResult(r.Context(), db, filters)
+		if err != nil {
+			log.Printf("Failed to diagnose empty result: %v", err)
+			respondError(w, err, "Failed to fetch random questions")
+			return
+		}
+		status := http.StatusOK
+		resp := ExplainedQuestionsResponse{Questions: []Question{}, Diagnostics: diagnostics}
+		if rawCount == "" {
+			status = apierror.Status(apierror.NotFound)
+			resp.Code = string(apierror.NotFound)
+		}
+		respondNegotiated(w, r, status, resp)
+		return
+	}
+
+	if rawCount == "" {
+		writeError(w, apierror.NotFound, "No question matches the filters")
+		return
+	}
+	respondNegotiated(w, r, http.StatusOK, questions)
+}
+
+// @Summary Retrieve a question by ID
+// @Description Get a single truth or dare question with its tags
+// @Tags questions
+// @Produce json
+// @Param id path integer true "Question ID" example(1)
+// @Success 200 {object} Question "The question"
+// @Failure 400 {object} ErrorResponse "ID is not a number"
+// @Failure 404 {object} ErrorResponse "Question not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /questions/{id} [get]
+func getQuestionByID(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/api/questions/"))
+	if err != nil || id <= 0 {
+		writeError(w, apierror.InvalidID, "Question ID must be a positive integer")
+		return
+	}
+
+	question, err := db.GetQuestionByID(r.Context(), id)
+	if errors.Is(err, ErrQuestionNotFound) {
+		writeError(w, apierror.NotFound, "Question not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to fetch question %d: %v", id, err)
+		respondError(w, err, "Failed to fetch question")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, question)
+}
+
+// @Summary Update a question
+// @Description Replace a question's language, type, task, dare target, attributes and tags. The tag set is replaced as a whole; an empty tags array removes all tags.
+// @Tags questions
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path integer true "Question ID" example(1)
+// @Param question body Question true "New question contents; id is ignored"
+// @Success 200 {object} Question "Updated question"
+// @Failure 400 {object} ErrorResponse "Invalid ID or question data"
+// @Failure 401 {object} ErrorResponse "Missing or invalid API key"
+// @Failure 404 {object} ErrorResponse "Question not found"
+// @Failure 413 {object} ErrorResponse "Request body too large"
+// @Failure 422 {object} ErrorResponse "Field not allowed for the question type or rejected by a content filter"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /questions/{id} [put]
+func updateQuestion(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/api/questions/"))
+	if err != nil || id <= 0 {
+		writeError(w, apierror.InvalidID, "Question ID must be a positive integer")
+		return
+	}
+
+	var q Question
+	if err := decodeJSONBody(w, r, &q); err != nil {
+		writeBodyError(w, err)
+		return
+	}
+
+	q.Language = normalizeLanguage(q.Language)
+	if err := validateQuestion(q); err != nil {
+		respondError(w, err, "Invalid question")
+		return
+	}
+
+	if err := db.UpdateQuestion(r.Context(), id, q); err != nil {
+		if !errors.Is(err, ErrQuestionNotFound) {
+			log.Printf("Failed to update question %d: %v", id, err)
+		}
+		respondError(w, err, "Failed to update question")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, writtenQuestion(q, id))
+}
+
+// @Summary Delete a question
+// @Description Remove a question together with its tag associations. With pruneTags=true, tags left without any question are deleted too, including their metadata.
+// @Tags questions
+// @Produce json
+// @Security BearerAuth
+// @Param id path integer true "Question ID" example(1)
+// @Param pruneTags query boolean false "Delete tags that no other question uses" default(false)
+// @Success 204 "Question deleted"
+// @Failure 400 {object} ErrorResponse "ID is not a number or invalid pruneTags"
+// @Failure 401 {object} ErrorResponse "Missing or invalid API key"
+// @Failure 404 {object} ErrorResponse "Question not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /questions/{id} [delete]
+func deleteQuestion(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/api/questions/"))
+	if err != nil || id <= 0 {
+		writeError(w, apierror.InvalidID, "Question ID must be a positive integer")
+		return
+	}
+
+	pruneTags := false
+	if raw := r.URL.Query().Get("pruneTags"); raw != "" {
+		pruneTags, err = strconv.ParseBool(raw)
+		if err != nil {
+			writeError(w, apierror.InvalidParam, "pruneTags must be true or false")
+			return
+		}
+	}
+
+	err = db.DeleteQuestion(r.Context(), id, pruneTags)
+	if errors.Is(err, ErrQuestionNotFound) {
+		writeError(w, apierror.NotFound, "Question not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to delete question %d: %v", id, err)
+		respondError(w, err, "Failed to delete question")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// @Summary Create a share link
+// @Description Encode the given filters into a URL that reproduces the same question pack. The URL is absolute when BASE_URL is configured and a relative path otherwise. With save=true the filters are also stored server side.
+// @Tags questions
+// @Produce json
+// @Param language query string false "ISO 639-1 language code filter" example(en)
+// @Param type query string false "Question type filter" Enums(truth, dare)
+// @Param tags query []string false "Filter questions by tags (comma-separated); a trailing * matches every tag with that prefix" example(funny,party,social)
+// @Param excludeTags query []string false "Leave out questions carrying any of these tags (comma-separated); a trailing * matches every tag with that prefix" example(nsfw,alcohol)
+// @Param matchAllTags query boolean false "Require all specified tags to match (true) or any tag (false)" default(false)
+// @Param save query boolean false "Persist the filters and return a token" default(false)
+// @Success 200 {object} ShareLinkResponse "Share link"
+// @Failure 400 {object} ErrorResponse "Invalid request parameters"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /questions/share-link [get]
+func getShareLink(w http.ResponseWriter, r *http.Request) {
+	filters, err := ParseFilterSet(r.URL.Query())
+	if err != nil {
+		respondError(w, err, "Invalid filters")
+		return
+	}
+
+	// The Host header is chosen by the client, so without BASE_URL the
+	// link stays relative rather than pointing at whatever host was sent.
+	baseURL := os.Getenv("BASE_URL")
+	if baseURL != "" && !strings.Contains(baseURL, "://") {
+		baseURL = "https://" + baseURL
+	}
+
+	pack := filters.Pack()
+	resp := ShareLinkResponse{URL: strings.TrimRight(baseURL, "/") + "/api/questions?pack=" + pack}
+
+	if r.URL.Query().Get("save") == "true" {
+		token := make([]byte, 8)
+		if _, err := rand.Read(token); err != nil {
+			log.Printf("Failed to generate share token: %v", err)
+			writeError(w, apierror.Internal, "Failed to create share link")
+			return
+		}
+		resp.Token = hex.EncodeToString(token)
+
+		filtersJSON, _ := json.Marshal(filters)
+		if err := db.SaveShareLink(r.Context(), resp.Token, string(filtersJSON)); err != nil {
+			log.Printf("Failed to save share link: %v", err)
+			respondError(w, err, "Failed to create share link")
+			return
+		}
+	}
+
+	respondJSON(w, http.StatusOK, resp)
+}
+
+// @Summary Questions added since a point in time
+// @Description Count questions created after since, for "new since your last visit" badges. since is an RFC3339 timestamp or a change feed sequence number and must not be older than one year.
+// @Tags questions
+// @Produce json
+// @Param since query string true "RFC3339 timestamp or change feed sequence number" example(2024-01-01T00:00:00Z)
+// @Param language query string false "ISO 639-1 language code filter" example(en)
+// @Param includeQuestions query boolean false "Also return the newest questions" default(false)
+// @Param limit query integer false "Maximum number of questions to return (max 100)" default(20)
+// @Success 200 {object} NewQuestionsResponse "New question count"
+// @Failure 400 {object} ErrorResponse "Malformed or too old since value"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /questions/new [get]
+func getNewQuestions(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	raw := query.Get("since")
+
+	var since time.Time
+	if seq, err := strconv.ParseInt(raw, 10, 64); err == nil {
+		since, err = db.ChangeTime(r.Context(), seq)
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, apierror.InvalidParam, "since refers to an unknown collection version; fetch the full list with GET /api/questions instead")
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to resolve collection version: %v", err)
+			respondError(w, err, "Failed to count new questions")
+			return
+		}
+	} else if since, err = time.Parse(time.RFC3339, raw); err != nil {
+		writeError(w, apierror.InvalidParam, "since must be an RFC3339 timestamp (e.g. 2024-01-01T00:00:00Z) or a change feed sequence number")
+		return
+	}
+
+	if time.Since(since) > newQuestionsMaxAge {
+		writeError(w, apierror.InvalidParam, "since is more than one year ago; fetch the full list with GET /api/questions instead")
+		return
+	}
+
+	limit := defaultNewQuestionsLimit
+	if raw := query.Get("limit"); raw != "" {
+		var err error
+		limit, err = strconv.Atoi(raw)
+		if err != nil || limit < 1 || limit > maxNewQuestionsLimit {
+			writeError(w, apierror.InvalidParam, "limit must be an integer between 1 and 100")
+			return
+		}
+	}
+
+	language := normalizeLanguage(query.Get("language"))
+	count, err := db.CountQuestionsSince(r.Context(), since, language)
+	if err != nil {
+		log.Printf("Failed to count new questions: %v", err)
+		respondError(w, err, "Failed to count new questions")
+		return
+	}
+
+	resp := NewQuestionsResponse{Since: since.UTC(), Count: count}
+	if query.Get("includeQuestions") == "true" && count > 0 {
+		resp.Questions, err = db.GetQuestionsSince(r.Context(), since, language, limit)
+		if err != nil {
+			log.Printf("Failed to fetch new questions: %v", err)
+			respondError(w, err, "Failed to fetch new questions")
+			return
+		}
+	}
+
+	respondJSON(w, http.StatusOK, resp)
+}
+
+// @Summary Tags shared by selected questions
+// @Description Return the tags present on all of the given questions (intersection) and on any of them (union)
+// @Tags questions
+// @Accept json
+// @Produce json
+// @Param selection body CommonTagsRequest true "Question IDs"
+// @Success 200 {object} CommonTagsResponse "Shared tags"
+// @Failure 400 {object} ErrorResponse "Invalid request body"
+// @Failure 413 {object} ErrorResponse "Request body too large"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /questions/common-tags [post]
+func getCommonTags(w http.ResponseWriter, r *http.Request) {
+	var req CommonTagsRequest
+	if err := decodeJSONBody(w, r, &req); err != nil {
+		writeBodyError(w, err)
+		return
+	}
+
+	seen := map[int]bool{}
+	ids := make([]int, 0, len(req.IDs))
+	for _, id := range req.IDs {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) > maxCommonTagsIDs {
+		writeError(w, apierror.InvalidParam, "Too many ids: at most 500 may be given")
+		return
+	}
+
+	intersection, union, err := db.GetCommonTags(r.Context(), ids)
+	if err != nil {
+		log.Printf("Failed to fetch common tags: %v", err)
+		respondError(w, err, "Failed to fetch common tags")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, CommonTagsResponse{Intersection: intersection, Union: union})
+}
+
+// @Summary Export questions
+// @Description Export questions matching the filters. format=sql produces MySQL INSERT statements that recreate the questions and their tags in another database. format=csv produces the columns id, language, type, task and tags (semicolon-joined). format=json produces newline-delimited JSON, one question per line. Without format, Accept: text/csv or application/x-ndjson selects the format. CSV and JSON exports are streamed as rows are read.
+// @Tags questions
+// @Produce application/sql,text/csv,application/x-ndjson
+// @Param format query string false "Export format; required unless the Accept header selects csv or json" Enums(sql, csv, json)
+// @Param language query string false "ISO 639-1 language code filter" example(en)
+// @Param type query string false "Question type filter" Enums(truth, dare)
+// @Param tags query []string false "Filter questions by tags (comma-separated); a trailing * matches every tag with that prefix" example(funny,party,social)
+// @Param excludeTags query []string false "Leave out questions carrying any of these tags (comma-separated); a trailing * matches every tag with that prefix" example(nsfw,alcohol)
+// @Param matchAllTags query boolean false "Require all specified tags to match (true) or any tag (false)" default(false)
+// @Success 200 {string} string "Export file"
+// @Failure 400 {object} ErrorResponse "Invalid request parameters"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /questions/export [get]
+func exportQuestions(w http.ResponseWriter, r *http.Request) {
+	filters, err := ParseFilterSet(r.URL.Query())
+	if err != nil {
+		respondError(w, err, "Invalid filters")
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		accept := r.Header.Get("Accept")
+		switch {
+		case strings.Contains(accept, "text/csv"):
+			format = "csv"
+		case strings.Contains(accept, "application/x-ndjson"):
+			format = "json"
+		}
+	}
+
+	switch format {
+	case "sql":
+		questions, err := db.GetQuestions(r.Context(), filters, QueryOptions{})
+		if err != nil {
+			log.Printf("Failed to fetch questions for export: %v", err)
+			respondError(w, err, "Failed to fetch questions")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/sql; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="questions.sql"`)
+		if err := writeSQLExport(w, questions); err != nil {
+			log.Printf("Failed to write SQL export: %v", err)
+		}
+	case "csv", "json":
+		rows, err := db.StreamQuestions(r.Context(), filters)
+		if err != nil {
+			log.Printf("Failed to fetch questions for export: %v", err)
+			respondError(w, err, "Failed to fetch questions")
+			return
+		}
+		defer rows.Close()
+
+		// The status is sent with the first row, so errors from here on
+		// can only be logged; the client sees a truncated file.
+		if format == "csv" {
+			w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+			w.Header().Set("Content-Disposition", `attachment; filename="questions.csv"`)
+			err = writeCSVExport(w, rows)
+		} else {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			w.Header().Set("Content-Disposition", `attachment; filename="questions.jsonl"`)
+			err = writeJSONLinesExport(w, rows)
+		}
+		if err != nil {
+			log.Printf("Failed to write %s export: %v", format, err)
+		}
+	default:
+		writeError(w, apierror.InvalidParam, "Unsupported export format, expected format=sql, csv or json")
+	}
+}
+
+// @Summary Export questions to S3
+// @Description Stream questions matching the filters as gzip-compressed JSON lines into an S3 object
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param language query string false "ISO 639-1 language code filter" example(en)
+// @Param type query string false "Question type filter" Enums(truth, dare)
+// @Param tags query []string false "Filter questions by tags (comma-separated); a trailing * matches every tag with that prefix" example(funny,party,social)
+// @Param excludeTags query []string false "Leave out questions carrying any of these tags (comma-separated); a trailing * matches every tag with that prefix" example(nsfw,alcohol)
+// @Param matchAllTags query boolean false "Require all specified tags to match (true) or any tag (false)" default(false)
+// @Param destination body S3ExportRequest true "Destination bucket and key"
+// @Success 200 {object} S3ExportResponse "Export uploaded"
+// @Failure 400 {object} ErrorResponse "Invalid filters, malformed body, or missing bucket or key; see fields"
+// @Failure 401 {object} ErrorResponse "Missing or invalid API key"
+// @Failure 413 {object} ErrorResponse "Request body too large"
+// @Failure 502 {object} ErrorResponse "Upload failed"
+// @Router /admin/export-s3 [post]
+func exportQuestionsToS3(w http.ResponseWriter, r *http.Request) {
+	filters, err := ParseFilterSet(r.URL.Query())
+	if err != nil {
+		respondError(w, err, "Invalid filters")
+		return
+	}
+
+	var req S3ExportRequest
+	if err := decodeJSONBody(w, r, &req); err != nil {
+		writeBodyError(w, err)
+		return
+	}
+	var fields []apierror.FieldError
+	if req.Bucket == "" {
+		fields = append(fields, apierror.FieldError{Field: "bucket", Message: "bucket is required"})
+	}
+	if req.Key == "" {
+		fields = append(fields, apierror.FieldError{Field: "key", Message: "key is required"})
+	}
+	if len(fields) > 0 {
+		respondError(w, apierror.Validation(fields...), "Invalid destination")
+		return
+	}
+
+	if err := db.ExportToS3(r.Context(), req.Bucket, req.Key, filters); err != nil {
+		log.Printf("Failed to export questions to S3: %v", err)
+		writeError(w, apierror.UpstreamFailed, "Failed to export questions to S3")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, S3ExportResponse{Bucket: req.Bucket, Key: req.Key})
 }
 
 // @Summary Get available tags
@@ -120,63 +1342,370 @@ func getQuestions(w http.ResponseWriter, r *http.Request) {
 // @Tags tags
 // @Accept json
 // @Produce json
+// @Param sort query string false "Sort by tag name or by number of questions using the tag" Enums(name, count) default(name)
+// @Param order query string false "Sort direction" Enums(asc, desc) default(asc)
 // @Success 200 {array} string "List of available tags"
+// @Failure 400 {object} ErrorResponse "Invalid sort or order"
 // @Failure 500 {object} ErrorResponse "Internal server error"
-// @Example 200 {array} string ["funny", "social", "party", "deep", "romantic"]
+// @Example 200 {array} string ["deep", "funny", "party", "romantic", "social"]
 // @Router /tags [get]
 func getTags(w http.ResponseWriter, r *http.Request) {
-	tags, err := db.GetTags()
+	sortField := r.URL.Query().Get("sort")
+	if sortField == "" {
+		sortField = "name"
+	}
+	if _, ok := tagSortColumns[sortField]; !ok {
+		writeError(w, apierror.InvalidParam, "sort must be \"name\" or \"count\"")
+		return
+	}
+
+	order := r.URL.Query().Get("order")
+	if order == "" {
+		order = "asc"
+	}
+	if order != "asc" && order != "desc" {
+		writeError(w, apierror.InvalidParam, "order must be \"asc\" or \"desc\"")
+		return
+	}
+
+	tags, err := db.GetTags(r.Context(), sortField, order)
 	if err != nil {
 		log.Printf("Failed to fetch tags: %v", err)
-		http.Error(w, "Failed to fetch tags", http.StatusInternalServerError)
+		respondError(w, err, "Failed to fetch tags")
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json; charset=utf-8")
-	if err := json.NewEncoder(w).Encode(tags); err != nil {
-		log.Printf("Failed to encode tags to JSON: %v", err)
-		http.Error(w, "Failed to encode tags to JSON", http.StatusInternalServerError)
+	respondJSON(w, http.StatusOK, tags)
+}
+
+// @Summary Poll question changes
+// @Description Return question changes recorded after since_seq so clients can sync a local cache incrementally
+// @Tags changes
+// @Accept json
+// @Produce json
+// @Param since_seq query integer false "Return changes with a sequence number greater than this" default(0)
+// @Param limit query integer false "Maximum number of changes to return (max 1000)" default(100)
+// @Success 200 {object} ChangesResponse "Changes and the next cursor"
+// @Failure 400 {object} ErrorResponse "Invalid request parameters"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /changes [get]
+func getChanges(w http.ResponseWriter, r *http.Request) {
+	var sinceSeq int64
+	if raw := r.URL.Query().Get("since_seq"); raw != "" {
+		var err error
+		sinceSeq, err = strconv.ParseInt(raw, 10, 64)
+		if err != nil || sinceSeq < 0 {
+			writeError(w, apierror.InvalidParam, "since_seq must be a non-negative integer")
+			return
+		}
+	}
+
+	limit := defaultChangesLimit
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		var err error
+		limit, err = strconv.Atoi(raw)
+		if err != nil || limit < 1 || limit > maxChangesLimit {
+			writeError(w, apierror.InvalidParam, "limit must be an integer between 1 and 1000")
+			return
+		}
+	}
+
+	changes, err := db.GetChanges(r.Context(), sinceSeq, limit)
+	if err != nil {
+		log.Printf("Failed to fetch changes: %v", err)
+		respondError(w, err, "Failed to fetch changes")
+		return
 	}
+
+	nextSeq := sinceSeq
+	if len(changes) > 0 {
+		nextSeq = changes[len(changes)-1].Seq
+	}
+
+	respondJSON(w, http.StatusOK, ChangesResponse{Changes: changes, NextSeq: nextSeq})
 }
 
-// main initializes and starts the HTTP server.
-// The server provides the following endpoints:
+// @Summary Explain a question query
+// @Description Return the SQL and parameters GET /questions would run for the given filters, without executing it. Only available when DEBUG_ENDPOINTS=true.
+// @Tags debug
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param language query string false "ISO 639-1 language code filter" example(en)
+// @Param type query string false "Question type filter" Enums(truth, dare)
+// @Param tags query []string false "Filter questions by tags (comma-separated); a trailing * matches every tag with that prefix" example(funny,party,social)
+// @Param excludeTags query []string false "Leave out questions carrying any of these tags (comma-separated); a trailing * matches every tag with that prefix" example(nsfw,alcohol)
+// @Param matchAllTags query boolean false "Require all specified tags to match (true) or any tag (false)" default(false)
+// @Success 200 {object} ExplainResponse "Generated SQL and parameters"
+// @Failure 400 {object} ErrorResponse "Invalid request parameters"
+// @Failure 401 {object} ErrorResponse "Missing or invalid API key"
+// @Failure 404 {object} ErrorResponse "Debug endpoints are disabled"
+// @Router /debug/explain [get]
+func explainQuestions(w http.ResponseWriter, r *http.Request) {
+	filters, err := ParseFilterSet(r.URL.Query())
+	if err != nil {
+		respondError(w, err, "Invalid filters")
+		return
+	}
+
+	query, args := buildQuestionsQuery(filters, QueryOptions{})
+	respondJSON(w, http.StatusOK, ExplainResponse{SQL: query, Args: args})
+}
+
+// @Summary Build a deck from a preset
+// @Description Return a shuffled deck of random questions built to the named preset's specification
+// @Tags presets
+// @Accept json
+// @Produce json
+// @Param name path string true "Preset name" example(mild-family)
+// @Success 200 {object} DeckResponse "Deck built from the preset"
+// @Failure 404 {object} ErrorResponse "Unknown preset"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /presets/{name} [get]
+func getPresetDeck(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/api/presets/")
+	preset, ok := presets[name]
+	if !ok {
+		writeError(w, apierror.NotFound, "Preset not found")
+		return
+	}
+
+	deck, err := buildDeck(r.Context(), db, preset)
+	if err != nil {
+		log.Printf("Failed to build deck for preset %q: %v", name, err)
+		respondError(w, err, "Failed to build deck")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, DeckResponse{Preset: name, Questions: deck})
+}
+
+// @Summary Service health
+// @Description Report service status, start time, uptime and the number of questions per type
+// @Tags health
+// @Produce json
+// @Success 200 {object} HealthResponse "Service is running"
+// @Router /health [get]
+func getHealth(w http.ResponseWriter, r *http.Request) {
+	resp := HealthResponse{
+		Status:        "ok",
+		StartedAt:     startTime.UTC(),
+		UptimeSeconds: int64(time.Since(startTime).Seconds()),
+	}
+
+	// The process is healthy even if the database is briefly unavailable
+	// or still connecting, so that only drops type_counts from the response.
+	if dbReady.Load() {
+		counts, err := db.CheckTypeBalance(r.Context())
+		if err != nil {
+			log.Printf("Failed to count question types: %v", err)
+		} else {
+			resp.TypeCounts = counts
+		}
+	}
+
+	respondJSON(w, http.StatusOK, resp)
+}
+
+// shutdownTimeout bounds how long a SIGTERM or interrupt waits for in-flight
+// requests before the server exits.
+const shutdownTimeout = 10 * time.Second
+
+// main initializes and starts the HTTP server. When started with -selftest
+// it instead runs the deployment checks in selftest.go and exits.
+// The routes are registered in routes.go. The server provides the
+// following endpoints:
 //   - GET /api/questions: Retrieve questions with optional filters
+//   - POST /api/questions: Create a question (API key)
+//   - POST /api/questions/bulk: Create many questions in one transaction (API key)
+//   - POST /api/questions/import-url: Import questions from a remote JSON, JSON-lines or CSV document (API key)
+//   - GET /api/questions/random: Retrieve one or more random questions
+//   - GET /api/questions/{id}: Retrieve a single question
+//   - PUT /api/questions/{id}: Update a question and its tags (API key)
+//   - DELETE /api/questions/{id}: Delete a question (API key)
+//   - GET /api/questions/share-link: Encode filters into a shareable URL
+//   - GET /api/questions/new: Count questions added since a point in time
+//   - POST /api/questions/common-tags: Tags shared by a selection of questions
+//   - GET /api/questions/export: Export questions (format=sql, csv or json)
+//   - GET /api/export/cards: Printable PDF or HTML sheet of question cards
 //   - GET /api/tags: Retrieve all available tags
+//   - POST /api/games: Store filters under a short game code
+//   - GET /api/games/{code}: Look up a game code, optionally with a seeded deck
+//   - GET /api/capabilities: Describe enabled features and limits
+//   - GET /api/errors: List the machine-readable error codes
+//   - GET /api/health: Report status, start time and uptime
+//   - GET /api/health/live: Liveness probe, never touches the database
+//   - GET /api/health/ready: Readiness probe, 503 until the database is connected
+//   - GET /api/stats/lengths: Histogram of task lengths
+//   - GET /api/presets/{name}: Build a deck from a configured preset
+//   - GET /api/tags/export: Export tag metadata
+//   - POST /api/tags/import: Import tag metadata (API key)
+//   - POST /api/tags/auto-assign: Tag every question containing a keyword (API key)
+//   - GET /api/i18n/{locale}: Display names of question types and tags in a locale
+//   - GET, PUT, DELETE /api/admin/tag-translations: Manage tag display names per locale (API key)
+//   - POST /api/admin/export-s3: Export questions to S3 (API key)
+//   - POST /api/admin/retag: Add tags to questions matching content rules (API key)
+//   - POST /api/admin/search-index/rebuild: Rebuild the question search index (API key)
+//   - GET /api/changes: Poll the question change feed
+//   - GET /api/admin/snapshots: List catalog snapshots (EXPORT_DIR or EXPORT_S3_BUCKET, API key)
+//   - POST /api/admin/snapshots: Take a catalog snapshot now (EXPORT_DIR or EXPORT_S3_BUCKET, API key)
+//   - GET /api/admin/sync: Show the state of pull replication (SYNC_UPSTREAM_URL, API key)
+//   - GET /api/debug/explain: Show generated SQL (DEBUG_ENDPOINTS=true, API key)
+//   - GET /api/config/cors: Show the CORS configuration (DEBUG_ENDPOINTS=true, API key)
+//   - GET /api/config/rate-limits: Show the request rate limits (API key)
+//   - GET /api/config/features: Show the feature flags (API key)
 //
 // Required environment variables:
 //   - APP_PORT: Port number for the HTTP server
+//
+// Optional environment variables:
+//   - CONTENT_FILTERS: Ordered write-path filters, e.g. "banned_words:closed,duplicate" (see loadContentFilters)
+//   - BANNED_WORDS: Comma-separated words rejected by the banned_words filter
+//   - BLOCKED_TAGS: Comma-separated tag names that no write may create or attach (case-insensitive)
+//   - SANITIZE_INPUT: Set to "true" to strip HTML from question text on insert (alters stored content)
+//   - HIGHLIGHT_OPEN_TAG, HIGHLIGHT_CLOSE_TAG: Markup around search matches (default <mark></mark>)
+//   - CORS_ALLOWED_ORIGINS: Comma-separated origins allowed in cross-origin requests, or "*" (default: CORS disabled)
+//   - BASE_URL: Public base URL used in share links (default: share links are relative paths)
+//   - IMPORT_URL_ALLOW_PRIVATE: Set to "true" to let import-url fetch from private, loopback and link-local addresses
+//   - S3_ENDPOINT: S3-compatible endpoint for exports (AWS credentials from the standard AWS variables)
+//   - EXPORT_DIR, EXPORT_S3_BUCKET, EXPORT_S3_PREFIX, EXPORT_SCHEDULE, EXPORT_RETENTION: Catalog snapshots (see loadSnapshotter)
+//   - SYNC_UPSTREAM_URL, SYNC_API_KEY, SYNC_INTERVAL: Pull question changes from another instance (see loadSyncer)
+//   - MIN_QUESTIONS_PER_TYPE: Warn at startup when a question type has fewer questions (default 10)
+//   - GAME_CODE_TTL: Lifetime of game codes as a Go duration (default 24h)
+//   - PRESETS_FILE: JSON file with game presets (see loadPresets)
+//   - ATTRIBUTE_SCHEMA_FILE: JSON file with the allowed question attributes (see loadAttributeSchema)
+//   - API_KEY: Bearer token required by admin endpoints and question writes
+//   - API_KEYS: Additional comma-separated name:key pairs accepted like API_KEY; the name is logged
+//   - DEBUG_ENDPOINTS: Set to "true" to enable /api/debug endpoints
+//   - RECORD_FIXTURES_DIR: Record responses as client fixtures (development only)
+//   - RECORD_ENDPOINTS: Comma-separated paths to record (default /api/questions,/api/tags)
+//   - QUERY_LOG_LEVEL: Set to "debug" to log every SQL query with argument types but not values
+//   - LAZY_DB_INIT: Set to "true" to start serving before the database is connected; endpoints needing it answer 503 until then
+//   - RATE_LIMIT_RPS, RATE_LIMIT_BURST: Requests per second and burst allowed per client IP on public endpoints (default: unlimited; burst defaults to twice the rate)
+//   - TRUSTED_PROXIES: Comma-separated proxy IPs or CIDR ranges whose X-Real-IP and X-Forwarded-For headers identify the client (default: none; the connection address is used)
+//   - LOG_LEVEL: Access log level: debug, info, warn or error (default info; public reads log at debug)
 //   - All database-related environment variables (see NewDatabase docs)
 func main() {
-	initializeDatabase()
-	defer db.Close()
+	startTime = time.Now()
 
-	// Swagger documentation endpoint
-	http.HandleFunc("/swagger/", httpSwagger.WrapHandler)
+	selfTest := flag.Bool("selftest", false, "run deployment checks and exit with a non-zero status on failure")
+	var selfTestOpts SelfTestOptions
+	flag.BoolVar(&selfTestOpts.SkipConnectivity, "skip-connectivity", false, "skip the database connectivity check")
+	flag.BoolVar(&selfTestOpts.SkipSchema, "skip-schema", false, "skip the database schema check")
+	flag.BoolVar(&selfTestOpts.SkipRead, "skip-read", false, "skip the read query check")
+	flag.BoolVar(&selfTestOpts.SkipWrite, "skip-write", false, "skip the rolled back write check")
+	flag.Parse()
 
-	http.HandleFunc("/api/questions", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == http.MethodGet {
-			getQuestions(w, r)
-		} else {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		}
-	})
+	if err := godotenv.Load(); err != nil {
+		log.Fatalf("Error loading .env file: %v", err)
+	}
 
-	http.HandleFunc("/api/tags", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == http.MethodGet {
-			getTags(w, r)
-		} else {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	// The self-test opens the database without connecting, so its
+	// connectivity check is the first to reach the server.
+	if *selfTest {
+		conn, err := openDatabase()
+		if err != nil {
+			log.Fatal(err)
+		}
+		ok := runSelfTest(os.Stdout, conn, selfTestOpts)
+		conn.Close()
+		if !ok {
+			os.Exit(1)
 		}
-	})
+		return
+	}
 
-	// redirect /api to /swagger
-	http.HandleFunc("/api", func(w http.ResponseWriter, r *http.Request) {
-		http.Redirect(w, r, "/swagger/index.html", http.StatusSeeOther)
-	})
+	lazy := lazyDBInit()
+	if !lazy {
+		connectDatabase()
+		dbReady.Store(true)
+	}
+
+	var err error
+	presets, err = loadPresets()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	attributeSchema, err = loadAttributeSchema()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Background jobs run until shutdown begins.
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+
+	// In lazy mode db is still nil here; the background jobs get it once
+	// the background connect finishes and only start then.
+	snapshots, err = loadSnapshotter(db)
+	if err != nil {
+		log.Fatal(err)
+	}
+	upstreamSync, err = loadSyncer(db)
+	if err != nil {
+		log.Fatal(err)
+	}
+	rateLimiter, err = loadRateLimiter()
+	if err != nil {
+		log.Fatal(err)
+	}
+	trustedProxies, err = loadTrustedProxies()
+	if err != nil {
+		log.Fatal(err)
+	}
+	maxImportRows, err = loadMaxImportRows()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if rateLimiter != nil {
+		go rateLimiter.Run(jobsCtx)
+	}
+	startJobs := func() {
+		if snapshots != nil {
+			snapshots.db = db
+			go snapshots.Run(jobsCtx)
+		}
+		if upstreamSync != nil {
+			upstreamSync.db = db
+			go upstreamSync.Run(jobsCtx)
+		}
+	}
+	if lazy {
+		log.Println("LAZY_DB_INIT=true: serving before the database is connected.")
+		connectDatabaseInBackground(startJobs)
+	} else {
+		startJobs()
+	}
 
 	port := os.Getenv("APP_PORT")
 	log.Printf("API server running on port %s", port)
 	log.Printf("Swagger documentation available at http://localhost:%s/swagger/index.html", port)
-	log.Fatal(http.ListenAndServe(":"+port, nil))
+	handler := withCORS(buildMux(apiRoutes()))
+	if recordingEnabled() {
+		handler = recordFixtures(handler)
+	}
+
+	server := &http.Server{Addr: ":" + port, Handler: handler}
+	go func() {
+		if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+	}()
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	<-stop
+
+	// Shutdown stops accepting connections and waits for in-flight
+	// requests, so the database is only closed once nothing uses it.
+	log.Println("Shutting down gracefully")
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("Shutdown timed out after %s with requests still running: %v", shutdownTimeout, err)
+	}
+	stopJobs()
+	if dbReady.Load() {
+		db.Close()
+	}
 }
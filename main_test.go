@@ -0,0 +1,511 @@
+package main
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/2Friendly4You/TruthOrDare/apierror"
+	"github.com/go-sql-driver/mysql"
+)
+
+func TestGetShareLinkIgnoresHostHeader(t *testing.T) {
+	tests := []struct {
+		baseURL string
+		want    string
+	}{
+		{"", "/api/questions?pack="},
+		{"example.com", "https://example.com/api/questions?pack="},
+		{"http://localhost:8080/", "http://localhost:8080/api/questions?pack="},
+	}
+	for _, tt := range tests {
+		t.Run(tt.baseURL, func(t *testing.T) {
+			t.Setenv("BASE_URL", tt.baseURL)
+			r := httptest.NewRequest("GET", "/api/questions/share-link?language=en&tags=funny", nil)
+			r.Host = "attacker.example"
+			w := httptest.NewRecorder()
+
+			getShareLink(w, r)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, body %s", w.Code, w.Body)
+			}
+			var resp ShareLinkResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(resp.URL, tt.want) {
+				t.Errorf("URL = %q, want prefix %q", resp.URL, tt.want)
+			}
+			if strings.Contains(resp.URL, "attacker.example") {
+				t.Errorf("URL %q uses the request Host header", resp.URL)
+			}
+		})
+	}
+}
+
+func TestGetCommonTagsRejectsBadBodies(t *testing.T) {
+	ids := make([]string, maxCommonTagsIDs+1)
+	for i := range ids {
+		ids[i] = strconv.Itoa(i + 1)
+	}
+	tooMany := `{"ids": [` + strings.Join(ids, ",") + `]}`
+
+	tests := []struct {
+		name     string
+		body     string
+		wantCode apierror.Code
+	}{
+		{"malformed", `{"ids": [1, 2`, apierror.InvalidBody},
+		{"wrong type", `{"ids": "1,2"}`, apierror.InvalidBody},
+		{"too large", `{"ids": [` + strings.Repeat("1,", maxRequestBodySize) + `1]}`, apierror.PayloadTooLarge},
+		{"too many ids", tooMany, apierror.InvalidParam},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/api/questions/common-tags", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+
+			getCommonTags(w, r)
+
+			var resp ErrorResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Code != string(tt.wantCode) || w.Code != apierror.Status(tt.wantCode) {
+				t.Errorf("got %d %s, want %d %s", w.Code, resp.Code, apierror.Status(tt.wantCode), tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestExportQuestionsToS3RejectsBadBodies(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantCode   apierror.Code
+		wantFields []string
+	}{
+		{"malformed", `{"bucket": "b",`, apierror.InvalidBody, nil},
+		{"too large", `{"bucket": "` + strings.Repeat("b", maxRequestBodySize) + `"}`, apierror.PayloadTooLarge, nil},
+		{"missing key", `{"bucket": "b"}`, apierror.ValidationFailed, []string{"key"}},
+		{"missing both", `{}`, apierror.ValidationFailed, []string{"bucket", "key"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/api/admin/export-s3", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+
+			exportQuestionsToS3(w, r)
+
+			var resp ErrorResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Code != string(tt.wantCode) || w.Code != apierror.Status(tt.wantCode) {
+				t.Errorf("got %d %s, want %d %s", w.Code, resp.Code, apierror.Status(tt.wantCode), tt.wantCode)
+			}
+			if len(resp.Fields) != len(tt.wantFields) {
+				t.Fatalf("fields = %v, want %v", resp.Fields, tt.wantFields)
+			}
+			for i, field := range resp.Fields {
+				if field.Field != tt.wantFields[i] {
+					t.Errorf("field %d = %q, want %q", i, field.Field, tt.wantFields[i])
+				}
+			}
+		})
+	}
+}
+
+// emptyCatalog answers every query of a MockDB as if no question existed:
+// counts are 0 and lookups find nothing.
+func emptyCatalog(query string, args []driver.Value) (*MockRows, error) {
+	if strings.HasPrefix(query, "SELECT COUNT(*)") {
+		return &MockRows{Columns: []string{"count"}, Values: [][]driver.Value{{int64(0)}}}, nil
+	}
+	return &MockRows{}, nil
+}
+
+func TestGetQuestionsReturnsEmptyArray(t *testing.T) {
+	mock := useMockDB(t)
+	mock.Query = emptyCatalog
+
+	r := httptest.NewRequest("GET", "/api/questions?language=xx", nil)
+	w := httptest.NewRecorder()
+	getQuestions(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", w.Code, w.Body)
+	}
+	if body := strings.TrimSpace(w.Body.String()); body != "[]" {
+		t.Errorf("body = %s, want []", body)
+	}
+}
+
+func TestWrittenQuestionsEchoEmptyTags(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		method  string
+		path    string
+		body    string
+		status  int
+	}{
+		{"create without tags", createQuestion, "POST", "/api/questions", `{"language": "en", "type": "truth", "task": "What scares you?"}`, http.StatusCreated},
+		{"create with null tags", createQuestion, "POST", "/api/questions", `{"language": "en", "type": "truth", "task": "What scares you?", "tags": null}`, http.StatusCreated},
+		{"update without tags", updateQuestion, "PUT", "/api/questions/7", `{"language": "en", "type": "dare", "task": "Sing a song"}`, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := useMockDB(t)
+			mock.Query = func(query string, args []driver.Value) (*MockRows, error) {
+				if strings.Contains(query, "FOR UPDATE") {
+					return &MockRows{Columns: []string{"id"}, Values: [][]driver.Value{{int64(7)}}}, nil
+				}
+				return emptyCatalog(query, args)
+			}
+
+			r := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			tt.handler(w, r)
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, body %s", w.Code, w.Body)
+			}
+			var echoed map[string]json.RawMessage
+			if err := json.Unmarshal(w.Body.Bytes(), &echoed); err != nil {
+				t.Fatal(err)
+			}
+			if tags := string(echoed["tags"]); tags != "[]" {
+				t.Errorf("tags = %s, want []", tags)
+			}
+		})
+	}
+}
+
+func TestGetQuestionsRejectsInvalidParams(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     string
+		wantCode  apierror.Code
+		wantParam string
+	}{
+		{"language name", "language=english", apierror.InvalidLanguage, "language"},
+		{"numeric language", "language=12", apierror.InvalidLanguage, "language"},
+		{"capitalized type", "type=Truth", apierror.InvalidType, "type"},
+		{"unknown type", "type=challenge", apierror.InvalidType, "type"},
+		{"matchAllTags yes", "matchAllTags=yes", apierror.InvalidParam, "matchAllTags"},
+		{"empty tag", "tags=funny,,party", apierror.InvalidTag, "tags"},
+		{"blank tag", "tags=%20,party", apierror.InvalidTag, "tags"},
+		{"empty excluded tag", "excludeTags=nsfw,", apierror.InvalidTag, "excludeTags"},
+		{"bad limit", "limit=0", apierror.InvalidParam, "limit"},
+		{"unknown field", "fields=answer", apierror.InvalidParam, "fields"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := useMockDB(t)
+			mock.Query = emptyCatalog
+
+			r := httptest.NewRequest("GET", "/api/questions?"+tt.query, nil)
+			w := httptest.NewRecorder()
+			getQuestions(w, r)
+
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want 400, body %s", w.Code, w.Body)
+			}
+			var resp ErrorResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Code != string(tt.wantCode) {
+				t.Errorf("code = %s, want %s", resp.Code, tt.wantCode)
+			}
+			if !strings.Contains(resp.Message, tt.wantParam) {
+				t.Errorf("message %q does not name %s", resp.Message, tt.wantParam)
+			}
+			if statements := mock.Statements(); len(statements) != 0 {
+				t.Errorf("invalid request reached the database: %v", statements)
+			}
+		})
+	}
+}
+
+func TestGetQuestionsToleratesUnknownParams(t *testing.T) {
+	mock := useMockDB(t)
+	mock.Query = emptyCatalog
+
+	r := httptest.NewRequest("GET", "/api/questions?language=en&utm_source=newsletter&foo=bar", nil)
+	w := httptest.NewRecorder()
+	getQuestions(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", w.Code, w.Body)
+	}
+}
+
+func TestListEndpointsFailOnReadErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		path    string
+		rows    *MockRows
+	}{
+		{"questions", getQuestions, "/api/questions", questionRows("funny", "party")},
+		{"tags", getTags, "/api/tags", &MockRows{Columns: []string{"name"}, Values: [][]driver.Value{{"funny"}, {"party"}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := useMockDB(t)
+			mock.Query = func(query string, args []driver.Value) (*MockRows, error) {
+				if strings.HasPrefix(query, "SELECT COUNT(*)") {
+					return emptyCatalog(query, args)
+				}
+				rows := *tt.rows
+				rows.Err = errors.New("invalid connection")
+				return &rows, nil
+			}
+
+			r := httptest.NewRequest("GET", tt.path, nil)
+			w := httptest.NewRecorder()
+			tt.handler(w, r)
+
+			if w.Code != http.StatusInternalServerError {
+				t.Fatalf("status = %d, want 500, body %s", w.Code, w.Body)
+			}
+			var resp ErrorResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("body is not an error response: %s", w.Body)
+			}
+			if resp.Code != string(apierror.Internal) {
+				t.Errorf("code = %s, want %s", resp.Code, apierror.Internal)
+			}
+		})
+	}
+}
+
+func TestHandlersMapDriverErrors(t *testing.T) {
+	const question = `{"language": "en", "type": "truth", "task": "What scares you?"}`
+	tests := []struct {
+		name     string
+		handler  http.HandlerFunc
+		method   string
+		body     string
+		number   uint16
+		wantCode apierror.Code
+	}{
+		{"duplicate insert", createQuestion, "POST", question, mysqlErrDuplicateEntry, apierror.Conflict},
+		{"deadlocked insert", createQuestion, "POST", question, mysqlErrDeadlock, apierror.DBUnavailable},
+		{"insert lock wait timeout", createQuestion, "POST", question, mysqlErrLockWaitTimeout, apierror.DBUnavailable},
+		{"read lock wait timeout", getQuestions, "GET", "", mysqlErrLockWaitTimeout, apierror.DBUnavailable},
+		{"read deadlock", getQuestions, "GET", "", mysqlErrDeadlock, apierror.DBUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			driverErr := &mysql.MySQLError{Number: tt.number, Message: "from the server"}
+			mock := useMockDB(t)
+			mock.Query = func(query string, args []driver.Value) (*MockRows, error) {
+				if strings.HasPrefix(query, "SELECT COUNT(*)") {
+					return emptyCatalog(query, args)
+				}
+				return nil, driverErr
+			}
+			mock.Exec = func(query string, args []driver.Value) (driver.Result, error) {
+				return nil, driverErr
+			}
+
+			r := httptest.NewRequest(tt.method, "/api/questions", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			tt.handler(w, r)
+
+			if w.Code != apierror.Status(tt.wantCode) {
+				t.Fatalf("status = %d, want %d, body %s", w.Code, apierror.Status(tt.wantCode), w.Body)
+			}
+			var resp ErrorResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Code != string(tt.wantCode) {
+				t.Errorf("code = %s, want %s", resp.Code, tt.wantCode)
+			}
+			if strings.Contains(resp.Message, driverErr.Message) {
+				t.Errorf("message %q leaks the driver error", resp.Message)
+			}
+		})
+	}
+}
+
+func TestGetQuestionsNormalizesLanguage(t *testing.T) {
+	for _, language := range []string{"EN", "En", "en-US", "en_GB"} {
+		t.Run(language, func(t *testing.T) {
+			var queried []driver.Value
+			mock := useMockDB(t)
+			mock.Query = func(query string, args []driver.Value) (*MockRows, error) {
+				if strings.Contains(query, "q.language = ?") && queried == nil {
+					queried = args
+				}
+				return emptyCatalog(query, args)
+			}
+
+			r := httptest.NewRequest("GET", "/api/questions?language="+language, nil)
+			w := httptest.NewRecorder()
+			getQuestions(w, r)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, body %s", w.Code, w.Body)
+			}
+			if len(queried) == 0 || queried[0] != "en" {
+				t.Errorf("queried language = %v, want en", queried)
+			}
+		})
+	}
+}
+
+// bulkBody returns a JSON array of n valid questions. The question at index
+// invalid, if any, has no task.
+func bulkBody(n, invalid int) string {
+	questions := make([]string, n)
+	for i := range questions {
+		task := fmt.Sprintf("What is your favourite memory number %d?", i)
+		if i == invalid {
+			task = ""
+		}
+		questions[i] = fmt.Sprintf(`{"language": "en", "type": "truth", "task": %q}`, task)
+	}
+	return "[" + strings.Join(questions, ",") + "]"
+}
+
+// countingInserts makes mock number inserted questions from 1.
+func countingInserts(mock *MockDB) {
+	var lastID int64
+	mock.Exec = func(query string, args []driver.Value) (driver.Result, error) {
+		if strings.HasPrefix(query, "INSERT INTO questions ") {
+			lastID++
+			return MockResult{LastID: lastID, Affected: 1}, nil
+		}
+		return MockResult{LastID: 1, Affected: 1}, nil
+	}
+}
+
+func TestImportQuestionsInsertsInBatches(t *testing.T) {
+	mock := useMockDB(t)
+	countingInserts(mock)
+
+	const n = 2*importBatchSize + 50
+	r := httptest.NewRequest("POST", "/api/questions/bulk", strings.NewReader(bulkBody(n, -1)))
+	w := httptest.NewRecorder()
+	importQuestions(w, r)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("status = %d, body %.300s", w.Code, w.Body)
+	}
+	var resp BulkImportResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Inserted != n || len(resp.IDs) != n || resp.IDs[0] != 1 || resp.IDs[n-1] != n {
+		t.Errorf("inserted %d, ids %d from %v, want %d numbered from 1", resp.Inserted, len(resp.IDs), resp.IDs[:1], n)
+	}
+	if resp.Code != "" {
+		t.Errorf("code = %s on success", resp.Code)
+	}
+	if got := mock.Commits(); got != 3 {
+		t.Errorf("commits = %d, want one per batch of %d", got, importBatchSize)
+	}
+}
+
+func TestImportQuestionsStopsAtFailure(t *testing.T) {
+	tests := []struct {
+		name         string
+		body         string
+		limit        int
+		wantCode     apierror.Code
+		wantInserted int
+		wantField    string
+	}{
+		{"invalid question in first batch", bulkBody(150, 30), defaultMaxImportRows, apierror.ValidationFailed, 0, "[30].task"},
+		{"invalid question in later batch", bulkBody(250, 130), defaultMaxImportRows, apierror.ValidationFailed, importBatchSize, "[130].task"},
+		{"malformed question", `[{"language": "en", "type": "truth", "task": "What scares you?"}, {"task": 5}]`, defaultMaxImportRows, apierror.InvalidBody, 0, ""},
+		{"not an array", `{"task": "What scares you?"}`, defaultMaxImportRows, apierror.InvalidBody, 0, ""},
+		{"empty array", `[]`, defaultMaxImportRows, apierror.InvalidBody, 0, ""},
+		{"too many questions", bulkBody(151, -1), 150, apierror.InvalidBody, importBatchSize, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			saved := maxImportRows
+			maxImportRows = tt.limit
+			t.Cleanup(func() { maxImportRows = saved })
+			mock := useMockDB(t)
+			countingInserts(mock)
+
+			r := httptest.NewRequest("POST", "/api/questions/bulk", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			importQuestions(w, r)
+
+			if w.Code != apierror.Status(tt.wantCode) {
+				t.Fatalf("status = %d, want %d, body %.300s", w.Code, apierror.Status(tt.wantCode), w.Body)
+			}
+			var resp BulkImportResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Code != string(tt.wantCode) {
+				t.Errorf("code = %s, want %s", resp.Code, tt.wantCode)
+			}
+			if resp.Inserted != tt.wantInserted || len(resp.IDs) != tt.wantInserted {
+				t.Errorf("inserted = %d with %d ids, want %d", resp.Inserted, len(resp.IDs), tt.wantInserted)
+			}
+			if got := mock.Commits(); got != tt.wantInserted/importBatchSize {
+				t.Errorf("commits = %d, want %d", got, tt.wantInserted/importBatchSize)
+			}
+			if tt.wantField != "" && (len(resp.Fields) != 1 || resp.Fields[0].Field != tt.wantField) {
+				t.Errorf("fields = %+v, want %s", resp.Fields, tt.wantField)
+			}
+		})
+	}
+}
+
+func TestImportQuestionsAcceptsLimit(t *testing.T) {
+	saved := maxImportRows
+	maxImportRows = 150
+	t.Cleanup(func() { maxImportRows = saved })
+	mock := useMockDB(t)
+	countingInserts(mock)
+
+	r := httptest.NewRequest("POST", "/api/questions/bulk", strings.NewReader(bulkBody(150, -1)))
+	w := httptest.NewRecorder()
+	importQuestions(w, r)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("status = %d, body %.300s", w.Code, w.Body)
+	}
+}
+
+func TestLoadMaxImportRows(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    int
+		wantErr bool
+	}{
+		{"", defaultMaxImportRows, false},
+		{"500", 500, false},
+		{"1", 1, false},
+		{"0", 0, true},
+		{"-5", 0, true},
+		{"many", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			t.Setenv("MAX_IMPORT_ROWS", tt.raw)
+			got, err := loadMaxImportRows()
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("loadMaxImportRows() = %d, %v; want %d, error %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
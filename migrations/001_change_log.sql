@@ -0,0 +1,7 @@
+-- Adds the question change log used by GET /api/changes.
+CREATE TABLE IF NOT EXISTS change_log (
+    seq BIGINT AUTO_INCREMENT PRIMARY KEY,
+    action ENUM('create', 'update', 'delete') NOT NULL,
+    entity_id INT NOT NULL,
+    occurred_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
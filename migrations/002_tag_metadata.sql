@@ -0,0 +1,11 @@
+-- Adds curated tag metadata used by /api/tags/export and /api/tags/import.
+ALTER TABLE tags
+    ADD COLUMN category VARCHAR(50) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NULL,
+    ADD COLUMN description VARCHAR(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NULL;
+
+CREATE TABLE IF NOT EXISTS tag_aliases (
+    tag_id INT NOT NULL,
+    alias VARCHAR(50) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL UNIQUE,
+    FOREIGN KEY (tag_id) REFERENCES tags(id),
+    PRIMARY KEY (tag_id, alias)
+);
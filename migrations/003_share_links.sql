@@ -0,0 +1,6 @@
+-- Adds persisted share links created by GET /api/questions/share-link?save=true.
+CREATE TABLE IF NOT EXISTS share_links (
+    token CHAR(16) PRIMARY KEY,
+    filters JSON NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,5 @@
+-- Records when each question was created, for GET /api/questions/new.
+ALTER TABLE questions
+    ADD COLUMN created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    ADD INDEX idx_questions_language_created_at (language, created_at),
+    ADD INDEX idx_questions_created_at (created_at);
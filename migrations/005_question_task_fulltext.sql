@@ -0,0 +1,2 @@
+-- Enables full-text search over question text for the search filter.
+ALTER TABLE questions ADD FULLTEXT INDEX ft_questions_task (task);
@@ -0,0 +1,9 @@
+-- Records questions flagged for moderation by content filters.
+CREATE TABLE IF NOT EXISTS question_flags (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    question_id INT NOT NULL,
+    filter VARCHAR(50) NOT NULL,
+    reason VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (question_id) REFERENCES questions(id)
+);
@@ -0,0 +1,2 @@
+-- Adds the player placeholder for directed dares.
+ALTER TABLE questions ADD COLUMN dare_target VARCHAR(100) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NULL;
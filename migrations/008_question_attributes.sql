@@ -0,0 +1,2 @@
+-- Adds schema-validated extension attributes to questions.
+ALTER TABLE questions ADD COLUMN attributes JSON NULL;
@@ -0,0 +1,9 @@
+-- Adds short-lived game codes that map to a stored filter set.
+CREATE TABLE IF NOT EXISTS games (
+    code CHAR(6) PRIMARY KEY,
+    filters JSON NOT NULL,
+    seed BIGINT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL,
+    INDEX idx_games_expires_at (expires_at)
+);
@@ -0,0 +1,8 @@
+-- Adds the tokenized search index maintained by the API. The API fills it on
+-- startup when it is empty, or on demand via POST /api/admin/search-index/rebuild.
+CREATE TABLE IF NOT EXISTS question_search (
+    question_id INT PRIMARY KEY,
+    search_tokens TEXT CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL,
+    FOREIGN KEY (question_id) REFERENCES questions(id),
+    FULLTEXT INDEX ft_question_search_tokens (search_tokens)
+);
@@ -0,0 +1,9 @@
+-- Remembers the validators of documents imported via
+-- POST /api/questions/import-url so unchanged documents are not re-imported.
+CREATE TABLE IF NOT EXISTS import_sources (
+    url_hash CHAR(64) PRIMARY KEY,
+    url TEXT NOT NULL,
+    etag VARCHAR(255) NOT NULL DEFAULT '',
+    last_modified VARCHAR(64) NOT NULL DEFAULT '',
+    imported_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+);
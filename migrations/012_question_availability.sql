@@ -0,0 +1,6 @@
+-- Adds optional availability windows for seasonal questions. Questions are
+-- only served between available_from and available_until unless a request
+-- passes includeScheduled=true.
+ALTER TABLE questions
+    ADD COLUMN available_from DATETIME NULL,
+    ADD COLUMN available_until DATETIME NULL;
@@ -0,0 +1,21 @@
+-- Adds the state of pull replication from an upstream instance
+-- (SYNC_UPSTREAM_URL): the change feed cursor and outcome of the last run,
+-- and the mapping from upstream question IDs to local ones.
+CREATE TABLE IF NOT EXISTS sync_state (
+    upstream_hash CHAR(64) PRIMARY KEY,
+    upstream TEXT NOT NULL,
+    cursor_seq BIGINT NOT NULL DEFAULT 0,
+    applied BIGINT NOT NULL DEFAULT 0,
+    skipped BIGINT NOT NULL DEFAULT 0,
+    last_sync_at DATETIME NULL,
+    last_error TEXT NULL,
+    last_error_at DATETIME NULL
+);
+
+CREATE TABLE IF NOT EXISTS sync_questions (
+    upstream_hash CHAR(64) NOT NULL,
+    upstream_id INT NOT NULL,
+    local_id INT NOT NULL,
+    PRIMARY KEY (upstream_hash, upstream_id),
+    UNIQUE INDEX idx_sync_questions_local_id (local_id)
+);
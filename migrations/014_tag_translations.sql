@@ -0,0 +1,9 @@
+-- Adds per-locale display names for tags, served in the GET /api/i18n/{locale}
+-- bundle and edited through /api/admin/tag-translations.
+CREATE TABLE IF NOT EXISTS tag_translations (
+    tag_id INT NOT NULL,
+    locale CHAR(2) NOT NULL,
+    display_name VARCHAR(100) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL,
+    FOREIGN KEY (tag_id) REFERENCES tags(id),
+    PRIMARY KEY (tag_id, locale)
+);
@@ -0,0 +1,3 @@
+-- Adds a prefix index on question text for duplicate checks, which look
+-- tasks up by exact text within a language.
+ALTER TABLE questions ADD INDEX idx_task_prefix (task(255));
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+)
+
+// MockDB is a DBInterface backed by an in-memory database/sql driver, so
+// Database methods and the handlers using them can be tested without MySQL.
+// Query and Exec answer the statements; BeginErr and CommitErr make
+// transactions fail.
+type MockDB struct {
+	*sql.DB
+
+	// Query answers QueryContext and QueryRowContext. When nil, every query
+	// returns no rows.
+	Query func(query string, args []driver.Value) (*MockRows, error)
+
+	// Exec answers ExecContext. When nil, every statement affects one row
+	// and reports insert ID 1.
+	Exec func(query string, args []driver.Value) (driver.Result, error)
+
+	// BeginErr is returned by BeginTx instead of starting a transaction.
+	BeginErr error
+
+	// CommitErr is returned by every commit.
+	CommitErr error
+
+	mu         sync.Mutex
+	statements []string
+	commits    int
+	rollbacks  int
+}
+
+// MockRows is the result of a query answered by MockDB.Query. When Err is
+// set, reading fails with it after the last of Values, like a connection
+// lost in the middle of a result set. OnRow, when set, is called with the
+// index of each row as the driver hands it out.
+type MockRows struct {
+	Columns []string
+	Values  [][]driver.Value
+	Err     error
+	OnRow   func(n int)
+}
+
+// NewMockDB returns a MockDB that is closed when the test ends.
+func NewMockDB(t testing.TB) *MockDB {
+	t.Helper()
+	m := &MockDB{}
+	m.DB = sql.OpenDB(mockConnector{m})
+	t.Cleanup(func() { m.DB.Close() })
+	return m
+}
+
+// useMockDB points the handlers' db at a new MockDB until the test ends.
+func useMockDB(t testing.TB) *MockDB {
+	t.Helper()
+	mock := NewMockDB(t)
+	saved := db
+	db = &Database{db: mock}
+	t.Cleanup(func() { db = saved })
+	return mock
+}
+
+// BeginTx starts a transaction, or fails with BeginErr.
+func (m *MockDB) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+	if m.BeginErr != nil {
+		return nil, m.BeginErr
+	}
+	return m.DB.BeginTx(ctx, opts)
+}
+
+// Statements returns every query and statement run so far, in order.
+func (m *MockDB) Statements() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]string(nil), m.statements...)
+}
+
+// Commits returns the number of commits attempted.
+func (m *MockDB) Commits() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.commits
+}
+
+// Rollbacks returns the number of rolled back transactions.
+func (m *MockDB) Rollbacks() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.rollbacks
+}
+
+func (m *MockDB) record(query string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.statements = append(m.statements, query)
+}
+
+// MockResult is the result of a statement answered by MockDB.Exec.
+type MockResult struct {
+	LastID   int64
+	Affected int64
+}
+
+func (r MockResult) LastInsertId() (int64, error) {
+	return r.LastID, nil
+}
+
+func (r MockResult) RowsAffected() (int64, error) {
+	return r.Affected, nil
+}
+
+type mockConnector struct {
+	m *MockDB
+}
+
+func (c mockConnector) Connect(context.Context) (driver.Conn, error) {
+	return &mockConn{c.m}, nil
+}
+
+func (c mockConnector) Driver() driver.Driver {
+	return mockDriver{}
+}
+
+type mockDriver struct{}
+
+func (mockDriver) Open(string) (driver.Conn, error) {
+	return nil, errors.New("mock: use sql.OpenDB")
+}
+
+type mockConn struct {
+	m *MockDB
+}
+
+func (c *mockConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("mock: prepared statements are not supported")
+}
+
+func (c *mockConn) Close() error {
+	return nil
+}
+
+func (c *mockConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *mockConn) BeginTx(context.Context, driver.TxOptions) (driver.Tx, error) {
+	return &mockTx{c.m}, nil
+}
+
+func (c *mockConn) QueryContext(_ context.Context, query string, named []driver.NamedValue) (driver.Rows, error) {
+	c.m.record(query)
+	if c.m.Query == nil {
+		return &mockRows{}, nil
+	}
+	rows, err := c.m.Query(query, namedValues(named))
+	if err != nil {
+		return nil, err
+	}
+	return &mockRows{columns: rows.Columns, values: rows.Values, err: rows.Err, onRow: rows.OnRow}, nil
+}
+
+func (c *mockConn) ExecContext(_ context.Context, query string, named []driver.NamedValue) (driver.Result, error) {
+	c.m.record(query)
+	if c.m.Exec == nil {
+		return MockResult{LastID: 1, Affected: 1}, nil
+	}
+	return c.m.Exec(query, namedValues(named))
+}
+
+func namedValues(named []driver.NamedValue) []driver.Value {
+	values := make([]driver.Value, len(named))
+	for i, nv := range named {
+		values[i] = nv.Value
+	}
+	return values
+}
+
+type mockTx struct {
+	m *MockDB
+}
+
+func (tx *mockTx) Commit() error {
+	tx.m.mu.Lock()
+	defer tx.m.mu.Unlock()
+	tx.m.commits++
+	return tx.m.CommitErr
+}
+
+func (tx *mockTx) Rollback() error {
+	tx.m.mu.Lock()
+	defer tx.m.mu.Unlock()
+	tx.m.rollbacks++
+	return nil
+}
+
+type mockRows struct {
+	columns []string
+	values  [][]driver.Value
+	err     error
+	onRow   func(n int)
+	read    int
+}
+
+func (r *mockRows) Columns() []string {
+	return r.columns
+}
+
+func (r *mockRows) Close() error {
+	return nil
+}
+
+func (r *mockRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		if r.err != nil {
+			return r.err
+		}
+		return io.EOF
+	}
+	if r.onRow != nil {
+		r.onRow(r.read)
+	}
+	r.read++
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+)
+
+// maxPresetDeckSize caps how many questions a single preset may request.
+const maxPresetDeckSize = 500
+
+// Preset describes a curated game mode
+// @Description A named deck specification used to build curated game modes
+type Preset struct {
+	// ISO language code of the deck
+	// @example "en"
+	Language string `json:"language"`
+
+	// Tags the questions must carry
+	// @example ["family"]
+	Tags []string `json:"tags,omitempty"`
+
+	// Tags that keep a question out of the deck
+	// @example ["nsfw","alcohol"]
+	ExcludeTags []string `json:"excludeTags,omitempty"`
+
+	// Require all tags to match instead of any
+	// @example false
+	MatchAllTags bool `json:"matchAllTags,omitempty"`
+
+	// Number of truth questions in the deck
+	// @example 15
+	Truths int `json:"truths"`
+
+	// Number of dare questions in the deck
+	// @example 5
+	Dares int `json:"dares"`
+}
+
+// DeckResponse is a deck built from a preset
+// @Description A shuffled deck of questions built from a preset
+type DeckResponse struct {
+	// Name of the preset the deck was built from
+	// @example "mild-family"
+	Preset string `json:"preset"`
+
+	// Shuffled questions in the deck
+	Questions []Question `json:"questions"`
+}
+
+var presets map[string]Preset
+
+// loadPresets reads the preset definitions from the JSON file named by the
+// PRESETS_FILE environment variable. The file maps preset names to Preset
+// objects. Without PRESETS_FILE no presets are available.
+func loadPresets() (map[string]Preset, error) {
+	path := os.Getenv("PRESETS_FILE")
+	if path == "" {
+		return map[string]Preset{}, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read presets file: %w", err)
+	}
+
+	var loaded map[string]Preset
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		return nil, fmt.Errorf("failed to parse presets file: %w", err)
+	}
+
+	for name, p := range loaded {
+		if p.Truths < 0 || p.Dares < 0 || p.Truths+p.Dares > maxPresetDeckSize {
+			return nil, fmt.Errorf("preset %q: truths and dares must be non-negative and total at most %d", name, maxPresetDeckSize)
+		}
+		p.Language = normalizeLanguage(p.Language)
+		loaded[name] = p
+	}
+
+	return loaded, nil
+}
+
+// buildDeck selects random truths and dares according to p and shuffles them
+// into a single deck.
+func buildDeck(ctx context.Context, d *Database, p Preset) ([]Question, error) {
+	filters := FilterSet{
+		Language:     p.Language,
+		Tags:         p.Tags,
+		ExcludeTags:  p.ExcludeTags,
+		MatchAllTags: p.MatchAllTags,
+	}
+
+	deck := []Question{}
+	for qType, count := range map[string]int{"truth": p.Truths, "dare": p.Dares} {
+		if count == 0 {
+			continue
+		}
+		filters.Type = qType
+		questions, err := d.GetRandomQuestions(ctx, filters, count)
+		if err != nil {
+			return nil, err
+		}
+		deck = append(deck, questions...)
+	}
+
+	rand.Shuffle(len(deck), func(i, j int) { deck[i], deck[j] = deck[j], deck[i] })
+	return deck, nil
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// DBInterface is the part of *sql.DB that Database uses. It is implemented
+// by *sql.DB and by MockDB in tests, which can make BeginTx and Commit fail
+// on demand.
+type DBInterface interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
+	Conn(ctx context.Context) (*sql.Conn, error)
+	PingContext(ctx context.Context) error
+	Close() error
+}
+
+// queryLogEntry is the JSON record written for each logged query. Argument
+// values are never logged, only their types, so logs cannot leak question
+// text or other user data.
+type queryLogEntry struct {
+	Query      string   `json:"query"`
+	ArgsCount  int      `json:"args_count"`
+	ArgsTypes  []string `json:"args_types"`
+	DurationMS int64    `json:"duration_ms"`
+	Failed     bool     `json:"failed,omitempty"`
+}
+
+// withQueryLogging returns c wrapped in a loggingConnector when
+// QUERY_LOG_LEVEL is "debug", and c itself otherwise.
+func withQueryLogging(c driver.Connector) driver.Connector {
+	if os.Getenv("QUERY_LOG_LEVEL") != "debug" {
+		return c
+	}
+	log.Println("Logging SQL queries (QUERY_LOG_LEVEL=debug)")
+	return loggingConnector{c}
+}
+
+// loggingConnector wraps a driver.Connector and logs every statement run on
+// its connections. Logging at the driver level covers statements on the
+// pool, on a *sql.Conn and inside transactions alike.
+type loggingConnector struct {
+	driver.Connector
+}
+
+func (c loggingConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &loggingConn{conn}, nil
+}
+
+// loggingConn logs the statements run on a driver connection. It passes the
+// optional driver interfaces through to the wrapped connection, so
+// database/sql treats it like the connection itself.
+type loggingConn struct {
+	driver.Conn
+}
+
+func (c *loggingConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	start := time.Now()
+	rows, err := queryer.QueryContext(ctx, query, args)
+	// ErrSkip makes database/sql prepare the statement instead, which is
+	// logged by loggingStmt.
+	if err != driver.ErrSkip {
+		logQuery(query, args, start, err)
+	}
+	return rows, err
+}
+
+func (c *loggingConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	start := time.Now()
+	result, err := execer.ExecContext(ctx, query, args)
+	if err != driver.ErrSkip {
+		logQuery(query, args, start, err)
+	}
+	return result, err
+}
+
+func (c *loggingConn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *loggingConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	var stmt driver.Stmt
+	var err error
+	if preparer, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		stmt, err = preparer.PrepareContext(ctx, query)
+	} else {
+		stmt, err = c.Conn.Prepare(query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &loggingStmt{Stmt: stmt, query: query}, nil
+}
+
+func (c *loggingConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if beginner, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return beginner.BeginTx(ctx, opts)
+	}
+	return c.Conn.Begin() //nolint:staticcheck // fallback for drivers without BeginTx
+}
+
+func (c *loggingConn) Ping(ctx context.Context) error {
+	if pinger, ok := c.Conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *loggingConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if checker, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+func (c *loggingConn) ResetSession(ctx context.Context) error {
+	if resetter, ok := c.Conn.(driver.SessionResetter); ok {
+		return resetter.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *loggingConn) IsValid() bool {
+	if validator, ok := c.Conn.(driver.Validator); ok {
+		return validator.IsValid()
+	}
+	return true
+}
+
+// loggingStmt logs every execution of a prepared statement.
+type loggingStmt struct {
+	driver.Stmt
+	query string
+}
+
+func (s *loggingStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := s.Stmt.(driver.StmtQueryContext)
+	if !ok {
+		return nil, errors.New("driver statement does not support QueryContext")
+	}
+	start := time.Now()
+	rows, err := queryer.QueryContext(ctx, args)
+	logQuery(s.query, args, start, err)
+	return rows, err
+}
+
+func (s *loggingStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := s.Stmt.(driver.StmtExecContext)
+	if !ok {
+		return nil, errors.New("driver statement does not support ExecContext")
+	}
+	start := time.Now()
+	result, err := execer.ExecContext(ctx, args)
+	logQuery(s.query, args, start, err)
+	return result, err
+}
+
+func (s *loggingStmt) CheckNamedValue(nv *driver.NamedValue) error {
+	if checker, ok := s.Stmt.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+// logQuery writes a queryLogEntry for a finished query. Whitespace in the
+// query is collapsed so each entry stays on one line.
+func logQuery(query string, args []driver.NamedValue, start time.Time, err error) {
+	entry := queryLogEntry{
+		Query:      strings.Join(strings.Fields(query), " "),
+		ArgsCount:  len(args),
+		ArgsTypes:  make([]string, len(args)),
+		DurationMS: time.Since(start).Milliseconds(),
+	}
+	for i, arg := range args {
+		if arg.Value == nil {
+			entry.ArgsTypes[i] = "null"
+		} else {
+			entry.ArgsTypes[i] = fmt.Sprintf("%T", arg.Value)
+		}
+	}
+	// Driver errors can quote argument values, such as the duplicate key in
+	// a unique constraint violation, so only the fact of failure is logged.
+	entry.Failed = err != nil
+
+	data, _ := json.Marshal(entry)
+	log.Printf("sql %s", data)
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"log"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// loggedQueries runs fn against a MockDB opened through withQueryLogging
+// with QUERY_LOG_LEVEL=debug and returns the entries it logged.
+func loggedQueries(t *testing.T, mock *MockDB, fn func(d *Database)) []queryLogEntry {
+	t.Helper()
+	t.Setenv("QUERY_LOG_LEVEL", "debug")
+
+	var buf bytes.Buffer
+	saved, savedFlags := log.Writer(), log.Flags()
+	log.SetOutput(&buf)
+	log.SetFlags(0)
+	t.Cleanup(func() {
+		log.SetOutput(saved)
+		log.SetFlags(savedFlags)
+	})
+
+	mock.DB = sql.OpenDB(withQueryLogging(mockConnector{mock}))
+	t.Cleanup(func() { mock.DB.Close() })
+	fn(&Database{db: mock})
+
+	var entries []queryLogEntry
+	for _, line := range strings.Split(buf.String(), "\n") {
+		data, ok := strings.CutPrefix(line, "sql ")
+		if !ok {
+			continue
+		}
+		var entry queryLogEntry
+		if err := json.Unmarshal([]byte(data), &entry); err != nil {
+			t.Fatalf("log line %q: %v", line, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestQueryLoggingCoversTransactions(t *testing.T) {
+	mock := &MockDB{}
+	entries := loggedQueries(t, mock, func(d *Database) {
+		ctx := context.Background()
+		rows, err := d.db.QueryContext(ctx, "SELECT id FROM questions WHERE language = ?", "secret task")
+		if err != nil {
+			t.Fatal(err)
+		}
+		rows.Close()
+
+		err = d.withTransaction(ctx, func(tx *sql.Tx) error {
+			if _, err := tx.ExecContext(ctx, "INSERT INTO tags (name)\n\t\tVALUES (?)", "funny"); err != nil {
+				return err
+			}
+			var id int64
+			err := tx.QueryRowContext(ctx, "SELECT id FROM tags WHERE name = ?", nil).Scan(&id)
+			if err != nil && !errors.Is(err, sql.ErrNoRows) {
+				return err
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	want := []queryLogEntry{
+		{Query: "SELECT id FROM questions WHERE language = ?", ArgsCount: 1, ArgsTypes: []string{"string"}},
+		{Query: "INSERT INTO tags (name) VALUES (?)", ArgsCount: 1, ArgsTypes: []string{"string"}},
+		{Query: "SELECT id FROM tags WHERE name = ?", ArgsCount: 1, ArgsTypes: []string{"null"}},
+	}
+	for i := range entries {
+		entries[i].DurationMS = 0
+	}
+	if !reflect.DeepEqual(entries, want) {
+		t.Errorf("logged %+v, want %+v", entries, want)
+	}
+	if got := len(mock.Statements()); got != len(want) {
+		t.Errorf("ran %d statements, want %d", got, len(want))
+	}
+}
+
+func TestQueryLoggingMarksFailures(t *testing.T) {
+	mock := &MockDB{
+		Exec: func(query string, args []driver.Value) (driver.Result, error) {
+			return nil, errors.New("secret driver message")
+		},
+	}
+	entries := loggedQueries(t, mock, func(d *Database) {
+		err := d.withTransaction(context.Background(), func(tx *sql.Tx) error {
+			_, err := tx.ExecContext(context.Background(), "DELETE FROM questions WHERE id = ?", int64(1))
+			return err
+		})
+		if err == nil {
+			t.Fatal("transaction succeeded, want the exec error")
+		}
+	})
+
+	if len(entries) != 1 {
+		t.Fatalf("logged %d entries, want 1: %+v", len(entries), entries)
+	}
+	if !entries[0].Failed {
+		t.Error("failed statement not marked as failed")
+	}
+	if !reflect.DeepEqual(entries[0].ArgsTypes, []string{"int64"}) {
+		t.Errorf("ArgsTypes = %v, want [int64]", entries[0].ArgsTypes)
+	}
+}
+
+func TestQueryLoggingDisabled(t *testing.T) {
+	t.Setenv("QUERY_LOG_LEVEL", "")
+	c := mockConnector{&MockDB{}}
+	if got := withQueryLogging(c); got != driver.Connector(c) {
+		t.Errorf("withQueryLogging = %T, want the connector unchanged", got)
+	}
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/2Friendly4You/TruthOrDare/apierror"
+	"golang.org/x/time/rate"
+)
+
+const (
+	// rateLimitIdleTTL is how long a client's bucket is kept after its last
+	// request. A bucket idle for that long has refilled completely, so
+	// dropping it changes nothing for the client.
+	rateLimitIdleTTL = 3 * time.Minute
+
+	// rateLimitSweepInterval is how often idle buckets are evicted.
+	rateLimitSweepInterval = time.Minute
+)
+
+// rateLimiter limits public read requests per client, or is nil when
+// RATE_LIMIT_RPS is not set.
+var rateLimiter *RateLimiter
+
+// RateLimiter keeps one token bucket per client IP.
+type RateLimiter struct {
+	rps   rate.Limit
+	burst int
+
+	mu      sync.Mutex
+	clients map[string]*rateClient
+}
+
+type rateClient struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// NewRateLimiter returns a RateLimiter allowing each client rps requests per
+// second on average and bursts of up to burst requests.
+func NewRateLimiter(rps float64, burst int) *RateLimiter {
+	return &RateLimiter{
+		rps:     rate.Limit(rps),
+		burst:   burst,
+		clients: map[string]*rateClient{},
+	}
+}
+
+// loadRateLimiter reads RATE_LIMIT_RPS and RATE_LIMIT_BURST. It returns nil
+// when RATE_LIMIT_RPS is unset or 0. The burst defaults to twice the rate,
+// rounded up.
+func loadRateLimiter() (*RateLimiter, error) {
+	raw := os.Getenv("RATE_LIMIT_RPS")
+	if raw == "" {
+		return nil, nil
+	}
+	rps, err := strconv.ParseFloat(raw, 64)
+	if err != nil || rps < 0 || math.IsInf(rps, 0) || math.IsNaN(rps) {
+		return nil, fmt.Errorf("invalid RATE_LIMIT_RPS %q: must be a non-negative number", raw)
+	}
+	if rps == 0 {
+		return nil, nil
+	}
+
+	burst := int(math.Ceil(2 * rps))
+	if raw := os.Getenv("RATE_LIMIT_BURST"); raw != "" {
+		burst, err = strconv.Atoi(raw)
+		if err != nil || burst < 1 {
+			return nil, fmt.Errorf("invalid RATE_LIMIT_BURST %q: must be a positive integer", raw)
+		}
+	}
+
+	return NewRateLimiter(rps, burst), nil
+}
+
+// Reserve takes a token from the bucket of client. It returns 0 if the
+// request may proceed, or how long the client has to wait for a token.
+func (l *RateLimiter) Reserve(client string, now time.Time) time.Duration {
+	l.mu.Lock()
+	c, ok := l.clients[client]
+	if !ok {
+		c = &rateClient{limiter: rate.NewLimiter(l.rps, l.burst)}
+		l.clients[client] = c
+	}
+	c.lastSeen = now
+	l.mu.Unlock()
+
+	// Rejected requests must not use up tokens, or a client retrying too
+	// early would push its own wait further out.
+	reservation := c.limiter.ReserveN(now, 1)
+	delay := reservation.DelayFrom(now)
+	if delay > 0 {
+		reservation.CancelAt(now)
+	}
+	return delay
+}
+
+// Run evicts idle client buckets every rateLimitSweepInterval until ctx is
+// done.
+func (l *RateLimiter) Run(ctx context.Context) {
+	ticker := time.NewTicker(rateLimitSweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			l.evict(now.Add(-rateLimitIdleTTL))
+		}
+	}
+}
+
+// evict drops the buckets of clients not seen since cutoff.
+func (l *RateLimiter) evict(cutoff time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for client, c := range l.clients {
+		if c.lastSeen.Before(cutoff) {
+			delete(l.clients, client)
+		}
+	}
+}
+
+// trustedProxies lists the proxies whose X-Real-IP and X-Forwarded-For
+// headers clientIP believes (TRUSTED_PROXIES). With none configured the
+// headers are ignored, since any client can set them.
+var trustedProxies []netip.Prefix
+
+// loadTrustedProxies reads TRUSTED_PROXIES, a comma-separated list of IP
+// addresses and CIDR ranges such as "172.16.0.0/12,10.0.0.5".
+func loadTrustedProxies() ([]netip.Prefix, error) {
+	var proxies []netip.Prefix
+	for _, entry := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if strings.Contains(entry, "/") {
+			prefix, err := netip.ParsePrefix(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid TRUSTED_PROXIES entry %q: %w", entry, err)
+			}
+			proxies = append(proxies, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid TRUSTED_PROXIES entry %q: %w", entry, err)
+		}
+		addr = addr.Unmap()
+		proxies = append(proxies, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return proxies, nil
+}
+
+// isTrustedProxy reports whether addr is one of trustedProxies.
+func isTrustedProxy(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP returns the address of the client that sent r. That is the peer
+// address of the connection unless the peer is a trusted proxy; then it is
+// X-Real-IP, or else the rightmost X-Forwarded-For address that is not
+// itself a trusted proxy. Addresses left of that one were supplied by the
+// client and are never used.
+func clientIP(r *http.Request) string {
+	peer, err := netip.ParseAddrPort(r.RemoteAddr)
+	if err != nil {
+		host, _, splitErr := net.SplitHostPort(r.RemoteAddr)
+		if splitErr != nil {
+			return r.RemoteAddr
+		}
+		return host
+	}
+	if !isTrustedProxy(peer.Addr()) {
+		return peer.Addr().Unmap().String()
+	}
+
+	if realIP, err := netip.ParseAddr(strings.TrimSpace(r.Header.Get("X-Real-IP"))); err == nil {
+		return realIP.Unmap().String()
+	}
+
+	client := peer.Addr().Unmap()
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		client = hop.Unmap()
+		if !isTrustedProxy(client) {
+			break
+		}
+	}
+	return client.String()
+}
+
+// rateLimit rejects requests from clients that exceeded rateLimiter with a
+// RATE_LIMITED error and a Retry-After header. Without a rate limiter every
+// request passes.
+func rateLimit(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if rateLimiter == nil {
+			next(w, r)
+			return
+		}
+		if delay := rateLimiter.Reserve(clientIP(r), time.Now()); delay > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(delay.Seconds()))))
+			writeError(w, apierror.RateLimited, "Too many requests")
+			return
+		}
+		next(w, r)
+	}
+}
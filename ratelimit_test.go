@@ -0,0 +1,116 @@
+package main
+
+import (
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestClientIP(t *testing.T) {
+	proxies := []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("192.0.2.7/32"),
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		realIP     string
+		forwarded  []string
+		want       string
+	}{
+		{"direct client", "203.0.113.9:5123", "", nil, "203.0.113.9"},
+		{"untrusted peer ignores X-Forwarded-For", "203.0.113.9:5123", "", []string{"198.51.100.1"}, "203.0.113.9"},
+		{"untrusted peer ignores X-Real-IP", "203.0.113.9:5123", "198.51.100.1", nil, "203.0.113.9"},
+		{"trusted proxy with X-Real-IP", "10.1.2.3:80", "198.51.100.1", []string{"1.1.1.1, 198.51.100.1"}, "198.51.100.1"},
+		{"trusted proxy uses rightmost hop", "10.1.2.3:80", "", []string{"1.1.1.1, 198.51.100.1"}, "198.51.100.1"},
+		{"skips trusted hops", "10.1.2.3:80", "", []string{"1.1.1.1, 198.51.100.1, 192.0.2.7, 10.9.9.9"}, "198.51.100.1"},
+		{"joins repeated headers", "10.1.2.3:80", "", []string{"1.1.1.1", "198.51.100.1"}, "198.51.100.1"},
+		{"stops at malformed hop", "10.1.2.3:80", "", []string{"198.51.100.1, bogus, 192.0.2.7"}, "192.0.2.7"},
+		{"trusted proxy without headers", "10.1.2.3:80", "", nil, "10.1.2.3"},
+		{"IPv6 peer", "[2001:db8::1]:443", "", []string{"198.51.100.1"}, "2001:db8::1"},
+		{"IPv4-mapped trusted peer", "[::ffff:10.1.2.3]:80", "", []string{"198.51.100.1"}, "198.51.100.1"},
+	}
+
+	saved := trustedProxies
+	trustedProxies = proxies
+	defer func() { trustedProxies = saved }()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/api/questions", nil)
+			r.RemoteAddr = tt.remoteAddr
+			if tt.realIP != "" {
+				r.Header.Set("X-Real-IP", tt.realIP)
+			}
+			for _, value := range tt.forwarded {
+				r.Header.Add("X-Forwarded-For", value)
+			}
+			if got := clientIP(r); got != tt.want {
+				t.Errorf("clientIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadTrustedProxies(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    []string
+		wantErr bool
+	}{
+		{"", nil, false},
+		{"10.0.0.5", []string{"10.0.0.5/32"}, false},
+		{"172.16.0.0/12, 10.0.0.5 ,::1", []string{"172.16.0.0/12", "10.0.0.5/32", "::1/128"}, false},
+		{"10.1.2.3/8", []string{"10.0.0.0/8"}, false},
+		{"proxy.local", nil, true},
+		{"10.0.0.0/33", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			t.Setenv("TRUSTED_PROXIES", tt.value)
+			got, err := loadTrustedProxies()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadTrustedProxies() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("loadTrustedProxies() = %v, want %v", got, tt.want)
+			}
+			for i, prefix := range got {
+				if prefix.String() != tt.want[i] {
+					t.Errorf("prefix %d = %s, want %s", i, prefix, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestRateLimiterReserve(t *testing.T) {
+	limiter := NewRateLimiter(1, 2)
+	now := time.Now()
+
+	for i := 0; i < 2; i++ {
+		if delay := limiter.Reserve("a", now); delay != 0 {
+			t.Fatalf("request %d within burst delayed by %v", i+1, delay)
+		}
+	}
+	if delay := limiter.Reserve("a", now); delay <= 0 {
+		t.Fatal("request beyond burst was not delayed")
+	}
+	// The rejected request must not have used up a token.
+	if delay := limiter.Reserve("a", now.Add(time.Second)); delay != 0 {
+		t.Fatalf("request after refill delayed by %v", delay)
+	}
+	if delay := limiter.Reserve("b", now); delay != 0 {
+		t.Fatalf("other client delayed by %v", delay)
+	}
+
+	limiter.evict(now.Add(time.Millisecond))
+	if _, ok := limiter.clients["b"]; ok {
+		t.Error("idle client was not evicted")
+	}
+	if _, ok := limiter.clients["a"]; !ok {
+		t.Error("recent client was evicted")
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/2Friendly4You/TruthOrDare/fixtures"
+)
+
+// defaultRecordEndpoints are recorded when RECORD_ENDPOINTS is not set.
+const defaultRecordEndpoints = "/api/questions,/api/tags"
+
+// recordingResponseWriter captures the status and body written by a handler
+// while passing them through to the client.
+type recordingResponseWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rw *recordingResponseWriter) WriteHeader(status int) {
+	rw.status = status
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *recordingResponseWriter) Write(b []byte) (int, error) {
+	rw.body.Write(b)
+	return rw.ResponseWriter.Write(b)
+}
+
+// recordingEnabled reports whether fixture recording should be switched on.
+// Recording is a development aid: it requires RECORD_FIXTURES_DIR and is
+// refused outright when APP_ENV is "production".
+func recordingEnabled() bool {
+	if os.Getenv("RECORD_FIXTURES_DIR") == "" {
+		return false
+	}
+	if os.Getenv("APP_ENV") == "production" {
+		log.Println("RECORD_FIXTURES_DIR is ignored when APP_ENV=production")
+		return false
+	}
+	return true
+}
+
+// recordFixtures wraps next so that JSON responses for the whitelisted
+// endpoints in RECORD_ENDPOINTS are written to RECORD_FIXTURES_DIR as
+// fixtures.Fixture files. Requests with the same filter fingerprint overwrite
+// the same file, so repeated calls do not produce duplicates.
+func recordFixtures(next http.Handler) http.Handler {
+	dir := os.Getenv("RECORD_FIXTURES_DIR")
+	endpoints := os.Getenv("RECORD_ENDPOINTS")
+	if endpoints == "" {
+		endpoints = defaultRecordEndpoints
+	}
+	whitelist := map[string]bool{}
+	for _, endpoint := range strings.Split(endpoints, ",") {
+		whitelist[strings.TrimSpace(endpoint)] = true
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		log.Printf("Fixture recording disabled: %v", err)
+		return next
+	}
+	log.Printf("Recording fixtures for %s to %s", endpoints, dir)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !whitelist[r.URL.Path] || r.Method != http.MethodGet {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		rw := &recordingResponseWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rw, r)
+
+		contentType := rw.Header().Get("Content-Type")
+		if !strings.HasPrefix(contentType, "application/json") {
+			return
+		}
+
+		key := "default"
+		if filters, err := ParseFilterSet(r.URL.Query()); err == nil {
+			key = filters.Fingerprint()
+		}
+
+		fixture := fixtures.Fixture{
+			Request: fixtures.Request{
+				Method: r.Method,
+				Path:   r.URL.Path,
+				Query:  r.URL.Query(),
+			},
+			Response: fixtures.Response{
+				Status:      rw.status,
+				ContentType: contentType,
+				Body:        json.RawMessage(bytes.TrimSpace(rw.body.Bytes())),
+			},
+		}
+
+		data, err := json.MarshalIndent(fixture, "", "  ")
+		if err != nil {
+			log.Printf("Failed to encode fixture: %v", err)
+			return
+		}
+		path := filepath.Join(dir, fixtures.FileName(r.URL.Path, key))
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			log.Printf("Failed to write fixture: %v", err)
+		}
+	})
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/2Friendly4You/TruthOrDare/apierror"
+	"github.com/go-sql-driver/mysql"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+const (
+	// contentLengthThreshold is the largest payload for which respondJSON sets
+	// a Content-Length header. Larger payloads are sent chunked.
+	contentLengthThreshold = 64 << 10
+
+	// maxPooledBufferSize keeps oversized buffers from being returned to the
+	// pool so a single traffic spike does not pin large allocations in memory.
+	maxPooledBufferSize = 1 << 20
+)
+
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		return new(bytes.Buffer)
+	},
+}
+
+func getBuffer() *bytes.Buffer {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	return buf
+}
+
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledBufferSize {
+		return
+	}
+	bufferPool.Put(buf)
+}
+
+// respondJSON encodes v into a pooled buffer and writes it with the given
+// status code. The whole payload is encoded before anything is sent, so if
+// encoding fails the client receives a JSON ErrorResponse instead of a
+// truncated body. Small payloads get a Content-Length header; larger ones
+// go out without it and net/http sends them with chunked transfer encoding.
+func respondJSON(w http.ResponseWriter, status int, v interface{}) {
+	buf := getBuffer()
+	defer putBuffer(buf)
+
+	if err := json.NewEncoder(buf).Encode(v); err != nil {
+		log.Printf("Failed to encode response to JSON: %v", err)
+		buf.Reset()
+		json.NewEncoder(buf).Encode(ErrorResponse{Message: "Failed to encode response to JSON", Code: string(apierror.Internal)})
+		status = http.StatusInternalServerError
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if buf.Len() <= contentLengthThreshold {
+		w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	}
+	w.WriteHeader(status)
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		log.Printf("Failed to write response: %v", err)
+	}
+}
+
+// codeForError maps an error to its catalog code. Missing questions become
+// NOT_FOUND, attributes outside the attribute schema INVALID_ATTRIBUTE and
+// tags listed in BLOCKED_TAGS BLOCKED_TAG.
+// Missing required fields, fields invalid for the question type and content
+// filter rejections get their own codes, and duplicate key violations become
+// CONFLICT. Lock contention and exhausted transaction retries become
+// DB_UNAVAILABLE so clients know to retry, and expired deadlines TIMEOUT;
+// everything else is INTERNAL.
+func codeForError(err error) apierror.Code {
+	var apiErr *apierror.Error
+	if errors.As(err, &apiErr) {
+		return apiErr.Code
+	}
+
+	var attributeErr *AttributeError
+	var blockedTagErr *BlockedTagError
+	var rejectedErr *RejectedError
+	var transientErr *TransientError
+	switch {
+	case errors.Is(err, ErrQuestionNotFound), errors.Is(err, ErrTagNotFound):
+		return apierror.NotFound
+	case errors.As(err, &attributeErr):
+		return apierror.InvalidAttribute
+	case errors.As(err, &blockedTagErr):
+		return apierror.BlockedTag
+	case errors.Is(err, ErrMissingLanguage), errors.Is(err, ErrMissingType), errors.Is(err, ErrMissingTask):
+		return apierror.ValidationFailed
+	case errors.Is(err, ErrInvalidFieldForType):
+		return apierror.InvalidFieldForType
+	case errors.As(err, &rejectedErr):
+		return apierror.ContentRejected
+	case errors.As(err, &transientErr):
+		return apierror.DBUnavailable
+	case errors.Is(err, context.DeadlineExceeded):
+		return apierror.Timeout
+	}
+
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		switch mysqlErr.Number {
+		case mysqlErrDuplicateEntry:
+			return apierror.Conflict
+		case mysqlErrDeadlock, mysqlErrLockWaitTimeout:
+			return apierror.DBUnavailable
+		}
+	}
+	return apierror.Internal
+}
+
+// statusForError returns the HTTP status code of the error's catalog code.
+func statusForError(err error) int {
+	return apierror.Status(codeForError(err))
+}
+
+// writeError writes an ErrorResponse with the given catalog code and its
+// HTTP status. Every handler and middleware reports errors through
+// writeError or respondError, never http.Error.
+func writeError(w http.ResponseWriter, code apierror.Code, message string) {
+	respondJSON(w, apierror.Status(code), ErrorResponse{Message: message, Code: string(code)})
+}
+
+// respondError reports err under its catalog code. Errors raised by the API
+// itself carry their own message, see clientMessage; everything else,
+// including driver errors mapped to a client error such as CONFLICT, is
+// reported with the given message so database details do not leak.
+func respondError(w http.ResponseWriter, err error, message string) {
+	respondJSON(w, statusForError(err), errorResponse(err, message))
+}
+
+// errorResponse builds the ErrorResponse respondError sends for err.
+func errorResponse(err error, message string) ErrorResponse {
+	resp := ErrorResponse{Message: message, Code: string(codeForError(err))}
+	if msg, ok := clientMessage(err); ok {
+		resp.Message = msg
+	}
+	var apiErr *apierror.Error
+	if errors.As(err, &apiErr) {
+		resp.Fields = apiErr.Fields
+	}
+	return resp
+}
+
+// clientMessage returns the message of err if it is meant for clients: an
+// *apierror.Error or one of the validation, lookup and content filter errors
+// of this package. It returns false for any other error, whose text may come
+// from the database driver.
+func clientMessage(err error) (string, bool) {
+	var apiErr *apierror.Error
+	var attributeErr *AttributeError
+	var blockedTagErr *BlockedTagError
+	var rejectedErr *RejectedError
+	switch {
+	case errors.As(err, &apiErr),
+		errors.As(err, &attributeErr),
+		errors.As(err, &blockedTagErr),
+		errors.As(err, &rejectedErr),
+		errors.Is(err, ErrMissingLanguage),
+		errors.Is(err, ErrMissingType),
+		errors.Is(err, ErrMissingTask),
+		errors.Is(err, ErrInvalidFieldForType),
+		errors.Is(err, ErrQuestionNotFound),
+		errors.Is(err, ErrTagNotFound):
+		return err.Error(), true
+	}
+	return "", false
+}
+
+// msgpackContentType is the media type clients send in Accept to receive
+// MessagePack instead of JSON.
+const msgpackContentType = "application/msgpack"
+
+// wantsMsgpack reports whether the request's Accept header asks for
+// MessagePack. JSON stays the default for every other Accept value.
+func wantsMsgpack(r *http.Request) bool {
+	for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, _ := strings.Cut(accepted, ";")
+		if strings.TrimSpace(mediaType) == msgpackContentType {
+			return true
+		}
+	}
+	return false
+}
+
+// respondNegotiated writes v as MessagePack when the client accepts it and
+// as JSON otherwise. MessagePack uses the same field names as the JSON
+// encoding, so clients can switch formats without remapping fields.
+func respondNegotiated(w http.ResponseWriter, r *http.Request, status int, v interface{}) {
+	w.Header().Add("Vary", "Accept")
+	if !wantsMsgpack(r) {
+		respondJSON(w, status, v)
+		return
+	}
+
+	buf := getBuffer()
+	defer putBuffer(buf)
+
+	enc := msgpack.NewEncoder(buf)
+	enc.SetCustomStructTag("json")
+	enc.UseCompactInts(true)
+	if err := enc.Encode(v); err != nil {
+		log.Printf("Failed to encode response to MessagePack: %v", err)
+		writeError(w, apierror.Internal, "Failed to encode response to MessagePack")
+		return
+	}
+
+	w.Header().Set("Content-Type", msgpackContentType)
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	w.WriteHeader(status)
+	w.Write(buf.Bytes())
+}
@@ -0,0 +1,359 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/2Friendly4You/TruthOrDare/apierror"
+	"github.com/go-sql-driver/mysql"
+)
+
+func TestRespondJSON(t *testing.T) {
+	tests := []struct {
+		name              string
+		value             interface{}
+		status            int
+		wantStatus        int
+		wantContentLength bool
+	}{
+		{"small payload", map[string]string{"status": "ok"}, http.StatusCreated, http.StatusCreated, true},
+		{"large payload", strings.Repeat("x", contentLengthThreshold), http.StatusOK, http.StatusOK, false},
+		{"encoding error", math.NaN(), http.StatusOK, http.StatusInternalServerError, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			respondJSON(w, tt.status, tt.value)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if ct := w.Header().Get("Content-Type"); ct != "application/json; charset=utf-8" {
+				t.Errorf("Content-Type = %q", ct)
+			}
+			contentLength := w.Header().Get("Content-Length")
+			if (contentLength != "") != tt.wantContentLength {
+				t.Errorf("Content-Length = %q, want set = %v", contentLength, tt.wantContentLength)
+			}
+			if contentLength != "" && contentLength != strconv.Itoa(w.Body.Len()) {
+				t.Errorf("Content-Length = %s, body has %d bytes", contentLength, w.Body.Len())
+			}
+			if !json.Valid(w.Body.Bytes()) {
+				t.Errorf("body is not valid JSON: %.100s", w.Body)
+			}
+		})
+	}
+}
+
+func TestRespondJSONEncodingErrorBody(t *testing.T) {
+	w := httptest.NewRecorder()
+	respondJSON(w, http.StatusOK, math.Inf(1))
+
+	var resp ErrorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Code != string(apierror.Internal) {
+		t.Errorf("code = %q, want %q", resp.Code, apierror.Internal)
+	}
+}
+
+// benchmarkQuestions returns n questions shaped like catalog entries.
+func benchmarkQuestions(n int) []Question {
+	questions := make([]Question, n)
+	for i := range questions {
+		questions[i] = Question{
+			ID:       i + 1,
+			Language: "en",
+			Type:     "truth",
+			Task:     fmt.Sprintf("What is the most embarrassing thing that happened to you at party number %d?", i),
+			Tags:     []string{"funny", "party", "social"},
+		}
+	}
+	return questions
+}
+
+func BenchmarkRespondJSON(b *testing.B) {
+	questions := benchmarkQuestions(1000)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		respondJSON(discardResponseWriter{header: http.Header{}}, http.StatusOK, questions)
+	}
+}
+
+// discardResponseWriter is an http.ResponseWriter that drops the body, so
+// benchmarks measure encoding rather than a recorder's buffer growth.
+type discardResponseWriter struct {
+	header http.Header
+}
+
+func (w discardResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w discardResponseWriter) Write(p []byte) (int, error) {
+	return io.Discard.Write(p)
+}
+
+func (w discardResponseWriter) WriteHeader(int) {}
+
+func TestCodeForError(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantCode   apierror.Code
+		wantStatus int
+	}{
+		{"api error", apierror.New(apierror.InvalidTag, "bad tag"), apierror.InvalidTag, http.StatusBadRequest},
+		{"wrapped api error", fmt.Errorf("parse: %w", apierror.New(apierror.PayloadTooLarge, "too big")), apierror.PayloadTooLarge, http.StatusRequestEntityTooLarge},
+		{"question not found", fmt.Errorf("get: %w", ErrQuestionNotFound), apierror.NotFound, http.StatusNotFound},
+		{"tag not found", ErrTagNotFound, apierror.NotFound, http.StatusNotFound},
+		{"attribute", &AttributeError{Key: "players", Reason: "unknown"}, apierror.InvalidAttribute, http.StatusBadRequest},
+		{"blocked tag", &BlockedTagError{Tag: "slur"}, apierror.BlockedTag, http.StatusBadRequest},
+		{"missing language", ErrMissingLanguage, apierror.ValidationFailed, http.StatusBadRequest},
+		{"missing type", ErrMissingType, apierror.ValidationFailed, http.StatusBadRequest},
+		{"missing task", ErrMissingTask, apierror.ValidationFailed, http.StatusBadRequest},
+		{"field for type", ErrInvalidFieldForType, apierror.InvalidFieldForType, http.StatusUnprocessableEntity},
+		{"rejected", &RejectedError{Filter: "profanity", Reason: "swearing"}, apierror.ContentRejected, http.StatusUnprocessableEntity},
+		{"transient", &TransientError{Err: errors.New("deadlock")}, apierror.DBUnavailable, http.StatusServiceUnavailable},
+		{"deadline", fmt.Errorf("query: %w", context.DeadlineExceeded), apierror.Timeout, http.StatusGatewayTimeout},
+		{"duplicate entry", fmt.Errorf("insert: %w", &mysql.MySQLError{Number: mysqlErrDuplicateEntry}), apierror.Conflict, http.StatusConflict},
+		{"deadlock", &mysql.MySQLError{Number: mysqlErrDeadlock}, apierror.DBUnavailable, http.StatusServiceUnavailable},
+		{"lock wait timeout", &mysql.MySQLError{Number: mysqlErrLockWaitTimeout}, apierror.DBUnavailable, http.StatusServiceUnavailable},
+		{"other mysql error", &mysql.MySQLError{Number: 1146}, apierror.Internal, http.StatusInternalServerError},
+		{"plain error", errors.New("boom"), apierror.Internal, http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := codeForError(tt.err); got != tt.wantCode {
+				t.Errorf("codeForError() = %s, want %s", got, tt.wantCode)
+			}
+			if got := statusForError(tt.err); got != tt.wantStatus {
+				t.Errorf("statusForError() = %d, want %d", got, tt.wantStatus)
+			}
+			if entry, ok := catalogEntry(codeForError(tt.err)); !ok || entry.Status != tt.wantStatus {
+				t.Errorf("catalog entry for %s = %+v, %v; want status %d", codeForError(tt.err), entry, ok, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestRespondError(t *testing.T) {
+	tests := []struct {
+		name        string
+		err         error
+		wantMessage string
+		wantFields  int
+	}{
+		{"api error", apierror.New(apierror.InvalidTag, "bad tag"), "bad tag", 0},
+		{"validation error", apierror.Validation(apierror.FieldError{Field: "task", Message: "too long"}), "Validation failed", 1},
+		{"missing field", fmt.Errorf("insert: %w", ErrMissingTask), "insert: question task is required", 0},
+		{"field for type", ErrInvalidFieldForType, ErrInvalidFieldForType.Error(), 0},
+		{"not found", ErrQuestionNotFound, "question not found", 0},
+		{"blocked tag", &BlockedTagError{Tag: "slur"}, `tag "slur" is not allowed`, 0},
+		{"rejected", &RejectedError{Filter: "banned_words", Reason: "contains a banned word"}, "rejected by banned_words filter: contains a banned word", 0},
+		{"duplicate entry", fmt.Errorf("insert: %w", &mysql.MySQLError{Number: mysqlErrDuplicateEntry, Message: "Duplicate entry 'x' for key 'questions.uq_task'"}), "Failed to save", 0},
+		{"deadlock", &mysql.MySQLError{Number: mysqlErrDeadlock, Message: "Deadlock found"}, "Failed to save", 0},
+		{"transient", &TransientError{Err: errors.New("lock wait timeout")}, "Failed to save", 0},
+		{"plain error", errors.New("dial tcp 10.0.0.5:3306: refused"), "Failed to save", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			respondError(w, tt.err, "Failed to save")
+
+			code := codeForError(tt.err)
+			if w.Code != apierror.Status(code) {
+				t.Errorf("status = %d, want %d", w.Code, apierror.Status(code))
+			}
+			var resp ErrorResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Code != string(code) {
+				t.Errorf("code = %s, want %s", resp.Code, code)
+			}
+			if resp.Message != tt.wantMessage {
+				t.Errorf("message = %q, want %q", resp.Message, tt.wantMessage)
+			}
+			if len(resp.Fields) != tt.wantFields {
+				t.Errorf("fields = %v, want %d", resp.Fields, tt.wantFields)
+			}
+		})
+	}
+}
+
+// catalogEntry looks code up in the published error catalog.
+func catalogEntry(code apierror.Code) (apierror.Entry, bool) {
+	for _, entry := range apierror.Catalog() {
+		if entry.Code == code {
+			return entry, true
+		}
+	}
+	return apierror.Entry{}, false
+}
+
+func TestErrorCatalog(t *testing.T) {
+	seen := map[apierror.Code]bool{}
+	for _, entry := range apierror.Catalog() {
+		if seen[entry.Code] {
+			t.Errorf("%s is listed twice", entry.Code)
+		}
+		seen[entry.Code] = true
+		if entry.Status < 400 || entry.Status > 599 || http.StatusText(entry.Status) == "" {
+			t.Errorf("%s has status %d, want a 4xx or 5xx status", entry.Code, entry.Status)
+		}
+		if entry.Description == "" {
+			t.Errorf("%s has no description", entry.Code)
+		}
+		if got := apierror.Status(entry.Code); got != entry.Status {
+			t.Errorf("Status(%s) = %d, catalog says %d", entry.Code, got, entry.Status)
+		}
+	}
+}
+
+// successStatuses are the http.Status constants handlers may pass directly.
+// Error statuses must come from the catalog.
+var successStatuses = map[string]bool{
+	"StatusOK":                true,
+	"StatusCreated":           true,
+	"StatusAccepted":          true,
+	"StatusNoContent":         true,
+	"StatusPartialContent":    true,
+	"StatusNotModified":       true,
+	"StatusMovedPermanently":  true,
+	"StatusFound":             true,
+	"StatusSeeOther":          true,
+	"StatusTemporaryRedirect": true,
+	"StatusPermanentRedirect": true,
+}
+
+// TestHandlersUseErrorCatalog scans the package source for responses that
+// bypass the error catalog: http.Error calls, and respondJSON,
+// respondNegotiated or WriteHeader calls whose status is neither a success
+// constant nor derived from the catalog through apierror.Status,
+// statusForError or an *apierror.Error's Status method. A status held in a
+// variable is checked at every assignment; a status parameter is left to the
+// callers, which are checked in turn.
+func TestHandlersUseErrorCatalog(t *testing.T) {
+	files, err := filepath.Glob("*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fset := token.NewFileSet()
+	for _, name := range files {
+		if strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		file, err := parser.ParseFile(fset, name, nil, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, decl := range file.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Body == nil {
+				continue
+			}
+			ast.Inspect(fn.Body, func(n ast.Node) bool {
+				call, ok := n.(*ast.CallExpr)
+				if !ok {
+					return true
+				}
+				var status ast.Expr
+				switch callee := call.Fun.(type) {
+				case *ast.Ident:
+					switch {
+					case callee.Name == "respondJSON" && len(call.Args) > 1:
+						status = call.Args[1]
+					case callee.Name == "respondNegotiated" && len(call.Args) > 2:
+						status = call.Args[2]
+					}
+				case *ast.SelectorExpr:
+					if isPackageSelector(callee, "http", "Error") {
+						t.Errorf("%s: http.Error bypasses the error catalog; use writeError", fset.Position(call.Pos()))
+						return true
+					}
+					if callee.Sel.Name == "WriteHeader" && len(call.Args) == 1 {
+						status = call.Args[0]
+					}
+				}
+				if status != nil && !catalogStatus(fn, status) {
+					t.Errorf("%s: status %s does not come from the error catalog", fset.Position(call.Pos()), exprString(fset, status))
+				}
+				return true
+			})
+		}
+	}
+}
+
+// catalogStatus reports whether status, an argument in fn, is a success
+// constant or derived from the error catalog.
+func catalogStatus(fn *ast.FuncDecl, status ast.Expr) bool {
+	switch e := status.(type) {
+	case *ast.SelectorExpr:
+		return isPackageSelector(e, "http", e.Sel.Name) && successStatuses[e.Sel.Name]
+	case *ast.CallExpr:
+		switch callee := e.Fun.(type) {
+		case *ast.Ident:
+			return callee.Name == "statusForError"
+		case *ast.SelectorExpr:
+			// apierror.Status(code) or apiErr.Status()
+			return callee.Sel.Name == "Status"
+		}
+	case *ast.Ident:
+		for _, field := range fn.Type.Params.List {
+			for _, param := range field.Names {
+				if param.Name == e.Name {
+					return true
+				}
+			}
+		}
+		assigned := false
+		ok := true
+		ast.Inspect(fn.Body, func(n ast.Node) bool {
+			assign, isAssign := n.(*ast.AssignStmt)
+			if !isAssign || len(assign.Lhs) != len(assign.Rhs) {
+				return true
+			}
+			for i, lhs := range assign.Lhs {
+				if id, isIdent := lhs.(*ast.Ident); isIdent && id.Name == e.Name {
+					assigned = true
+					if _, isIdent := assign.Rhs[i].(*ast.Ident); isIdent || !catalogStatus(fn, assign.Rhs[i]) {
+						ok = false
+					}
+				}
+			}
+			return true
+		})
+		return assigned && ok
+	}
+	return false
+}
+
+// isPackageSelector reports whether e is pkg.name.
+func isPackageSelector(e *ast.SelectorExpr, pkg, name string) bool {
+	id, ok := e.X.(*ast.Ident)
+	return ok && id.Name == pkg && e.Sel.Name == name
+}
+
+func exprString(fset *token.FileSet, e ast.Expr) string {
+	var buf strings.Builder
+	printer.Fprint(&buf, fset, e)
+	return buf.String()
+}
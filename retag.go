@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/2Friendly4You/TruthOrDare/apierror"
+)
+
+const (
+	// retagBatchSize is the number of questions read, and in apply mode
+	// written, per transaction.
+	retagBatchSize = 500
+
+	// maxRetagRules and maxRetagPatternLength bound the work a single
+	// request can ask for.
+	maxRetagRules         = 50
+	maxRetagPatternLength = 200
+
+	// retagSampleSize is the number of sample matches reported per rule.
+	retagSampleSize = 5
+)
+
+// RetagRule adds tags to questions whose task matches a pattern
+// @Description A content rule applied by the bulk retag endpoint
+type RetagRule struct {
+	// Substring (case-insensitive) or, with regex, an RE2 regular expression
+	// @example "ex-(boyfriend|girlfriend|partner)"
+	Pattern string `json:"pattern"`
+
+	// Treat pattern as a regular expression
+	// @example true
+	Regex bool `json:"regex,omitempty"`
+
+	// Only match questions in this language; empty matches all languages
+	// @example "en"
+	Language string `json:"language,omitempty"`
+
+	// Tags to add to matching questions
+	// @example ["relationships"]
+	AddTags []string `json:"addTags"`
+
+	matcher func(task string) bool
+}
+
+// RetagRequest is the body of POST /admin/retag
+// @Description A rule set to apply to the question catalog
+type RetagRequest struct {
+	// Rules evaluated against every question
+	Rules []RetagRule `json:"rules"`
+
+	// Only report matches without changing any question
+	// @example true
+	DryRun bool `json:"dryRun"`
+
+	// Skip questions with an ID up to and including this value, used to
+	// resume an interrupted run from its last reported cursor
+	// @example 0
+	ResumeAfter int64 `json:"resumeAfter,omitempty"`
+}
+
+// RetagRuleReport summarizes the matches of one rule
+// @Description Match count and sample matches of a retag rule
+type RetagRuleReport struct {
+	// Pattern of the rule
+	Pattern string `json:"pattern"`
+
+	// Number of matching questions
+	// @example 42
+	Matches int `json:"matches"`
+
+	// Up to five matching questions
+	Samples []Question `json:"samples"`
+}
+
+// RetagResponse reports the outcome of a retag run
+// @Description Per-rule results of a bulk retag run
+type RetagResponse struct {
+	// Whether the run only reported matches
+	DryRun bool `json:"dryRun"`
+
+	// One report per rule, in request order
+	Rules []RetagRuleReport `json:"rules"`
+
+	// Number of questions that gained at least one tag (apply mode only)
+	// @example 40
+	Updated int `json:"updated"`
+
+	// ID of the last question processed; pass as resumeAfter to continue
+	// an interrupted run
+	// @example 1500
+	LastProcessedID int64 `json:"lastProcessedId"`
+
+	// Whether the whole catalog was processed
+	Completed bool `json:"completed"`
+
+	// Error code from the catalog when the run was interrupted
+	// @example "DB_UNAVAILABLE"
+	Code string `json:"code,omitempty"`
+
+	// Why the run was interrupted
+	Message string `json:"message,omitempty"`
+}
+
+// compile validates the rule and prepares its matcher. Regular expressions
+// use Go's RE2 engine, which runs in time linear in the input, so patterns
+// cannot backtrack catastrophically; their length is still capped.
+func (rule *RetagRule) compile() error {
+	if rule.Pattern == "" {
+		return fmt.Errorf("pattern is required")
+	}
+	if len(rule.Pattern) > maxRetagPatternLength {
+		return fmt.Errorf("pattern %q is longer than %d characters", rule.Pattern, maxRetagPatternLength)
+	}
+	if len(rule.AddTags) == 0 {
+		return fmt.Errorf("pattern %q: addTags must not be empty", rule.Pattern)
+	}
+	rule.Language = normalizeLanguage(rule.Language)
+	rule.AddTags = uniqueStrings(rule.AddTags)
+	if err := checkBlockedTags(rule.AddTags); err != nil {
+		return fmt.Errorf("pattern %q: %w", rule.Pattern, err)
+	}
+
+	if rule.Regex {
+		re, err := regexp.Compile("(?i)" + rule.Pattern)
+		if err != nil {
+			return fmt.Errorf("pattern %q: %v", rule.Pattern, err)
+		}
+		rule.matcher = re.MatchString
+		return nil
+	}
+
+	needle := strings.ToLower(rule.Pattern)
+	rule.matcher = func(task string) bool {
+		return strings.Contains(strings.ToLower(task), needle)
+	}
+	return nil
+}
+
+// runRetag evaluates rules against every question after resumeAfter, batch
+// by batch. Outside dry-run mode each batch's tag additions are committed in
+// their own transaction, so an interrupted run keeps the batches it finished
+// and can resume from the reported LastProcessedID. Adding a tag twice is a
+// no-op, so rerunning overlapping batches is safe.
+func runRetag(ctx context.Context, d *Database, req RetagRequest) (RetagResponse, error) {
+	resp := RetagResponse{DryRun: req.DryRun, Rules: make([]RetagRuleReport, len(req.Rules)), LastProcessedID: req.ResumeAfter}
+	for i, rule := range req.Rules {
+		resp.Rules[i] = RetagRuleReport{Pattern: rule.Pattern, Samples: []Question{}}
+	}
+
+	for {
+		batch, err := d.GetQuestionBatch(ctx, resp.LastProcessedID, retagBatchSize)
+		if err != nil {
+			return resp, err
+		}
+		if len(batch) == 0 {
+			resp.Completed = true
+			return resp, nil
+		}
+
+		additions := map[int64][]string{}
+		for _, q := range batch {
+			for i, rule := range req.Rules {
+				if rule.Language != "" && rule.Language != q.Language {
+					continue
+				}
+				if !rule.matcher(q.Task) {
+					continue
+				}
+				report := &resp.Rules[i]
+				report.Matches++
+				if len(report.Samples) < retagSampleSize {
+					report.Samples = append(report.Samples, q)
+				}
+				additions[int64(q.ID)] = append(additions[int64(q.ID)], rule.AddTags...)
+			}
+		}
+
+		if !req.DryRun && len(additions) > 0 {
+			updated, err := d.AddQuestionTags(ctx, additions)
+			if err != nil {
+				return resp, err
+			}
+			resp.Updated += updated
+		}
+		resp.LastProcessedID = int64(batch[len(batch)-1].ID)
+	}
+}
+
+// @Summary Bulk retag questions
+// @Description Apply content rules to the question catalog, adding tags to every question whose task matches. With dryRun only match counts and samples are reported. Tags are added in batched transactions and recorded as updates in the change feed. If a run fails partway, resend it with resumeAfter set to the reported lastProcessedId.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param rules body RetagRequest true "Rule set"
+// @Success 200 {object} RetagResponse "Run completed"
+// @Failure 400 {object} ErrorResponse "Invalid rule set"
+// @Failure 401 {object} ErrorResponse "Missing or invalid API key"
+// @Failure 413 {object} ErrorResponse "Request body too large"
+// @Failure 500 {object} RetagResponse "Run interrupted; resume from lastProcessedId"
+// @Router /admin/retag [post]
+func retagQuestions(w http.ResponseWriter, r *http.Request) {
+	var req RetagRequest
+	if err := decodeJSONBody(w, r, &req); err != nil {
+		writeBodyError(w, err)
+		return
+	}
+	if len(req.Rules) == 0 || len(req.Rules) > maxRetagRules {
+		writeError(w, apierror.InvalidBody, fmt.Sprintf("between 1 and %d rules must be given", maxRetagRules))
+		return
+	}
+	for i := range req.Rules {
+		if err := req.Rules[i].compile(); err != nil {
+			code := apierror.InvalidBody
+			var blockedTagErr *BlockedTagError
+			if errors.As(err, &blockedTagErr) {
+				code = apierror.BlockedTag
+			}
+			writeError(w, code, err.Error())
+			return
+		}
+	}
+
+	resp, err := runRetag(r.Context(), db, req)
+	if err != nil {
+		log.Printf("Retag interrupted after question %d: %v", resp.LastProcessedID, err)
+		code := codeForError(err)
+		resp.Code = string(code)
+		resp.Message = "Retag interrupted; resume with resumeAfter set to lastProcessedId"
+		respondJSON(w, apierror.Status(code), resp)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// MySQL server error numbers that need special handling.
+const (
+	mysqlErrDuplicateEntry  = 1062
+	mysqlErrLockWaitTimeout = 1205
+	mysqlErrDeadlock        = 1213
+)
+
+// Retry policy for write transactions.
+const (
+	maxTxAttempts  = 3
+	txRetryBackoff = 100 * time.Millisecond
+)
+
+// TransientError wraps a database error that is safe to retry because the
+// transaction it interrupted was not committed. The HTTP layer maps it to 503.
+type TransientError struct {
+	Err error
+}
+
+func (e *TransientError) Error() string {
+	return fmt.Sprintf("transient database error, nothing was committed: %v", e.Err)
+}
+
+func (e *TransientError) Unwrap() error {
+	return e.Err
+}
+
+// isRetryable reports whether err aborted a transaction in a way that makes
+// re-running it from the start safe: the connection was lost before commit,
+// or the server rolled the transaction back because of a deadlock or lock
+// wait timeout.
+func isRetryable(err error) bool {
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, mysql.ErrInvalidConn) {
+		return true
+	}
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return mysqlErr.Number == mysqlErrDeadlock || mysqlErr.Number == mysqlErrLockWaitTimeout
+	}
+	return false
+}
+
+// withTransaction runs fn inside a transaction and commits it. If fn or the
+// commit fails with a retryable error the whole transaction is re-run, up to
+// maxTxAttempts times with exponential backoff. When retries are exhausted
+// the error is returned as a *TransientError.
+//
+// A lost connection during COMMIT is not retried: the server may or may not
+// have applied the transaction, so re-running it could duplicate data.
+func (d *Database) withTransaction(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	var err error
+	for attempt := 1; attempt <= maxTxAttempts; attempt++ {
+		if attempt > 1 {
+			select {
+			case <-time.After(txRetryBackoff << (attempt - 2)):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		err = d.runTransaction(ctx, fn)
+		if err == nil || !isRetryable(err) {
+			return err
+		}
+	}
+	return &TransientError{Err: err}
+}
+
+func (d *Database) runTransaction(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := d.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		var mysqlErr *mysql.MySQLError
+		if errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlErrDeadlock {
+			return fmt.Errorf("failed to commit transaction: %w", err)
+		}
+		return fmt.Errorf("failed to commit transaction, outcome unknown: %v", err)
+	}
+	return nil
+}
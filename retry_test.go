@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+func TestWithTransaction(t *testing.T) {
+	deadlock := &mysql.MySQLError{Number: mysqlErrDeadlock, Message: "Deadlock found"}
+
+	tests := []struct {
+		name          string
+		beginErr      error
+		commitErr     error
+		fnErr         error
+		wantErr       string
+		wantTransient bool
+		wantCalls     int
+		wantCommits   int
+		wantRollbacks int
+	}{
+		{name: "commits", wantCalls: 1, wantCommits: 1},
+		{name: "begin fails", beginErr: errors.New("too many connections"), wantErr: "failed to begin transaction"},
+		{name: "fn fails", fnErr: errors.New("bad row"), wantErr: "bad row", wantCalls: 1, wantRollbacks: 1},
+		{name: "lost commit is not retried", commitErr: errors.New("connection reset"), wantErr: "outcome unknown", wantCalls: 1, wantCommits: 1},
+		{name: "deadlock on commit is retried", commitErr: deadlock, wantErr: "nothing was committed", wantTransient: true, wantCalls: maxTxAttempts, wantCommits: maxTxAttempts},
+		{name: "deadlock in fn is retried", fnErr: deadlock, wantErr: "nothing was committed", wantTransient: true, wantCalls: maxTxAttempts, wantRollbacks: maxTxAttempts},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := NewMockDB(t)
+			mock.BeginErr = tt.beginErr
+			mock.CommitErr = tt.commitErr
+			d := &Database{db: mock}
+
+			calls := 0
+			err := d.withTransaction(context.Background(), func(tx *sql.Tx) error {
+				calls++
+				if _, err := tx.ExecContext(context.Background(), "UPDATE questions SET task = ? WHERE id = ?", "x", 1); err != nil {
+					return err
+				}
+				return tt.fnErr
+			})
+
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("withTransaction() error = %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("withTransaction() error = %v, want %q", err, tt.wantErr)
+			}
+			var transientErr *TransientError
+			if got := errors.As(err, &transientErr); got != tt.wantTransient {
+				t.Errorf("transient = %v, want %v", got, tt.wantTransient)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("fn called %d times, want %d", calls, tt.wantCalls)
+			}
+			if got := mock.Commits(); got != tt.wantCommits {
+				t.Errorf("commits = %d, want %d", got, tt.wantCommits)
+			}
+			if got := mock.Rollbacks(); got != tt.wantRollbacks {
+				t.Errorf("rollbacks = %d, want %d", got, tt.wantRollbacks)
+			}
+		})
+	}
+}
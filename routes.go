@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/2Friendly4You/TruthOrDare/apierror"
+	httpSwagger "github.com/swaggo/http-swagger"
+)
+
+// Middleware wraps a handler with additional behavior.
+type Middleware func(http.HandlerFunc) http.HandlerFunc
+
+// Route binds a handler to a method and a ServeMux pattern. Middlewares are
+// applied to this route only, the first one outermost. An empty Method
+// matches every method.
+type Route struct {
+	Method      string
+	Pattern     string
+	Handler     http.HandlerFunc
+	Middlewares []Middleware
+}
+
+var (
+	// publicAccessLog is used for public read routes, which are frequent
+	// and only logged when LOG_LEVEL=debug.
+	publicAccessLog = AccessLogMiddleware(slog.LevelDebug, false)
+
+	// adminAccessLog is used for routes behind the API key.
+	adminAccessLog = AccessLogMiddleware(slog.LevelInfo, false)
+
+	// writeAccessLog is used for routes that change data and records a hash
+	// of the request body.
+	writeAccessLog = AccessLogMiddleware(slog.LevelInfo, true)
+)
+
+// apiRoutes returns every route served by the API.
+func apiRoutes() []Route {
+	public := []Middleware{publicAccessLog, rateLimit, requireDB}
+	// Question writes need an API key; games are created by players and
+	// only need the body hash.
+	write := []Middleware{writeAccessLog, requireAPIKey, requireDB}
+	game := []Middleware{writeAccessLog, requireDB}
+	admin := []Middleware{adminAccessLog, requireAPIKey, requireDB}
+	// static routes never touch the database and keep working while a
+	// LAZY_DB_INIT startup is still connecting.
+	static := []Middleware{publicAccessLog}
+
+	routes := []Route{
+		{http.MethodGet, "/swagger/", httpSwagger.WrapHandler, nil},
+
+		{http.MethodGet, "/api/questions", getQuestions, public},
+		{http.MethodPost, "/api/questions", createQuestion, write},
+		{http.MethodPost, "/api/questions/bulk", importQuestions, write},
+		{http.MethodPost, "/api/questions/import-url", importQuestionsFromURL, admin},
+		{http.MethodGet, "/api/questions/random", getRandomQuestions, public},
+		{http.MethodGet, "/api/questions/", getQuestionByID, public},
+		{http.MethodPut, "/api/questions/", updateQuestion, write},
+		{http.MethodDelete, "/api/questions/", deleteQuestion, write},
+		{http.MethodGet, "/api/questions/share-link", getShareLink, public},
+		{http.MethodGet, "/api/questions/new", getNewQuestions, public},
+		{http.MethodPost, "/api/questions/common-tags", getCommonTags, public},
+		{http.MethodGet, "/api/questions/export", exportQuestions, public},
+		{http.MethodGet, "/api/export/cards", exportCards, public},
+		{http.MethodGet, "/api/tags", getTags, public},
+		{http.MethodGet, "/api/changes", getChanges, public},
+		{http.MethodGet, "/api/tags/export", exportTagMetadata, public},
+		{http.MethodPost, "/api/tags/import", importTagMetadata, admin},
+		{http.MethodPost, "/api/tags/auto-assign", autoAssignTag, admin},
+		{http.MethodGet, "/api/i18n/", getI18nBundle, public},
+		{http.MethodGet, "/api/admin/tag-translations", listTagTranslations, admin},
+		{http.MethodPut, "/api/admin/tag-translations", putTagTranslation, admin},
+		{http.MethodDelete, "/api/admin/tag-translations", deleteTagTranslation, admin},
+		{http.MethodPost, "/api/admin/export-s3", exportQuestionsToS3, admin},
+		{http.MethodPost, "/api/admin/retag", retagQuestions, admin},
+		{http.MethodPost, "/api/admin/search-index/rebuild", rebuildSearchIndex, admin},
+		{http.MethodGet, "/api/capabilities", getCapabilities, public},
+		{http.MethodGet, "/api/errors", getErrorCatalog, static},
+		{http.MethodGet, "/api/health", getHealth, static},
+		{http.MethodGet, "/api/health/live", getHealthLive, static},
+		{http.MethodGet, "/api/health/ready", getHealthReady, static},
+		{http.MethodGet, "/api/stats/lengths", getLengthHistogram, public},
+		{http.MethodGet, "/api/config/rate-limits", getRateLimitConfig, admin},
+		{http.MethodGet, "/api/config/features", getFeatureConfig, admin},
+		{http.MethodPost, "/api/games", createGame, game},
+		{http.MethodGet, "/api/games/", getGame, public},
+		{http.MethodGet, "/api/presets/", getPresetDeck, public},
+
+		// redirect /api to /swagger
+		{"", "/api", func(w http.ResponseWriter, r *http.Request) {
+			http.Redirect(w, r, "/swagger/index.html", http.StatusSeeOther)
+		}, nil},
+
+		// unknown paths under /api/ get a JSON NOT_FOUND instead of the
+		// plain-text ServeMux 404
+		{"", "/api/", notFound, nil},
+	}
+
+	if snapshots != nil {
+		routes = append(routes,
+			Route{http.MethodGet, "/api/admin/snapshots", listSnapshots, admin},
+			Route{http.MethodPost, "/api/admin/snapshots", takeSnapshot, admin},
+		)
+	}
+
+	if upstreamSync != nil {
+		routes = append(routes,
+			Route{http.MethodGet, "/api/admin/sync", getSyncStatus, admin},
+		)
+	}
+
+	if debugEnabled() {
+		routes = append(routes,
+			Route{http.MethodGet, "/api/debug/explain", explainQuestions, admin},
+			Route{http.MethodGet, "/api/config/cors", getCORSConfig, admin},
+		)
+	}
+	return routes
+}
+
+// buildMux registers routes on a new ServeMux. Routes sharing a pattern are
+// dispatched by method; other methods get a METHOD_NOT_ALLOWED error with an
+// Allow header listing the supported ones.
+func buildMux(routes []Route) *http.ServeMux {
+	byPattern := map[string]map[string]http.HandlerFunc{}
+	var patterns []string
+	for _, route := range routes {
+		handler := route.Handler
+		for i := len(route.Middlewares) - 1; i >= 0; i-- {
+			handler = route.Middlewares[i](handler)
+		}
+		if byPattern[route.Pattern] == nil {
+			byPattern[route.Pattern] = map[string]http.HandlerFunc{}
+			patterns = append(patterns, route.Pattern)
+		}
+		byPattern[route.Pattern][route.Method] = handler
+	}
+
+	mux := http.NewServeMux()
+	for _, pattern := range patterns {
+		methods := byPattern[pattern]
+		allowed := make([]string, 0, len(methods))
+		for method := range methods {
+			allowed = append(allowed, method)
+		}
+		sort.Strings(allowed)
+		allow := strings.Join(allowed, ", ")
+
+		mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+			if handler, ok := methods[r.Method]; ok {
+				handler(w, r)
+				return
+			}
+			if handler, ok := methods[""]; ok {
+				handler(w, r)
+				return
+			}
+			w.Header().Set("Allow", allow)
+			writeError(w, apierror.MethodNotAllowed, "Method not allowed")
+		})
+	}
+	return mux
+}
+
+// notFound reports a NOT_FOUND error for paths no route matches.
+func notFound(w http.ResponseWriter, r *http.Request) {
+	writeError(w, apierror.NotFound, fmt.Sprintf("No endpoint at %s", r.URL.Path))
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/2Friendly4You/TruthOrDare/apierror"
+)
+
+func TestBuildMux(t *testing.T) {
+	answer := func(body string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(body))
+		}
+	}
+	mux := buildMux([]Route{
+		{http.MethodGet, "/items", answer("list"), nil},
+		{http.MethodPost, "/items", answer("create"), nil},
+		{http.MethodDelete, "/items/", answer("delete"), nil},
+		{http.MethodGet, "/items/", answer("get"), nil},
+		{"", "/any", answer("any"), nil},
+	})
+
+	tests := []struct {
+		method    string
+		path      string
+		wantBody  string
+		wantAllow string
+	}{
+		{http.MethodGet, "/items", "list", ""},
+		{http.MethodPost, "/items", "create", ""},
+		{http.MethodGet, "/items/7", "get", ""},
+		{http.MethodDelete, "/items/7", "delete", ""},
+		{http.MethodPatch, "/any", "any", ""},
+		{http.MethodPut, "/items", "", "GET, POST"},
+		{http.MethodDelete, "/items", "", "GET, POST"},
+		{http.MethodPost, "/items/7", "", "DELETE, GET"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+
+			if tt.wantAllow == "" {
+				if w.Code != http.StatusOK || w.Body.String() != tt.wantBody {
+					t.Errorf("got %d %q, want 200 %q", w.Code, w.Body, tt.wantBody)
+				}
+				return
+			}
+			if w.Code != http.StatusMethodNotAllowed {
+				t.Fatalf("status = %d, want 405", w.Code)
+			}
+			if got := w.Header().Get("Allow"); got != tt.wantAllow {
+				t.Errorf("Allow = %q, want %q", got, tt.wantAllow)
+			}
+			var resp ErrorResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Code != string(apierror.MethodNotAllowed) {
+				t.Errorf("code = %s, want %s", resp.Code, apierror.MethodNotAllowed)
+			}
+		})
+	}
+}
+
+func TestBuildMuxMiddlewareOrder(t *testing.T) {
+	var calls []string
+	trace := func(name string) Middleware {
+		return func(next http.HandlerFunc) http.HandlerFunc {
+			return func(w http.ResponseWriter, r *http.Request) {
+				calls = append(calls, name)
+				next(w, r)
+			}
+		}
+	}
+	handler := func(w http.ResponseWriter, r *http.Request) { calls = append(calls, "handler") }
+	mux := buildMux([]Route{{http.MethodGet, "/items", handler, []Middleware{trace("outer"), trace("inner")}}})
+
+	mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/items", nil))
+
+	if got := fmt.Sprint(calls); got != "[outer inner handler]" {
+		t.Errorf("calls = %s, want [outer inner handler]", got)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// newS3Client returns an S3 client configured from the standard AWS
+// environment and shared config. S3_ENDPOINT may point at an S3-compatible
+// service.
+func newS3Client(ctx context.Context) (*s3.Client, error) {
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+
+	return s3.NewFromConfig(cfg, func(o *s3.Options) {
+		if endpoint := os.Getenv("S3_ENDPOINT"); endpoint != "" {
+			o.BaseEndpoint = aws.String(endpoint)
+			o.UsePathStyle = true
+		}
+	}), nil
+}
+
+// ExportToS3 streams the questions matching filters as gzip-compressed JSON
+// lines into the S3 object bucket/key. The upload is multipart and fed
+// through a pipe, so the export is never materialized in memory.
+//
+// Credentials and region come from the standard AWS environment and shared
+// config. S3_ENDPOINT may point at an S3-compatible service.
+func (d *Database) ExportToS3(ctx context.Context, bucket, key string, filters FilterSet) error {
+	client, err := newS3Client(ctx)
+	if err != nil {
+		return err
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		gz := gzip.NewWriter(pw)
+		err := d.ExportToWriter(ctx, gz, filters)
+		if closeErr := gz.Close(); err == nil {
+			err = closeErr
+		}
+		pw.CloseWithError(err)
+	}()
+
+	_, err = manager.NewUploader(client).Upload(ctx, &s3.PutObjectInput{
+		Bucket:          aws.String(bucket),
+		Key:             aws.String(key),
+		Body:            pr,
+		ContentType:     aws.String("application/x-ndjson"),
+		ContentEncoding: aws.String("gzip"),
+	})
+	// Unblock the export goroutine if the upload stopped reading early.
+	pr.CloseWithError(io.ErrClosedPipe)
+	if err != nil {
+		return fmt.Errorf("failed to upload export: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"os"
+	"regexp"
+	"strings"
+)
+
+var (
+	// scriptElementPattern matches script and style elements with their content.
+	scriptElementPattern = regexp.MustCompile(`(?is)<(script|style)\b[^>]*>.*?</(script|style)\s*>`)
+	// htmlTagPattern matches any remaining opening, closing or self-closing tag,
+	// which removes event handler and javascript: attributes along with it.
+	htmlTagPattern = regexp.MustCompile(`(?s)</?[a-zA-Z!][^>]*>`)
+)
+
+// sanitizeEnabled reports whether SANITIZE_INPUT=true is set.
+func sanitizeEnabled() bool {
+	return os.Getenv("SANITIZE_INPUT") == "true"
+}
+
+// sanitizeText strips HTML from user supplied text: script and style elements
+// are removed together with their content and all other tags are dropped,
+// keeping their inner text. Note that this changes the stored content, so it
+// is opt-in through SANITIZE_INPUT.
+func sanitizeText(s string) string {
+	s = scriptElementPattern.ReplaceAllString(s, "")
+	s = htmlTagPattern.ReplaceAllString(s, "")
+	return strings.TrimSpace(s)
+}
+
+// sanitizeQuestion applies sanitizeText to the free-text fields of q when
+// SANITIZE_INPUT is enabled.
+func sanitizeQuestion(q Question) Question {
+	if !sanitizeEnabled() {
+		return q
+	}
+	q.Task = sanitizeText(q.Task)
+	if q.DareTarget != nil {
+		target := sanitizeText(*q.DareTarget)
+		q.DareTarget = &target
+	}
+	return q
+}
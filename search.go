@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ftMinTokenSize is InnoDB's default innodb_ft_min_token_size. Shorter
+// tokens are left out of the FULLTEXT index of question_search, so a search
+// for them cannot go through it.
+const ftMinTokenSize = 3
+
+// searchStopWords are dropped from both indexed tasks and search terms.
+// Keeping the list here instead of relying on the server's FULLTEXT stop
+// word list makes indexing and querying agree regardless of configuration.
+var searchStopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true,
+	"be": true, "but": true, "by": true, "for": true, "if": true, "in": true,
+	"into": true, "is": true, "it": true, "of": true, "on": true, "or": true,
+	"so": true, "than": true, "that": true, "the": true, "their": true,
+	"then": true, "there": true, "these": true, "they": true, "this": true,
+	"to": true, "was": true, "were": true, "will": true, "with": true,
+}
+
+// searchTokens lowercases text, splits it on anything that is not a letter
+// or digit and removes stop words.
+func searchTokens(text string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	tokens := fields[:0]
+	for _, field := range fields {
+		if !searchStopWords[field] {
+			tokens = append(tokens, field)
+		}
+	}
+	return tokens
+}
+
+// searchMatchQuery returns the BOOLEAN MODE argument of MATCH ... AGAINST
+// for tokens. Each token is a prefix term, so "fea" finds "fear".
+func searchMatchQuery(tokens []string) string {
+	terms := make([]string, len(tokens))
+	for i, token := range tokens {
+		terms[i] = token + "*"
+	}
+	return strings.Join(terms, " ")
+}
+
+// needsContainsMatch reports whether search can only be found with a
+// leading-wildcard LIKE: it has characters the tokenizer drops, such as the
+// % in "50%" or a leading "#", or a token too short for the FULLTEXT index,
+// or no token at all. Other searches are found through the index plus a
+// prefix LIKE, which the idx_task_prefix index can serve.
+func needsContainsMatch(search string, tokens []string) bool {
+	for _, r := range search {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.IsSpace(r) {
+			return true
+		}
+	}
+	if len(tokens) == 0 {
+		return true
+	}
+	for _, token := range tokens {
+		if utf8.RuneCountInString(token) < ftMinTokenSize {
+			return true
+		}
+	}
+	return false
+}
+
+// upsertSearchEntry stores the search tokens of a question's task in
+// question_search.
+func upsertSearchEntry(ctx context.Context, tx *sql.Tx, questionID int64, task string) error {
+	_, err := tx.ExecContext(ctx, "REPLACE INTO question_search (question_id, search_tokens) VALUES (?, ?)",
+		questionID, strings.Join(searchTokens(task), " "))
+	if err != nil {
+		return fmt.Errorf("failed to update search index: %w", err)
+	}
+	return nil
+}
+
+// RebuildSearchIndex regenerates the question_search entry of every
+// question in batches of retagBatchSize and removes entries of questions that
+// no longer exist
+// @Description Re-tokenizes every question into question_search
+// @Return int64 Number of questions indexed
+// @Return error Database error
+func (d *Database) RebuildSearchIndex(ctx context.Context) (int64, error) {
+	_, err := d.db.ExecContext(ctx, "DELETE FROM question_search WHERE question_id NOT IN (SELECT id FROM questions)")
+	if err != nil {
+		return 0, fmt.Errorf("failed to remove stale search entries: %w", err)
+	}
+
+	var indexed int64
+	var afterID int64
+	for {
+		batch, err := d.GetQuestionBatch(ctx, afterID, retagBatchSize)
+		if err != nil {
+			return indexed, err
+		}
+		if len(batch) == 0 {
+			return indexed, nil
+		}
+
+		err = d.withTransaction(ctx, func(tx *sql.Tx) error {
+			for _, q := range batch {
+				if err := upsertSearchEntry(ctx, tx, int64(q.ID), q.Task); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return indexed, err
+		}
+		indexed += int64(len(batch))
+		afterID = int64(batch[len(batch)-1].ID)
+	}
+}
+
+// ensureSearchIndex builds the search index at startup when question_search
+// is empty but questions exist, which is the case right after migration 010.
+func ensureSearchIndex() {
+	ctx := context.Background()
+	var entries, questions int
+	err := db.db.QueryRowContext(ctx,
+		"SELECT (SELECT COUNT(*) FROM question_search), (SELECT COUNT(*) FROM questions)").Scan(&entries, &questions)
+	if err != nil {
+		log.Printf("Failed to check search index: %v", err)
+		return
+	}
+	if entries > 0 || questions == 0 {
+		return
+	}
+
+	log.Printf("Search index is empty, indexing %d questions", questions)
+	indexed, err := db.RebuildSearchIndex(ctx)
+	if err != nil {
+		log.Printf("Failed to build search index after %d questions: %v", indexed, err)
+	}
+}
+
+// SearchIndexRebuildResponse reports the outcome of a search index rebuild
+// @Description Number of questions written to the search index
+type SearchIndexRebuildResponse struct {
+	// Number of questions indexed
+	// @example 1500
+	Indexed int64 `json:"indexed"`
+}
+
+// @Summary Rebuild the search index
+// @Description Re-tokenize every question into the question_search table used by the search filter. Only needed after changing the tokenizer or editing questions directly in the database.
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} SearchIndexRebuildResponse "Index rebuilt"
+// @Failure 401 {object} ErrorResponse "Missing or invalid API key"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /admin/search-index/rebuild [post]
+func rebuildSearchIndex(w http.ResponseWriter, r *http.Request) {
+	indexed, err := db.RebuildSearchIndex(r.Context())
+	if err != nil {
+		log.Printf("Search index rebuild failed after %d questions: %v", indexed, err)
+		respondError(w, err, "Failed to rebuild search index")
+		return
+	}
+	respondJSON(w, http.StatusOK, SearchIndexRebuildResponse{Indexed: indexed})
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// likeMatch reports whether s matches the LIKE pattern with ESCAPE '!',
+// case-insensitively like the task column's collation.
+func likeMatch(pattern, s string) bool {
+	p, str := []rune(strings.ToLower(pattern)), []rune(strings.ToLower(s))
+	var match func(i, j int) bool
+	match = func(i, j int) bool {
+		if i == len(p) {
+			return j == len(str)
+		}
+		switch p[i] {
+		case '%':
+			for k := j; k <= len(str); k++ {
+				if match(i+1, k) {
+					return true
+				}
+			}
+			return false
+		case '_':
+			return j < len(str) && match(i+1, j+1)
+		case '!':
+			i++
+		}
+		return i < len(p) && j < len(str) && p[i] == str[j] && match(i+1, j+1)
+	}
+	return match(0, 0)
+}
+
+// searchFinds evaluates the search condition built by buildQuestionsQuery
+// for one task: a prefix term of the search matching an indexed token of
+// the task, or the task matching the LIKE pattern.
+func searchFinds(search, task string) bool {
+	_, args := buildQuestionsQuery(FilterSet{Search: search, IncludeScheduled: true}, QueryOptions{})
+	pattern := args[len(args)-1].(string)
+	if likeMatch(pattern, task) {
+		return true
+	}
+	if len(args) == 1 {
+		return false
+	}
+	for _, term := range strings.Fields(args[0].(string)) {
+		prefix := strings.TrimSuffix(term, "*")
+		for _, token := range searchTokens(task) {
+			if len(token) >= ftMinTokenSize && strings.HasPrefix(token, prefix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func TestLikeMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		s       string
+		want    bool
+	}{
+		{"%fear%", "What is your biggest FEAR?", true},
+		{"fear%", "fear of heights", true},
+		{"fear%", "my fear", false},
+		{"%50!%%", "Give away 50% of your snacks", true},
+		{"%50!%%", "Do 50 push-ups", false},
+		{"%a!_b%", "a_b", true},
+		{"%a!_b%", "axb", false},
+		{"wow!!%", "wow! again", true},
+	}
+	for _, tt := range tests {
+		if got := likeMatch(tt.pattern, tt.s); got != tt.want {
+			t.Errorf("likeMatch(%q, %q) = %v, want %v", tt.pattern, tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestSearchMatchesTasks(t *testing.T) {
+	tasks := []string{
+		"What is your biggest fear?",
+		"Fear of the dark: yes or no?",
+		"Give away 50% of your snacks",
+		"Do 50 push-ups",
+		"What is your favourite colour?",
+		"Swap under_score names with a friend",
+	}
+	tests := []struct {
+		search string
+		want   []string
+	}{
+		{"fear", []string{tasks[0], tasks[1]}},
+		{"FEAR", []string{tasks[0], tasks[1]}},
+		{"biggest", []string{tasks[0]}},
+		{"50%", []string{tasks[2]}},
+		{"%", []string{tasks[2]}},
+		{"_", []string{tasks[5]}},
+		{"under_score", []string{tasks[5]}},
+		{"colour", []string{tasks[4]}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.search, func(t *testing.T) {
+			var got []string
+			for _, task := range tasks {
+				if searchFinds(tt.search, task) {
+					got = append(got, task)
+				}
+			}
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("search %q found %q, want %q", tt.search, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+)
+
+// selfTestTimeout bounds each individual self-test check.
+const selfTestTimeout = 10 * time.Second
+
+// selfTestCheck is a single deployment check run by -selftest.
+type selfTestCheck struct {
+	name string
+	skip bool
+	run  func(ctx context.Context) error
+}
+
+// SelfTestOptions selects which self-test checks to skip.
+type SelfTestOptions struct {
+	SkipConnectivity bool
+	SkipSchema       bool
+	SkipRead         bool
+	SkipWrite        bool
+}
+
+// runSelfTest runs the deployment checks against d, printing one line per
+// check to out. It returns true when no check failed.
+func runSelfTest(out io.Writer, d *Database, opts SelfTestOptions) bool {
+	checks := []selfTestCheck{
+		{name: "database connectivity", skip: opts.SkipConnectivity, run: d.Ping},
+		{name: "database schema", skip: opts.SkipSchema, run: d.CheckSchema},
+		{name: "read query", skip: opts.SkipRead, run: d.CheckReadPath},
+		{name: "write path (rolled back)", skip: opts.SkipWrite, run: d.CheckWritePath},
+	}
+
+	ok := true
+	for _, check := range checks {
+		if check.skip {
+			fmt.Fprintf(out, "SKIP  %s\n", check.name)
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), selfTestTimeout)
+		start := time.Now()
+		err := check.run(ctx)
+		cancel()
+
+		if err != nil {
+			ok = false
+			fmt.Fprintf(out, "FAIL  %s: %v\n", check.name, err)
+			continue
+		}
+		fmt.Fprintf(out, "PASS  %s (%s)\n", check.name, time.Since(start).Round(time.Millisecond))
+	}
+
+	if ok {
+		fmt.Fprintln(out, "self-test passed")
+	} else {
+		fmt.Fprintln(out, "self-test failed")
+	}
+	return ok
+}
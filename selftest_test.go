@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// unreachableDatabase returns a Database pointing at a port nothing listens
+// on. Opening it must not connect.
+func unreachableDatabase(t *testing.T) *Database {
+	t.Helper()
+	t.Setenv("MYSQL_HOST", "127.0.0.1")
+	t.Setenv("MYSQL_PORT", "1")
+	d, err := openDatabase()
+	if err != nil {
+		t.Fatalf("openDatabase() error = %v", err)
+	}
+	t.Cleanup(func() { d.Close() })
+	return d
+}
+
+func TestRunSelfTestSkipsChecks(t *testing.T) {
+	d := unreachableDatabase(t)
+	var out bytes.Buffer
+	opts := SelfTestOptions{SkipConnectivity: true, SkipSchema: true, SkipRead: true, SkipWrite: true}
+
+	if !runSelfTest(&out, d, opts) {
+		t.Fatalf("self-test failed with every check skipped:\n%s", out.String())
+	}
+	if got := strings.Count(out.String(), "SKIP"); got != 4 {
+		t.Errorf("got %d skipped checks, want 4:\n%s", got, out.String())
+	}
+}
+
+func TestRunSelfTestReportsConnectivityFailure(t *testing.T) {
+	d := unreachableDatabase(t)
+	var out bytes.Buffer
+	opts := SelfTestOptions{SkipSchema: true, SkipRead: true, SkipWrite: true}
+
+	if runSelfTest(&out, d, opts) {
+		t.Fatalf("self-test passed against an unreachable database:\n%s", out.String())
+	}
+	if !strings.Contains(out.String(), "FAIL  database connectivity") {
+		t.Errorf("connectivity failure not reported:\n%s", out.String())
+	}
+}
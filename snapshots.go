@@ -0,0 +1,496 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/2Friendly4You/TruthOrDare/apierror"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/robfig/cron/v3"
+)
+
+const (
+	snapshotPrefix     = "questions-"
+	snapshotSuffix     = ".jsonl.gz"
+	snapshotTimeFormat = "20060102T150405Z"
+
+	defaultSnapshotRetention = 7
+
+	// snapshotLockName is the MySQL named lock held while a snapshot is
+	// taken, so only one replica runs the job at a time.
+	snapshotLockName = "truth_or_dare_snapshot"
+)
+
+// errSnapshotInProgress is returned when another replica or request holds
+// the snapshot lock.
+var errSnapshotInProgress = errors.New("a snapshot is already being taken")
+
+// Snapshot describes a stored catalog snapshot
+// @Description A gzip-compressed JSON-lines export of every question
+type Snapshot struct {
+	// File or object name
+	// @example "questions-20260101T020000Z.jsonl.gz"
+	Name string `json:"name"`
+
+	// When the snapshot was taken
+	CreatedAt time.Time `json:"createdAt"`
+
+	// Size in bytes
+	// @example 524288
+	Size int64 `json:"size"`
+}
+
+// SnapshotStatus reports the configuration and outcomes of the snapshot job
+// @Description Configuration and run statistics of the snapshot job
+type SnapshotStatus struct {
+	// Cron expression of scheduled runs; empty when only manual runs happen
+	// @example "0 2 * * *"
+	Schedule string `json:"schedule,omitempty"`
+
+	// Where snapshots are stored
+	// @example "s3://backups/snapshots/"
+	Location string `json:"location"`
+
+	// Number of snapshots kept
+	// @example 7
+	Retention int `json:"retention"`
+
+	// Start of the last run on this replica
+	LastRunAt *time.Time `json:"lastRunAt,omitempty"`
+
+	// End of the last successful run on this replica
+	LastSuccessAt *time.Time `json:"lastSuccessAt,omitempty"`
+
+	// Error of the last run on this replica, if it failed
+	LastError string `json:"lastError,omitempty"`
+
+	// Successful runs since this replica started
+	Successes int `json:"successes"`
+
+	// Failed runs since this replica started
+	Failures int `json:"failures"`
+}
+
+// SnapshotListResponse lists the stored snapshots
+// @Description Snapshot job status and stored snapshots, newest first
+type SnapshotListResponse struct {
+	Status    SnapshotStatus `json:"status"`
+	Snapshots []Snapshot     `json:"snapshots"`
+}
+
+// snapshotStore stores snapshot files.
+type snapshotStore interface {
+	// Write stores the data written by fn under name. A failed write
+	// leaves no snapshot behind.
+	Write(ctx context.Context, name string, fn func(w io.Writer) error) error
+	// List returns the stored snapshots, newest first.
+	List(ctx context.Context) ([]Snapshot, error)
+	Delete(ctx context.Context, name string) error
+	Location() string
+}
+
+// parseSnapshotName returns the creation time encoded in a snapshot name.
+func parseSnapshotName(name string) (time.Time, bool) {
+	stamp, ok := strings.CutPrefix(name, snapshotPrefix)
+	if !ok {
+		return time.Time{}, false
+	}
+	stamp, ok = strings.CutSuffix(stamp, snapshotSuffix)
+	if !ok {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(snapshotTimeFormat, stamp)
+	return t, err == nil
+}
+
+func sortSnapshots(snapshots []Snapshot) {
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].CreatedAt.After(snapshots[j].CreatedAt)
+	})
+}
+
+// dirSnapshotStore keeps snapshots in a local directory.
+type dirSnapshotStore struct {
+	dir string
+}
+
+func (s dirSnapshotStore) Write(ctx context.Context, name string, fn func(w io.Writer) error) error {
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create snapshot directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(s.dir, name+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create snapshot file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	err = fn(tmp)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(s.dir, name)); err != nil {
+		return fmt.Errorf("failed to store snapshot: %w", err)
+	}
+	return nil
+}
+
+func (s dirSnapshotStore) List(ctx context.Context) ([]Snapshot, error) {
+	entries, err := os.ReadDir(s.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return []Snapshot{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list snapshots: %w", err)
+	}
+
+	snapshots := []Snapshot{}
+	for _, entry := range entries {
+		createdAt, ok := parseSnapshotName(entry.Name())
+		if !ok || !entry.Type().IsRegular() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		snapshots = append(snapshots, Snapshot{Name: entry.Name(), CreatedAt: createdAt, Size: info.Size()})
+	}
+	sortSnapshots(snapshots)
+	return snapshots, nil
+}
+
+func (s dirSnapshotStore) Delete(ctx context.Context, name string) error {
+	return os.Remove(filepath.Join(s.dir, name))
+}
+
+func (s dirSnapshotStore) Location() string {
+	return s.dir
+}
+
+// s3SnapshotStore keeps snapshots under a prefix of an S3 bucket.
+type s3SnapshotStore struct {
+	client *s3.Client
+	bucket string
+	prefix string
+}
+
+func (s s3SnapshotStore) Write(ctx context.Context, name string, fn func(w io.Writer) error) error {
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(fn(pw))
+	}()
+
+	_, err := manager.NewUploader(s.client).Upload(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(s.prefix + name),
+		Body:        pr,
+		ContentType: aws.String("application/gzip"),
+	})
+	// Unblock the writer if the upload stopped reading early.
+	pr.CloseWithError(io.ErrClosedPipe)
+	if err != nil {
+		return fmt.Errorf("failed to upload snapshot: %w", err)
+	}
+	return nil
+}
+
+func (s s3SnapshotStore) List(ctx context.Context) ([]Snapshot, error) {
+	snapshots := []Snapshot{}
+	paginator := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(s.prefix + snapshotPrefix),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list snapshots: %w", err)
+		}
+		for _, object := range page.Contents {
+			name := strings.TrimPrefix(aws.ToString(object.Key), s.prefix)
+			createdAt, ok := parseSnapshotName(name)
+			if !ok {
+				continue
+			}
+			snapshots = append(snapshots, Snapshot{Name: name, CreatedAt: createdAt, Size: aws.ToInt64(object.Size)})
+		}
+	}
+	sortSnapshots(snapshots)
+	return snapshots, nil
+}
+
+func (s s3SnapshotStore) Delete(ctx context.Context, name string) error {
+	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.prefix + name),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete snapshot: %w", err)
+	}
+	return nil
+}
+
+func (s s3SnapshotStore) Location() string {
+	return "s3://" + s.bucket + "/" + s.prefix
+}
+
+// snapshotter takes catalog snapshots on a schedule and on demand.
+type snapshotter struct {
+	db        *Database
+	store     snapshotStore
+	schedule  cron.Schedule
+	retention int
+
+	mu     sync.Mutex
+	status SnapshotStatus
+}
+
+// snapshots is the configured snapshot job, or nil when snapshots are not
+// configured.
+var snapshots *snapshotter
+
+// loadSnapshotter configures the snapshot job from the environment.
+// Snapshots go to EXPORT_DIR, or to EXPORT_S3_BUCKET under EXPORT_S3_PREFIX
+// (default "snapshots/"). EXPORT_SCHEDULE is a standard five-field cron
+// expression in UTC; without it snapshots are only taken on request.
+// EXPORT_RETENTION is the number of snapshots kept (default 7). It returns
+// nil if neither EXPORT_DIR nor EXPORT_S3_BUCKET is set.
+func loadSnapshotter(d *Database) (*snapshotter, error) {
+	s := &snapshotter{db: d, retention: defaultSnapshotRetention}
+
+	dir, bucket := os.Getenv("EXPORT_DIR"), os.Getenv("EXPORT_S3_BUCKET")
+	switch {
+	case dir != "" && bucket != "":
+		return nil, errors.New("EXPORT_DIR and EXPORT_S3_BUCKET are mutually exclusive")
+	case dir != "":
+		s.store = dirSnapshotStore{dir: dir}
+	case bucket != "":
+		client, err := newS3Client(context.Background())
+		if err != nil {
+			return nil, err
+		}
+		prefix := os.Getenv("EXPORT_S3_PREFIX")
+		if prefix == "" {
+			prefix = "snapshots/"
+		}
+		s.store = s3SnapshotStore{client: client, bucket: bucket, prefix: prefix}
+	default:
+		return nil, nil
+	}
+
+	if spec := os.Getenv("EXPORT_SCHEDULE"); spec != "" {
+		schedule, err := cron.ParseStandard(spec)
+		if err != nil {
+			return nil, fmt.Errorf("invalid EXPORT_SCHEDULE %q: %w", spec, err)
+		}
+		s.schedule = schedule
+		s.status.Schedule = spec
+	}
+
+	if raw := os.Getenv("EXPORT_RETENTION"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid EXPORT_RETENTION %q: must be a positive integer", raw)
+		}
+		s.retention = n
+	}
+
+	s.status.Location = s.store.Location()
+	s.status.Retention = s.retention
+	return s, nil
+}
+
+// Run takes scheduled snapshots until ctx is cancelled. It runs in its own
+// goroutine and only logs failures, so it never affects request handling.
+func (s *snapshotter) Run(ctx context.Context) {
+	if s.schedule == nil {
+		return
+	}
+	log.Printf("Taking snapshots on schedule %q to %s", s.status.Schedule, s.store.Location())
+
+	for {
+		next := s.schedule.Next(time.Now().UTC())
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		_, err := s.take(ctx, next)
+		if errors.Is(err, errSnapshotInProgress) {
+			continue
+		}
+		if err != nil {
+			logger.Error("scheduled snapshot failed", "error", err, "location", s.store.Location())
+		}
+	}
+}
+
+// take writes a new snapshot and prunes old ones. For scheduled runs, due is
+// the scheduled time; if another replica has already stored a snapshot
+// since then, take returns nil without writing one. Manual runs pass the
+// zero time.
+func (s *snapshotter) take(ctx context.Context, due time.Time) (*Snapshot, error) {
+	var snapshot *Snapshot
+	acquired, err := s.db.WithNamedLock(ctx, snapshotLockName, func() error {
+		if !due.IsZero() {
+			existing, err := s.store.List(ctx)
+			if err != nil {
+				return err
+			}
+			if len(existing) > 0 && !existing[0].CreatedAt.Before(due.Truncate(time.Second)) {
+				return nil
+			}
+		}
+
+		started := time.Now().UTC()
+		s.recordStart(started)
+
+		var err error
+		snapshot, err = s.write(ctx, started)
+		if err == nil {
+			err = s.prune(ctx)
+		}
+		s.recordResult(err)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !acquired {
+		return nil, errSnapshotInProgress
+	}
+	return snapshot, nil
+}
+
+// write exports every question into a snapshot named after started.
+func (s *snapshotter) write(ctx context.Context, started time.Time) (*Snapshot, error) {
+	name := snapshotPrefix + started.Format(snapshotTimeFormat) + snapshotSuffix
+	counter := &countingWriter{}
+	err := s.store.Write(ctx, name, func(w io.Writer) error {
+		counter.w = w
+		gz := gzip.NewWriter(counter)
+		err := s.db.ExportToWriter(ctx, gz, FilterSet{})
+		if closeErr := gz.Close(); err == nil {
+			err = closeErr
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Snapshot{Name: name, CreatedAt: started.Truncate(time.Second), Size: counter.n}, nil
+}
+
+// prune deletes all but the newest retention snapshots.
+func (s *snapshotter) prune(ctx context.Context) error {
+	existing, err := s.store.List(ctx)
+	if err != nil {
+		return err
+	}
+	for i := s.retention; i < len(existing); i++ {
+		if err := s.store.Delete(ctx, existing[i].Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *snapshotter) recordStart(started time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status.LastRunAt = &started
+}
+
+func (s *snapshotter) recordResult(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		s.status.Failures++
+		s.status.LastError = err.Error()
+		return
+	}
+	now := time.Now().UTC()
+	s.status.Successes++
+	s.status.LastSuccessAt = &now
+	s.status.LastError = ""
+}
+
+func (s *snapshotter) Status() SnapshotStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.status
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// @Summary List snapshots
+// @Description Return the snapshot job's configuration and run statistics on this replica, together with the stored snapshots, newest first
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} SnapshotListResponse "Snapshots"
+// @Failure 401 {object} ErrorResponse "Missing or invalid API key"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /admin/snapshots [get]
+func listSnapshots(w http.ResponseWriter, r *http.Request) {
+	stored, err := snapshots.store.List(r.Context())
+	if err != nil {
+		log.Printf("Failed to list snapshots: %v", err)
+		respondError(w, err, "Failed to list snapshots")
+		return
+	}
+	respondJSON(w, http.StatusOK, SnapshotListResponse{Status: snapshots.Status(), Snapshots: stored})
+}
+
+// @Summary Take a snapshot
+// @Description Export every question to a new snapshot immediately and prune snapshots beyond the retention count
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Success 201 {object} Snapshot "Snapshot taken"
+// @Failure 401 {object} ErrorResponse "Missing or invalid API key"
+// @Failure 409 {object} ErrorResponse "A snapshot is already being taken"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /admin/snapshots [post]
+func takeSnapshot(w http.ResponseWriter, r *http.Request) {
+	snapshot, err := snapshots.take(r.Context(), time.Time{})
+	if errors.Is(err, errSnapshotInProgress) {
+		writeError(w, apierror.Conflict, err.Error())
+		return
+	}
+	if err != nil {
+		logger.Error("manual snapshot failed", "error", err, "location", snapshots.store.Location())
+		respondError(w, err, "Failed to take snapshot")
+		return
+	}
+	respondJSON(w, http.StatusCreated, snapshot)
+}
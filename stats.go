@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/2Friendly4You/TruthOrDare/apierror"
+)
+
+// lengthBucketWidth is the width in characters of each task length bucket,
+// and lengthBucketCount the number of buckets. Tasks longer than the last
+// bounded bucket are counted in an open-ended final bucket.
+const (
+	lengthBucketWidth = 50
+	lengthBucketCount = 6
+)
+
+// LengthBucket counts the questions whose task length falls in a range
+// @Description Number of questions with a task length in [min, max]
+type LengthBucket struct {
+	// Range label
+	// @example "51-100"
+	Label string `json:"label"`
+
+	// Shortest task length in the bucket, in characters
+	// @example 51
+	Min int `json:"min"`
+
+	// Longest task length in the bucket; absent for the last, open-ended
+	// bucket
+	// @example 100
+	Max *int `json:"max,omitempty"`
+
+	// Number of questions in the bucket
+	// @example 42
+	Count int `json:"count"`
+}
+
+// LengthHistogramResponse is the task length distribution
+// @Description Histogram of question task lengths in characters
+type LengthHistogramResponse struct {
+	// Buckets in ascending order, including empty ones
+	Buckets []LengthBucket `json:"buckets"`
+}
+
+// lengthBuckets returns the empty histogram buckets: 0-50, 51-100, ... and
+// a final open-ended bucket.
+func lengthBuckets() []LengthBucket {
+	buckets := make([]LengthBucket, lengthBucketCount+1)
+	for i := 0; i < lengthBucketCount; i++ {
+		min, max := i*lengthBucketWidth+1, (i+1)*lengthBucketWidth
+		if i == 0 {
+			min = 0
+		}
+		buckets[i] = LengthBucket{Label: fmt.Sprintf("%d-%d", min, max), Min: min, Max: &max}
+	}
+	last := lengthBucketCount*lengthBucketWidth + 1
+	buckets[lengthBucketCount] = LengthBucket{Label: fmt.Sprintf("%d+", last), Min: last}
+	return buckets
+}
+
+// @Summary Task length histogram
+// @Description Count questions by task length in buckets of 50 characters (0-50, 51-100, ...), with tasks over 300 characters in a final bucket. Useful for spotting languages with many overly long or short questions.
+// @Tags stats
+// @Produce json
+// @Param language query string false "ISO 639-1 language code filter" example(en)
+// @Param type query string false "Question type filter" Enums(truth, dare)
+// @Success 200 {object} LengthHistogramResponse "Length histogram"
+// @Failure 400 {object} ErrorResponse "Invalid request parameters"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /stats/lengths [get]
+func getLengthHistogram(w http.ResponseWriter, r *http.Request) {
+	language := normalizeLanguage(r.URL.Query().Get("language"))
+	qType := r.URL.Query().Get("type")
+	if qType != "" && qType != "truth" && qType != "dare" {
+		writeError(w, apierror.InvalidParam, "type must be \"truth\" or \"dare\"")
+		return
+	}
+
+	buckets, err := db.GetTaskLengthHistogram(r.Context(), language, qType)
+	if err != nil {
+		log.Printf("Failed to build length histogram: %v", err)
+		respondError(w, err, "Failed to build length histogram")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, LengthHistogramResponse{Buckets: buckets})
+}
@@ -0,0 +1,370 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	defaultSyncInterval = time.Minute
+
+	// syncFetchTimeout bounds each request to the upstream instance.
+	syncFetchTimeout = 30 * time.Second
+
+	// syncLockName is the MySQL named lock held during a sync run, so only
+	// one replica pulls from the upstream at a time.
+	syncLockName = "truth_or_dare_sync"
+)
+
+// SyncStatus reports the state of pull replication from the upstream
+// instance
+// @Description Cursor and outcome of pulling changes from the upstream instance
+type SyncStatus struct {
+	// Base URL of the upstream instance
+	// @example "https://staging.example.com"
+	Upstream string `json:"upstream"`
+
+	// Time between sync runs
+	// @example "1m0s"
+	Interval string `json:"interval"`
+
+	// Sequence number of the last upstream change applied
+	// @example 1334
+	Cursor int64 `json:"cursor"`
+
+	// Total number of upstream changes applied
+	// @example 1320
+	Applied int64 `json:"applied"`
+
+	// Total number of upstream changes skipped because the local instance
+	// rejected them, e.g. through a content filter
+	// @example 14
+	Skipped int64 `json:"skipped"`
+
+	// End of the last run that caught up with the upstream
+	LastSyncAt *time.Time `json:"lastSyncAt,omitempty"`
+
+	// Error of the last failed run or skipped change, if any
+	LastError string `json:"lastError,omitempty"`
+
+	// Time of LastError
+	LastErrorAt *time.Time `json:"lastErrorAt,omitempty"`
+}
+
+// syncer pulls question changes from an upstream instance of this API and
+// applies them locally. Upstream questions are mapped to local IDs in
+// sync_questions; the upstream wins every conflict, so a local edit is
+// overwritten by the next upstream update and a question deleted locally is
+// recreated.
+type syncer struct {
+	db       *Database
+	upstream string
+	apiKey   string
+	interval time.Duration
+	client   *http.Client
+}
+
+// upstreamSync is the configured sync job, or nil when SYNC_UPSTREAM_URL is
+// not set.
+var upstreamSync *syncer
+
+// loadSyncer configures pull replication from the environment.
+// SYNC_UPSTREAM_URL is the base URL of the upstream instance, SYNC_API_KEY
+// an optional bearer token sent to it and SYNC_INTERVAL a Go duration
+// between runs (default 1m). It returns nil if SYNC_UPSTREAM_URL is not set.
+func loadSyncer(d *Database) (*syncer, error) {
+	upstream := strings.TrimRight(os.Getenv("SYNC_UPSTREAM_URL"), "/")
+	if upstream == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(upstream, "http://") && !strings.HasPrefix(upstream, "https://") {
+		return nil, fmt.Errorf("invalid SYNC_UPSTREAM_URL %q: must be an http or https URL", upstream)
+	}
+
+	s := &syncer{
+		db:       d,
+		upstream: upstream,
+		apiKey:   os.Getenv("SYNC_API_KEY"),
+		interval: defaultSyncInterval,
+		client:   &http.Client{Timeout: syncFetchTimeout},
+	}
+	if raw := os.Getenv("SYNC_INTERVAL"); raw != "" {
+		interval, err := time.ParseDuration(raw)
+		if err != nil || interval <= 0 {
+			return nil, fmt.Errorf("invalid SYNC_INTERVAL %q: must be a positive duration", raw)
+		}
+		s.interval = interval
+	}
+	return s, nil
+}
+
+// Run syncs immediately and then every interval until ctx is cancelled. It
+// runs in its own goroutine; failures are logged and recorded in the sync
+// status, and the next run resumes from the stored cursor.
+func (s *syncer) Run(ctx context.Context) {
+	log.Printf("Pulling question changes from %s every %s", s.upstream, s.interval)
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		if err := s.syncOnce(ctx); err != nil {
+			logger.Error("sync failed", "error", err, "upstream", s.upstream)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// syncOnce applies every upstream change after the stored cursor. It does
+// nothing if another replica is syncing.
+func (s *syncer) syncOnce(ctx context.Context) error {
+	_, err := s.db.WithNamedLock(ctx, syncLockName, func() error {
+		status, err := s.db.GetSyncStatus(ctx, s.upstream)
+		if err != nil {
+			return err
+		}
+
+		pullErr := s.pull(ctx, &status)
+		now := time.Now().UTC()
+		if pullErr != nil {
+			status.LastError = pullErr.Error()
+			status.LastErrorAt = &now
+		} else {
+			status.LastSyncAt = &now
+		}
+		if err := s.db.SaveSyncStatus(ctx, status); err != nil {
+			return err
+		}
+		return pullErr
+	})
+	return err
+}
+
+// pull pages through the upstream change feed from status.Cursor, applying
+// each change and advancing the cursor. Every change is applied on its own,
+// and re-applying one is harmless, so a run interrupted between a change and
+// saving the cursor simply repeats it next time.
+func (s *syncer) pull(ctx context.Context, status *SyncStatus) error {
+	for {
+		var page ChangesResponse
+		path := fmt.Sprintf("/api/changes?since_seq=%d&limit=%d", status.Cursor, maxChangesLimit)
+		if err := s.get(ctx, path, &page); err != nil {
+			return fmt.Errorf("failed to fetch upstream changes: %w", err)
+		}
+
+		for _, change := range page.Changes {
+			err := s.apply(ctx, change)
+			if err != nil && statusForError(err) >= http.StatusInternalServerError {
+				return fmt.Errorf("failed to apply upstream change %d (%s question %d): %w", change.Seq, change.Action, change.EntityID, err)
+			}
+			if err != nil {
+				// A change this instance rejects would otherwise block
+				// the feed forever.
+				logger.Warn("skipped upstream change", "seq", change.Seq, "action", change.Action, "question", change.EntityID, "error", err)
+				now := time.Now().UTC()
+				status.Skipped++
+				status.LastError = fmt.Sprintf("skipped upstream change %d: %v", change.Seq, err)
+				status.LastErrorAt = &now
+			} else {
+				status.Applied++
+			}
+			status.Cursor = change.Seq
+		}
+		if err := s.db.SaveSyncStatus(ctx, *status); err != nil {
+			return err
+		}
+
+		if len(page.Changes) < maxChangesLimit {
+			return nil
+		}
+	}
+}
+
+// apply mirrors one upstream change locally.
+func (s *syncer) apply(ctx context.Context, change ChangeLogEntry) error {
+	upstreamID := int(change.EntityID)
+	localID, mapped, err := s.db.LocalQuestionID(ctx, s.upstream, upstreamID)
+	if err != nil {
+		return err
+	}
+
+	if change.Action == ChangeDelete {
+		if !mapped {
+			return nil
+		}
+		if err := s.db.DeleteQuestion(ctx, localID, false); err != nil && !errors.Is(err, ErrQuestionNotFound) {
+			return err
+		}
+		return s.db.UnmapQuestion(ctx, s.upstream, upstreamID)
+	}
+
+	var q Question
+	err = s.get(ctx, fmt.Sprintf("/api/questions/%d", upstreamID), &q)
+	if errors.Is(err, ErrQuestionNotFound) {
+		// Deleted upstream after this change; its delete entry follows.
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to fetch upstream question: %w", err)
+	}
+
+	if mapped {
+		err := s.db.UpdateQuestion(ctx, localID, q)
+		if !errors.Is(err, ErrQuestionNotFound) {
+			return err
+		}
+		// Deleted locally; the upstream wins, so it is created again.
+	}
+	ids, err := s.db.AddQuestions(ctx, []Question{q})
+	if err != nil {
+		return err
+	}
+	return s.db.MapQuestion(ctx, s.upstream, upstreamID, int(ids[0]))
+}
+
+// get fetches path from the upstream and decodes the JSON response into v.
+// A 404 is returned as ErrQuestionNotFound.
+func (s *syncer) get(ctx context.Context, path string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.upstream+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if s.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+s.apiKey)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return ErrQuestionNotFound
+	case resp.StatusCode != http.StatusOK:
+		return fmt.Errorf("upstream answered %s", resp.Status)
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxImportDocumentSize)).Decode(v); err != nil {
+		return fmt.Errorf("failed to decode upstream response: %w", err)
+	}
+	return nil
+}
+
+// GetSyncStatus returns the stored sync state for upstream, or a zero state
+// if it was never synced.
+func (d *Database) GetSyncStatus(ctx context.Context, upstream string) (SyncStatus, error) {
+	status := SyncStatus{Upstream: upstream}
+	var lastSyncAt, lastErrorAt sql.NullTime
+	var lastError sql.NullString
+	err := d.db.QueryRowContext(ctx,
+		`SELECT cursor_seq, applied, skipped, last_sync_at, last_error, last_error_at
+		FROM sync_state WHERE upstream_hash = ?`, urlKey(upstream)).
+		Scan(&status.Cursor, &status.Applied, &status.Skipped, &lastSyncAt, &lastError, &lastErrorAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return status, nil
+	}
+	if err != nil {
+		return SyncStatus{}, fmt.Errorf("failed to look up sync state: %w", err)
+	}
+	if lastSyncAt.Valid {
+		status.LastSyncAt = &lastSyncAt.Time
+	}
+	status.LastError = lastError.String
+	if lastErrorAt.Valid {
+		status.LastErrorAt = &lastErrorAt.Time
+	}
+	return status, nil
+}
+
+// SaveSyncStatus stores the sync state of status.Upstream.
+func (d *Database) SaveSyncStatus(ctx context.Context, status SyncStatus) error {
+	var lastError interface{}
+	if status.LastError != "" {
+		lastError = status.LastError
+	}
+	_, err := d.db.ExecContext(ctx,
+		`INSERT INTO sync_state (upstream_hash, upstream, cursor_seq, applied, skipped, last_sync_at, last_error, last_error_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE cursor_seq = VALUES(cursor_seq), applied = VALUES(applied), skipped = VALUES(skipped),
+			last_sync_at = VALUES(last_sync_at), last_error = VALUES(last_error), last_error_at = VALUES(last_error_at)`,
+		urlKey(status.Upstream), status.Upstream, status.Cursor, status.Applied, status.Skipped,
+		status.LastSyncAt, lastError, status.LastErrorAt)
+	if err != nil {
+		return fmt.Errorf("failed to save sync state: %w", err)
+	}
+	return nil
+}
+
+// LocalQuestionID returns the local ID of the question synced from
+// upstreamID, and whether it has been synced at all.
+func (d *Database) LocalQuestionID(ctx context.Context, upstream string, upstreamID int) (int, bool, error) {
+	var localID int
+	err := d.db.QueryRowContext(ctx,
+		"SELECT local_id FROM sync_questions WHERE upstream_hash = ? AND upstream_id = ?",
+		urlKey(upstream), upstreamID).Scan(&localID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to look up synced question: %w", err)
+	}
+	return localID, true, nil
+}
+
+// MapQuestion records that the upstream question upstreamID is stored
+// locally as localID.
+func (d *Database) MapQuestion(ctx context.Context, upstream string, upstreamID, localID int) error {
+	_, err := d.db.ExecContext(ctx,
+		`INSERT INTO sync_questions (upstream_hash, upstream_id, local_id) VALUES (?, ?, ?)
+		ON DUPLICATE KEY UPDATE local_id = VALUES(local_id)`,
+		urlKey(upstream), upstreamID, localID)
+	if err != nil {
+		return fmt.Errorf("failed to map synced question: %w", err)
+	}
+	return nil
+}
+
+// UnmapQuestion forgets the local copy of the upstream question upstreamID.
+func (d *Database) UnmapQuestion(ctx context.Context, upstream string, upstreamID int) error {
+	_, err := d.db.ExecContext(ctx,
+		"DELETE FROM sync_questions WHERE upstream_hash = ? AND upstream_id = ?",
+		urlKey(upstream), upstreamID)
+	if err != nil {
+		return fmt.Errorf("failed to unmap synced question: %w", err)
+	}
+	return nil
+}
+
+// @Summary Sync status
+// @Description Report the change feed cursor, applied and skipped change counts and the last error of pull replication from SYNC_UPSTREAM_URL. Only available when SYNC_UPSTREAM_URL is set.
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} SyncStatus "Sync state"
+// @Failure 401 {object} ErrorResponse "Missing or invalid API key"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /admin/sync [get]
+func getSyncStatus(w http.ResponseWriter, r *http.Request) {
+	status, err := db.GetSyncStatus(r.Context(), upstreamSync.upstream)
+	if err != nil {
+		log.Printf("Failed to fetch sync status: %v", err)
+		respondError(w, err, "Failed to fetch sync status")
+		return
+	}
+	status.Interval = upstreamSync.interval.String()
+	respondJSON(w, http.StatusOK, status)
+}
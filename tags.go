@@ -0,0 +1,235 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/2Friendly4You/TruthOrDare/apierror"
+)
+
+// tagMetadataVersion is the format version of tag metadata documents.
+const tagMetadataVersion = 1
+
+// TagMetadata is the curated description of a single tag
+// @Description Curated metadata for a tag
+type TagMetadata struct {
+	// Tag name as used in question filters
+	// @example "party"
+	Name string `json:"name"`
+
+	// Optional grouping category
+	// @example "mood"
+	Category string `json:"category,omitempty"`
+
+	// Optional human readable description
+	// @example "Questions suited to loud groups"
+	Description string `json:"description,omitempty"`
+
+	// Alternative names that refer to the same tag
+	// @example ["parties","partying"]
+	Aliases []string `json:"aliases"`
+}
+
+// TagMetadataDocument is the export and import format for tag metadata
+// @Description A versioned document holding the full tag vocabulary
+type TagMetadataDocument struct {
+	// Document format version
+	// @example 1
+	Version int `json:"version"`
+
+	// Tags in the vocabulary
+	Tags []TagMetadata `json:"tags"`
+}
+
+// TagImportReport describes what a tag metadata import changed
+// @Description Summary of the changes applied by a tag metadata import
+type TagImportReport struct {
+	// Tags that did not exist before the import
+	Created []string `json:"created"`
+
+	// Tags whose category, description or aliases changed
+	Updated []string `json:"updated"`
+
+	// Tags removed because they were not in the document (prune only)
+	Pruned []string `json:"pruned"`
+
+	// Tags not in the document that were kept because questions use them
+	KeptInUse []string `json:"keptInUse"`
+}
+
+// @Summary Export tag metadata
+// @Description Export the full tag vocabulary with categories, descriptions and aliases
+// @Tags tags
+// @Produce json
+// @Success 200 {object} TagMetadataDocument "Tag metadata document"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /tags/export [get]
+func exportTagMetadata(w http.ResponseWriter, r *http.Request) {
+	tags, err := db.ExportTagMetadata(r.Context())
+	if err != nil {
+		log.Printf("Failed to export tag metadata: %v", err)
+		respondError(w, err, "Failed to export tag metadata")
+		return
+	}
+
+	w.Header().Set("Content-Disposition", `attachment; filename="tags.json"`)
+	respondJSON(w, http.StatusOK, TagMetadataDocument{Version: tagMetadataVersion, Tags: tags})
+}
+
+// @Summary Import tag metadata
+// @Description Apply a tag metadata document idempotently. Missing tags are created and changed metadata is updated. With prune=true, unused tags missing from the document are deleted. Question associations are never modified.
+// @Tags tags
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param prune query boolean false "Delete unused tags that are not in the document" default(false)
+// @Param document body TagMetadataDocument true "Tag metadata document"
+// @Success 200 {object} TagImportReport "Changes applied"
+// @Failure 400 {object} ErrorResponse "Invalid document"
+// @Failure 401 {object} ErrorResponse "Missing or invalid API key"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /tags/import [post]
+func importTagMetadata(w http.ResponseWriter, r *http.Request) {
+	prune := false
+	if raw := r.URL.Query().Get("prune"); raw != "" {
+		var err error
+		prune, err = strconv.ParseBool(raw)
+		if err != nil {
+			writeError(w, apierror.InvalidParam, "prune must be true or false")
+			return
+		}
+	}
+
+	var doc TagMetadataDocument
+	if err := json.NewDecoder(r.Body).Decode(&doc); err != nil {
+		writeError(w, apierror.InvalidBody, "Invalid tag metadata document")
+		return
+	}
+	if doc.Version != tagMetadataVersion {
+		writeError(w, apierror.InvalidBody, "Unsupported tag metadata version")
+		return
+	}
+
+	seen := map[string]bool{}
+	for _, tag := range doc.Tags {
+		if tag.Name == "" || seen[tag.Name] {
+			writeError(w, apierror.InvalidBody, "Tag names must be non-empty and unique")
+			return
+		}
+		seen[tag.Name] = true
+		if err := checkBlockedTags([]string{tag.Name}); err != nil {
+			writeError(w, apierror.BlockedTag, err.Error())
+			return
+		}
+	}
+
+	report, err := db.ImportTagMetadata(r.Context(), doc.Tags, prune)
+	if err != nil {
+		log.Printf("Failed to import tag metadata: %v", err)
+		respondError(w, err, "Failed to import tag metadata")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, report)
+}
+
+// AutoAssignRequest is the body of POST /tags/auto-assign
+// @Description Keyword rule for tagging questions in one step
+type AutoAssignRequest struct {
+	// Text the task must contain, matched case-insensitively
+	// @example "drink"
+	Keyword string `json:"keyword"`
+
+	// Tag added to every matching question; created if it does not exist
+	// @example "party"
+	Tag string `json:"tag"`
+
+	// Only tag questions in this language; empty matches all languages
+	// @example "en"
+	Language string `json:"language,omitempty"`
+}
+
+// AutoAssignResponse reports the outcome of an auto-assign run
+// @Description Number of questions matched and tagged by an auto-assign run
+type AutoAssignResponse struct {
+	// The assigned tag
+	// @example "party"
+	Tag string `json:"tag"`
+
+	// Number of questions whose task contains the keyword
+	// @example 42
+	Matched int `json:"matched"`
+
+	// Number of those that did not carry the tag yet and gained it
+	// @example 40
+	Updated int `json:"updated"`
+}
+
+// @Summary Auto-assign a tag by keyword
+// @Description Add a tag to every question whose task contains a keyword, optionally within one language, in a single transaction. Questions already carrying the tag are left alone; the others are recorded as updates in the change feed. For several rules, regular expressions, dry runs or very large catalogs use POST /admin/retag.
+// @Tags tags
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param rule body AutoAssignRequest true "Keyword, tag and optional language"
+// @Success 200 {object} AutoAssignResponse "Tag assigned"
+// @Failure 400 {object} ErrorResponse "Invalid request or blocked tag"
+// @Failure 401 {object} ErrorResponse "Missing or invalid API key"
+// @Failure 413 {object} ErrorResponse "Request body too large"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /tags/auto-assign [post]
+func autoAssignTag(w http.ResponseWriter, r *http.Request) {
+	var req AutoAssignRequest
+	if err := decodeJSONBody(w, r, &req); err != nil {
+		writeBodyError(w, err)
+		return
+	}
+
+	req.Keyword = strings.TrimSpace(req.Keyword)
+	req.Language = normalizeLanguage(req.Language)
+	var fields []apierror.FieldError
+	if utf8.RuneCountInString(req.Keyword) < 2 {
+		fields = append(fields, apierror.FieldError{Field: "keyword", Message: "keyword must be at least 2 characters"})
+	}
+	if !tagNamePattern.MatchString(req.Tag) {
+		fields = append(fields, apierror.FieldError{Field: "tag", Message: "tag may only contain letters, digits, -, _, + and :"})
+	}
+	if req.Language != "" && !languageCodePattern.MatchString(req.Language) {
+		fields = append(fields, apierror.FieldError{Field: "language", Message: "language must be a two-letter ISO 639-1 code"})
+	}
+	if len(fields) > 0 {
+		respondError(w, apierror.Validation(fields...), "Invalid auto-assign request")
+		return
+	}
+	if err := checkBlockedTags([]string{req.Tag}); err != nil {
+		respondError(w, err, "Tag is blocked")
+		return
+	}
+
+	ids, err := db.FindQuestionIDsByKeyword(r.Context(), req.Keyword, req.Language)
+	if err != nil {
+		log.Printf("Failed to find questions for auto-assign: %v", err)
+		respondError(w, err, "Failed to assign tag")
+		return
+	}
+
+	resp := AutoAssignResponse{Tag: req.Tag, Matched: len(ids)}
+	if len(ids) > 0 {
+		additions := make(map[int64][]string, len(ids))
+		for _, id := range ids {
+			additions[id] = []string{req.Tag}
+		}
+		resp.Updated, err = db.AddQuestionTags(r.Context(), additions)
+		if err != nil {
+			log.Printf("Failed to auto-assign tag %q: %v", req.Tag, err)
+			respondError(w, err, "Failed to assign tag")
+			return
+		}
+	}
+
+	respondJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,8 @@
+//go:build tools
+
+// This file pins the versions of development tools in go.mod so that CI and
+// every contributor run the same ones, e.g. go run
+// golang.org/x/vuln/cmd/govulncheck ./... It is never built.
+package main
+
+import _ "golang.org/x/vuln/cmd/govulncheck"